@@ -0,0 +1,83 @@
+package authz
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+)
+
+// Ownership and role rules for mutating endpoints. Each rule reports whether
+// actorID may perform the action and returns sql.ErrNoRows when the target
+// does not exist.
+
+// Forbidden writes the 403 response shared by every authorization check.
+func Forbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   "forbidden",
+		"message": message,
+	})
+}
+
+// IsProfileOwner reports whether username is actorID's own account.
+func IsProfileOwner(db *sql.DB, actorID int, username string) (bool, error) {
+	var userID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&userID); err != nil {
+		return false, err
+	}
+	return userID == actorID, nil
+}
+
+// CanDeletePost reports whether actorID may delete a post: only its author can.
+func CanDeletePost(db *sql.DB, actorID, postID int) (bool, error) {
+	var authorID int
+	if err := db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&authorID); err != nil {
+		return false, err
+	}
+	return authorID == actorID, nil
+}
+
+// CanDeleteGroupPost reports whether actorID may delete a group post: its
+// author or an admin of the group.
+func CanDeleteGroupPost(db *sql.DB, actorID, postID int) (bool, error) {
+	var authorID, groupID int
+	err := db.QueryRow(`SELECT user_id, group_id FROM group_posts WHERE id = ?`, postID).Scan(&authorID, &groupID)
+	if err != nil {
+		return false, err
+	}
+	if authorID == actorID {
+		return true, nil
+	}
+	return isGroupAdmin(db, actorID, groupID)
+}
+
+// CanCancelInvitation reports whether actorID may cancel a group invitation:
+// only the member who sent it can.
+func CanCancelInvitation(db *sql.DB, actorID, invitationID int) (bool, error) {
+	var inviterID int
+	if err := db.QueryRow(`SELECT inviter_id FROM group_invitations WHERE id = ?`, invitationID).Scan(&inviterID); err != nil {
+		return false, err
+	}
+	return inviterID == actorID, nil
+}
+
+// CanRespondToJoinRequest reports whether actorID may accept or decline a
+// request to join a group (a group_members row): admins of the group can.
+func CanRespondToJoinRequest(db *sql.DB, actorID, requestID int) (bool, error) {
+	var groupID int
+	if err := db.QueryRow(`SELECT group_id FROM group_members WHERE id = ?`, requestID).Scan(&groupID); err != nil {
+		return false, err
+	}
+	return isGroupAdmin(db, actorID, groupID)
+}
+
+func isGroupAdmin(db *sql.DB, userID, groupID int) (bool, error) {
+	var admin bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM group_members
+		               WHERE group_id = ? AND user_id = ? AND status = 'accepted' AND is_admin = 1)`,
+		groupID, userID).Scan(&admin)
+	return admin, err
+}
@@ -0,0 +1,67 @@
+package authz
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestOwnership(t *testing.T) {
+	db := newTestDB(t)
+
+	fixture := []string{
+		`UPDATE group_members SET is_admin = 1 WHERE group_id = 1 AND user_id = 1`,
+		`INSERT INTO group_members (group_id, user_id, status) VALUES (1, 5, 'accepted')`,
+		`INSERT INTO group_posts (id, group_id, user_id, title, content) VALUES (2, 1, 5, 't', 'c')`,
+		`INSERT INTO group_invitations (id, group_id, inviter_id, invitee_id) VALUES (1, 1, 1, 4)`,
+	}
+	for _, q := range fixture {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	joinRequest := 2 // the follower's pending group_members row
+
+	tests := []struct {
+		name  string
+		check func(actorID int) (bool, error)
+		actor int
+		want  bool
+	}{
+		{"own profile", func(a int) (bool, error) { return IsProfileOwner(db, a, "user1") }, author, true},
+		{"someone else's profile", func(a int) (bool, error) { return IsProfileOwner(db, a, "user1") }, follower, false},
+		{"delete own post", func(a int) (bool, error) { return CanDeletePost(db, a, publicPost) }, author, true},
+		{"delete someone else's post", func(a int) (bool, error) { return CanDeletePost(db, a, publicPost) }, follower, false},
+		{"delete own group post", func(a int) (bool, error) { return CanDeleteGroupPost(db, a, 2) }, stranger, true},
+		{"admin deletes a member's group post", func(a int) (bool, error) { return CanDeleteGroupPost(db, a, 2) }, author, true},
+		{"member deletes the admin's group post", func(a int) (bool, error) { return CanDeleteGroupPost(db, a, groupPost) }, stranger, false},
+		{"inviter cancels", func(a int) (bool, error) { return CanCancelInvitation(db, a, 1) }, author, true},
+		{"invitee cancels", func(a int) (bool, error) { return CanCancelInvitation(db, a, 1) }, selectedStranger, false},
+		{"admin answers a join request", func(a int) (bool, error) { return CanRespondToJoinRequest(db, a, joinRequest) }, author, true},
+		{"member answers a join request", func(a int) (bool, error) { return CanRespondToJoinRequest(db, a, joinRequest) }, stranger, false},
+		{"requester answers their own request", func(a int) (bool, error) { return CanRespondToJoinRequest(db, a, joinRequest) }, follower, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.check(tt.actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	missing := []func() (bool, error){
+		func() (bool, error) { return IsProfileOwner(db, author, "nobody") },
+		func() (bool, error) { return CanDeletePost(db, author, 99) },
+		func() (bool, error) { return CanDeleteGroupPost(db, author, 99) },
+		func() (bool, error) { return CanCancelInvitation(db, author, 99) },
+		func() (bool, error) { return CanRespondToJoinRequest(db, author, 99) },
+	}
+	for i, check := range missing {
+		if _, err := check(); err != sql.ErrNoRows {
+			t.Errorf("check %d on a missing target: err = %v, want sql.ErrNoRows", i, err)
+		}
+	}
+}
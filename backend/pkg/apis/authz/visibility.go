@@ -0,0 +1,211 @@
+// Package authz decides who may see what. Every handler and query that
+// returns posts, comments, profiles or group content asks it, so the privacy
+// rules are written down once.
+//
+// A post is visible to its author and, depending on posts.privacy_level:
+//
+//	PostPublic:        every user
+//	PostAlmostPrivate: users who follow the author
+//	PostPrivate:       users who follow the author and were picked for the post
+//	                   (post_permissions); unfollowing takes the access away
+//
+// A comment is visible to whoever can see its post. A profile is visible to its
+// owner, to everyone if it is public and to followers if it is private. Group
+// content is visible to accepted members of the group.
+package authz
+
+import (
+	"database/sql"
+)
+
+// Post privacy levels, as stored in posts.privacy_level.
+const (
+	PostPublic        = 0
+	PostAlmostPrivate = 1
+	PostPrivate       = 2
+)
+
+// PostRelation is what the post rules need to know about a viewer.
+type PostRelation struct {
+	IsAuthor bool
+	Follows  bool // the viewer follows the author
+	Selected bool // the author picked the viewer for a PostPrivate post
+}
+
+// PostVisible reports whether a viewer in relation rel may see a post with the
+// given privacy level. Unknown levels are only visible to the author.
+func PostVisible(level int, rel PostRelation) bool {
+	if rel.IsAuthor {
+		return true
+	}
+	switch level {
+	case PostPublic:
+		return true
+	case PostAlmostPrivate:
+		return rel.Follows
+	case PostPrivate:
+		return rel.Follows && rel.Selected
+	}
+	return false
+}
+
+// ProfileVisible reports whether a profile's details, followers and posts page
+// may be shown to a viewer.
+func ProfileVisible(isPrivate, isSelf, follows bool) bool {
+	return isSelf || !isPrivate || follows
+}
+
+// PostFilter returns an SQL condition for a query over posts aliased as alias
+// that keeps the posts viewerID may see. It is PostVisible written in SQL; a
+// viewerID of 0 sees public posts only. Posts of accounts waiting for
+// deletion are left out.
+func PostFilter(alias string, viewerID int) (string, []interface{}) {
+	level := "COALESCE(" + alias + ".privacy_level, 0)"
+	cond := `(NOT EXISTS (SELECT 1 FROM users vd WHERE vd.id = ` + alias + `.user_id AND vd.purge_after IS NOT NULL)
+		AND (` + alias + `.user_id = ?
+		OR ` + level + ` = 0
+		OR (` + level + ` IN (1, 2)
+			AND EXISTS (SELECT 1 FROM userFollow vf WHERE vf.follower_id = ? AND vf.following_id = ` + alias + `.user_id)
+			AND (` + level + ` = 1
+				OR EXISTS (SELECT 1 FROM post_permissions vp WHERE vp.post_id = ` + alias + `.id AND vp.user_id = ?)))))`
+	return cond, []interface{}{viewerID, viewerID, viewerID}
+}
+
+// postRelation returns sql.ErrNoRows for posts of accounts waiting for
+// deletion, like for missing ones.
+func postRelation(db *sql.DB, viewerID, postID int) (int, int, PostRelation, error) {
+	var authorID, level int
+	var rel PostRelation
+	err := db.QueryRow(`
+		SELECT p.user_id, COALESCE(p.privacy_level, 0)
+		FROM posts p JOIN users u ON u.id = p.user_id
+		WHERE p.id = ? AND u.purge_after IS NULL`, postID).Scan(&authorID, &level)
+	if err != nil {
+		return 0, 0, rel, err
+	}
+	rel.IsAuthor = viewerID > 0 && viewerID == authorID
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM userFollow WHERE follower_id = ? AND following_id = ?),
+		       EXISTS (SELECT 1 FROM post_permissions WHERE post_id = ? AND user_id = ?)`,
+		viewerID, authorID, postID, viewerID).Scan(&rel.Follows, &rel.Selected)
+	return authorID, level, rel, err
+}
+
+// CanSeePost reports whether viewerID may see a post. It returns
+// sql.ErrNoRows if the post does not exist.
+func CanSeePost(db *sql.DB, viewerID, postID int) (bool, error) {
+	_, level, rel, err := postRelation(db, viewerID, postID)
+	if err != nil {
+		return false, err
+	}
+	return PostVisible(level, rel), nil
+}
+
+// CommentPostID returns the post a comment belongs to.
+func CommentPostID(db *sql.DB, commentID int) (int, error) {
+	var postID int
+	err := db.QueryRow(`SELECT post_id FROM comments WHERE id = ?`, commentID).Scan(&postID)
+	return postID, err
+}
+
+// CanSeeComment reports whether viewerID may see a comment, that is its post.
+// It returns sql.ErrNoRows if the comment does not exist.
+func CanSeeComment(db *sql.DB, viewerID, commentID int) (bool, error) {
+	postID, err := CommentPostID(db, commentID)
+	if err != nil {
+		return false, err
+	}
+	return CanSeePost(db, viewerID, postID)
+}
+
+// CanSeeProfile reports whether viewerID may see the full profile of userID.
+// It returns sql.ErrNoRows if the user does not exist or is waiting for
+// deletion.
+func CanSeeProfile(db *sql.DB, viewerID, userID int) (bool, error) {
+	var isPrivate, follows bool
+	err := db.QueryRow(`
+		SELECT u.isPrivate, EXISTS (SELECT 1 FROM userFollow WHERE follower_id = ? AND following_id = u.id)
+		FROM users u WHERE u.id = ? AND u.purge_after IS NULL`, viewerID, userID).Scan(&isPrivate, &follows)
+	if err != nil {
+		return false, err
+	}
+	return ProfileVisible(isPrivate, viewerID > 0 && viewerID == userID, follows), nil
+}
+
+// CanFollowDirectly reports whether followerID may follow userID without a
+// follow request. Following a private profile grants access to it and to its
+// follower-only posts, so only public profiles (and ones followerID already
+// follows) can be followed directly. It returns sql.ErrNoRows if the user
+// does not exist or is waiting for deletion.
+func CanFollowDirectly(db *sql.DB, followerID, userID int) (bool, error) {
+	var isPrivate, follows bool
+	err := db.QueryRow(`
+		SELECT u.isPrivate, EXISTS (SELECT 1 FROM userFollow WHERE follower_id = ? AND following_id = u.id)
+		FROM users u WHERE u.id = ? AND u.purge_after IS NULL`, followerID, userID).Scan(&isPrivate, &follows)
+	if err != nil {
+		return false, err
+	}
+	return !isPrivate || follows, nil
+}
+
+// CanSeeGroup reports whether viewerID may see the posts, events and chat of
+// a group: only its accepted members can.
+func CanSeeGroup(db *sql.DB, viewerID, groupID int) (bool, error) {
+	var member bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ? AND status = 'accepted')`,
+		groupID, viewerID).Scan(&member)
+	return member, err
+}
+
+// CanSeeGroupPost reports whether viewerID may see a group post and its
+// comments. It returns sql.ErrNoRows if the post does not exist.
+func CanSeeGroupPost(db *sql.DB, viewerID, postID int) (bool, error) {
+	var groupID int
+	if err := db.QueryRow(`SELECT group_id FROM group_posts WHERE id = ?`, postID).Scan(&groupID); err != nil {
+		return false, err
+	}
+	return CanSeeGroup(db, viewerID, groupID)
+}
+
+// PostAudience returns who may see a post, for pushing it over the WebSocket.
+// everyone is true for public posts; otherwise ids holds the author and the
+// viewers allowed by the post's privacy level.
+func PostAudience(db *sql.DB, postID int) (ids []int, everyone bool, err error) {
+	var authorID, level int
+	err = db.QueryRow(`SELECT user_id, COALESCE(privacy_level, 0) FROM posts WHERE id = ?`, postID).Scan(&authorID, &level)
+	if err != nil {
+		return nil, false, err
+	}
+	if level == PostPublic {
+		return nil, true, nil
+	}
+
+	ids = []int{authorID}
+	var rows *sql.Rows
+	switch level {
+	case PostAlmostPrivate:
+		rows, err = db.Query(`SELECT follower_id FROM userFollow WHERE following_id = ?`, authorID)
+	case PostPrivate:
+		rows, err = db.Query(`
+			SELECT f.follower_id FROM userFollow f
+			JOIN post_permissions pp ON pp.user_id = f.follower_id AND pp.post_id = ?
+			WHERE f.following_id = ?`, postID, authorID)
+	default:
+		return ids, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, err
+		}
+		if id != authorID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, false, rows.Err()
+}
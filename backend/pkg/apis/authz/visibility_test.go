@@ -0,0 +1,335 @@
+package authz
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"socialnetwork/pkg/db/sqlite"
+)
+
+func TestPostVisible(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+		rel   PostRelation
+		want  bool
+	}{
+		{"public, stranger", PostPublic, PostRelation{}, true},
+		{"public, author", PostPublic, PostRelation{IsAuthor: true}, true},
+		{"almost private, stranger", PostAlmostPrivate, PostRelation{}, false},
+		{"almost private, follower", PostAlmostPrivate, PostRelation{Follows: true}, true},
+		{"almost private, author", PostAlmostPrivate, PostRelation{IsAuthor: true}, true},
+		{"almost private, selected but not following", PostAlmostPrivate, PostRelation{Selected: true}, false},
+		{"private, stranger", PostPrivate, PostRelation{}, false},
+		{"private, follower not selected", PostPrivate, PostRelation{Follows: true}, false},
+		{"private, selected but not following", PostPrivate, PostRelation{Selected: true}, false},
+		{"private, selected follower", PostPrivate, PostRelation{Follows: true, Selected: true}, true},
+		{"private, author", PostPrivate, PostRelation{IsAuthor: true}, true},
+		{"unknown level, follower", 7, PostRelation{Follows: true, Selected: true}, false},
+		{"unknown level, author", 7, PostRelation{IsAuthor: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PostVisible(tt.level, tt.rel); got != tt.want {
+				t.Errorf("PostVisible(%d, %+v) = %v, want %v", tt.level, tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileVisible(t *testing.T) {
+	tests := []struct {
+		name                       string
+		isPrivate, isSelf, follows bool
+		want                       bool
+	}{
+		{"public, stranger", false, false, false, true},
+		{"private, stranger", true, false, false, false},
+		{"private, follower", true, false, true, true},
+		{"private, self", true, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProfileVisible(tt.isPrivate, tt.isSelf, tt.follows); got != tt.want {
+				t.Errorf("ProfileVisible(%v, %v, %v) = %v, want %v", tt.isPrivate, tt.isSelf, tt.follows, got, tt.want)
+			}
+		})
+	}
+}
+
+// Users of the fixture. The author's profile is private.
+const (
+	anonymous        = 0
+	author           = 1
+	follower         = 2 // follows the author
+	selectedFollower = 3 // follows the author and is picked for the private post
+	selectedStranger = 4 // picked for the private post but does not follow
+	stranger         = 5
+	followedByAuthor = 6 // the author follows them, not the other way round
+)
+
+// Posts and comments of the fixture, all written by the author.
+const (
+	publicPost        = 1
+	almostPrivatePost = 2
+	privatePost       = 3
+	privateComment    = 1 // on privatePost
+	groupID           = 1
+	groupPost         = 1
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	migrations, err := filepath.Abs("../../db/migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlite.ConnectAndMigrate(filepath.Join(t.TempDir(), "test.db"), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for id := author; id <= followedByAuthor; id++ {
+		_, err := db.Exec(`
+			INSERT INTO users (id, username, firstname, lastname, age, gender, email, password, isPrivate)
+			VALUES (?, ?, 'F', 'L', '20', 'other', ?, 'x', ?)`,
+			id, fmt.Sprintf("user%d", id), fmt.Sprintf("user%d@example.com", id), id == author)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fixture := []string{
+		`INSERT INTO userFollow (follower_id, following_id) VALUES (2, 1), (3, 1), (1, 6)`,
+		`INSERT INTO posts (id, user_id, title, content, privacy_level) VALUES (1, 1, 't', 'c', 0), (2, 1, 't', 'c', 1), (3, 1, 't', 'c', 2)`,
+		`INSERT INTO post_permissions (post_id, user_id) VALUES (3, 3), (3, 4)`,
+		`INSERT INTO comments (id, post_id, user_id, content) VALUES (1, 3, 1, 'c')`,
+		`INSERT INTO groups (id, title, description, creator_id) VALUES (1, 'g', 'd', 1)`,
+		`INSERT INTO group_members (group_id, user_id, status) VALUES (1, 1, 'accepted'), (1, 2, 'pending'), (1, 3, 'declined')`,
+		`INSERT INTO group_posts (id, group_id, user_id, title, content) VALUES (1, 1, 1, 't', 'c')`,
+	}
+	for _, q := range fixture {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	return db
+}
+
+func TestCanSeePost(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		viewer int
+		want   []int // posts the viewer may see
+	}{
+		{anonymous, []int{publicPost}},
+		{author, []int{publicPost, almostPrivatePost, privatePost}},
+		{follower, []int{publicPost, almostPrivatePost}},
+		{selectedFollower, []int{publicPost, almostPrivatePost, privatePost}},
+		{selectedStranger, []int{publicPost}},
+		{stranger, []int{publicPost}},
+		{followedByAuthor, []int{publicPost}},
+	}
+	for _, tt := range tests {
+		// The single post check and the SQL filter used by list queries must agree.
+		for _, postID := range []int{publicPost, almostPrivatePost, privatePost} {
+			want := slices.Contains(tt.want, postID)
+			got, err := CanSeePost(db, tt.viewer, postID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("CanSeePost(viewer %d, post %d) = %v, want %v", tt.viewer, postID, got, want)
+			}
+		}
+
+		cond, args := PostFilter("p", tt.viewer)
+		rows, err := db.Query(`SELECT p.id FROM posts p WHERE `+cond+` ORDER BY p.id`, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var listed []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			listed = append(listed, id)
+		}
+		rows.Close()
+		if !slices.Equal(listed, tt.want) {
+			t.Errorf("PostFilter(viewer %d) lists %v, want %v", tt.viewer, listed, tt.want)
+		}
+	}
+
+	if _, err := CanSeePost(db, author, 99); err != sql.ErrNoRows {
+		t.Errorf("CanSeePost on a missing post: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCanSeeComment(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		viewer int
+		want   bool
+	}{
+		{author, true},
+		{selectedFollower, true},
+		{follower, false},
+		{selectedStranger, false},
+		{anonymous, false},
+	}
+	for _, tt := range tests {
+		got, err := CanSeeComment(db, tt.viewer, privateComment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CanSeeComment(viewer %d) = %v, want %v", tt.viewer, got, tt.want)
+		}
+	}
+}
+
+func TestCanSeeProfile(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name           string
+		viewer, target int
+		want           bool
+	}{
+		{"private profile, owner", author, author, true},
+		{"private profile, follower", follower, author, true},
+		{"private profile, followed by the owner only", followedByAuthor, author, false},
+		{"private profile, stranger", stranger, author, false},
+		{"private profile, anonymous", anonymous, author, false},
+		{"public profile, stranger", stranger, follower, true},
+		{"public profile, anonymous", anonymous, follower, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanSeeProfile(db, tt.viewer, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanSeeProfile(%d, %d) = %v, want %v", tt.viewer, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanFollowDirectly(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name           string
+		viewer, target int
+		want           bool
+	}{
+		{"private profile, stranger", stranger, author, false},
+		{"private profile, followed by the owner only", followedByAuthor, author, false},
+		{"private profile, follower", follower, author, true},
+		{"public profile, stranger", stranger, follower, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanFollowDirectly(db, tt.viewer, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanFollowDirectly(%d, %d) = %v, want %v", tt.viewer, tt.target, got, tt.want)
+			}
+		})
+	}
+	if _, err := CanFollowDirectly(db, stranger, 99); err != sql.ErrNoRows {
+		t.Errorf("unknown user: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPendingDeletionHidden(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`UPDATE users SET purge_after = ? WHERE id = ?`, time.Now().Add(time.Hour), author); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CanSeeProfile(db, follower, author); err != sql.ErrNoRows {
+		t.Errorf("CanSeeProfile: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := CanSeePost(db, follower, publicPost); err != sql.ErrNoRows {
+		t.Errorf("CanSeePost: err = %v, want sql.ErrNoRows", err)
+	}
+
+	cond, args := PostFilter("p", follower)
+	var listed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM posts p WHERE `+cond, args...).Scan(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if listed != 0 {
+		t.Errorf("PostFilter lists %d posts of an account waiting for deletion", listed)
+	}
+}
+
+func TestCanSeeGroup(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name   string
+		viewer int
+		want   bool
+	}{
+		{"accepted member", author, true},
+		{"pending member", follower, false},
+		{"declined member", selectedFollower, false},
+		{"not a member", stranger, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanSeeGroup(db, tt.viewer, groupID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanSeeGroup(%d) = %v, want %v", tt.viewer, got, tt.want)
+			}
+			got, err = CanSeeGroupPost(db, tt.viewer, groupPost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanSeeGroupPost(%d) = %v, want %v", tt.viewer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostAudience(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		postID   int
+		everyone bool
+		want     []int
+	}{
+		{publicPost, true, nil},
+		{almostPrivatePost, false, []int{author, follower, selectedFollower}},
+		{privatePost, false, []int{author, selectedFollower}},
+	}
+	for _, tt := range tests {
+		ids, everyone, err := PostAudience(db, tt.postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(ids)
+		if everyone != tt.everyone || !slices.Equal(ids, tt.want) {
+			t.Errorf("PostAudience(%d) = %v, %v, want %v, %v", tt.postID, ids, everyone, tt.want, tt.everyone)
+		}
+	}
+}
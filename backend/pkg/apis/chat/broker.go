@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Broker connects the hubs of the server instances sharing the same
+// database, so several of them can run behind a load balancer. A hub
+// delivers to its own connections itself and publishes every delivery for
+// the other instances, which deliver it to theirs.
+type Broker interface {
+	// Publish sends d to the other instances.
+	Publish(d Delivery) error
+	// Subscribe starts passing what the other instances publish to h. It is
+	// called once, by Hub.Run.
+	Subscribe(h BrokerHandler) error
+	// SetPresence records the users connected to this instance.
+	SetPresence(users []OnlineUser) error
+	// Presence returns the users connected to the other instances.
+	Presence() ([]OnlineUser, error)
+	Close() error
+}
+
+// BrokerHandler receives what the other instances publish.
+type BrokerHandler struct {
+	// Deliver hands a delivery to this instance's connections.
+	Deliver func(Delivery)
+	// PresenceChanged is called when the users of another instance change.
+	PresenceChanged func()
+	// Lost is called when deliveries may have been missed, e.g. while the
+	// broker was reconnecting.
+	Lost func()
+}
+
+// Delivery is a frame on its way to the connections of some users: the
+// users in UserIDs, the accepted members of GroupID, or everyone but Except
+// when All is set. With CloseSession set it closes the connections opened
+// with that session instead.
+type Delivery struct {
+	UserIDs      []int           `json:"user_ids,omitempty"`
+	GroupID      int             `json:"group_id,omitempty"`
+	All          bool            `json:"all,omitempty"`
+	Except       int             `json:"except,omitempty"`
+	CloseSession string          `json:"close_session,omitempty"`
+	Type         string          `json:"type,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+}
+
+// BrokerFromEnv returns a RedisBroker when REDIS_URL is set
+// (redis://[:password@]host:port[/db], keys and channels prefixed with
+// REDIS_PREFIX, "socialnetwork:" by default), or else a MemoryBroker.
+func BrokerFromEnv() (Broker, error) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return MemoryBroker{}, nil
+	}
+	prefix := os.Getenv("REDIS_PREFIX")
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	b, err := NewRedisBroker(redisURL, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// MemoryBroker is the broker of a single instance: there is nobody to
+// publish to.
+type MemoryBroker struct{}
+
+func (MemoryBroker) Publish(Delivery) error          { return nil }
+func (MemoryBroker) Subscribe(BrokerHandler) error   { return nil }
+func (MemoryBroker) SetPresence([]OnlineUser) error  { return nil }
+func (MemoryBroker) Presence() ([]OnlineUser, error) { return nil, nil }
+func (MemoryBroker) Close() error                    { return nil }
@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// testRedisURL returns the Redis server to test against: REDIS_TEST_URL, or
+// a redis-server from PATH started on a free port. Without either the test
+// is skipped.
+func testRedisURL(t *testing.T) string {
+	t.Helper()
+	if url := os.Getenv("REDIS_TEST_URL"); url != "" {
+		return url
+	}
+	path, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not found and REDIS_TEST_URL not set")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	_, port, _ := net.SplitHostPort(addr)
+
+	cmd := exec.Command(path, "--port", port, "--bind", "127.0.0.1", "--save", "", "--appendonly", "no")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	waitFor(t, "redis-server", func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	return "redis://" + addr
+}
+
+// newRedisBroker returns a broker whose keys no other test shares.
+func newRedisBroker(t *testing.T, url, prefix string) *RedisBroker {
+	t.Helper()
+	b, err := NewRedisBroker(url, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// twoInstances starts two hubs sharing a database, with users 1 and 2 in
+// group 1, and a Redis broker each.
+func twoInstances(t *testing.T) (a, b *Hub, urlA, urlB string) {
+	t.Helper()
+	redisURL := testRedisURL(t)
+	prefix := fmt.Sprintf("test:%s:%d:", t.Name(), time.Now().UnixNano())
+
+	db := newTestDB(t, 3)
+	_, err := db.Exec(`
+		INSERT INTO groups (id, title, description, creator_id) VALUES (1, 'g', 'd', 1);
+		INSERT INTO group_members (group_id, user_id, status) VALUES (1, 1, 'accepted'), (1, 2, 'accepted')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, urlA = startTestHub(t, db, newRedisBroker(t, redisURL, prefix))
+	b, urlB = startTestHub(t, db, newRedisBroker(t, redisURL, prefix))
+	return a, b, urlA, urlB
+}
+
+func onlineIDs(h *Hub) string {
+	return fmt.Sprint(h.GetOnlineUserIDs())
+}
+
+func TestRedisBrokerSharesTheHub(t *testing.T) {
+	hubA, hubB, urlA, urlB := twoInstances(t)
+
+	alice := dial(t, urlA, 1)
+	defer alice.Close()
+	bob := dial(t, urlB, 2)
+	defer bob.Close()
+	readType(t, alice, "hello", time.Second)
+	readType(t, bob, "hello", time.Second)
+
+	// Presence is aggregated across instances
+	waitFor(t, "presence", func() bool {
+		return onlineIDs(hubA) == "[1 2]" && onlineIDs(hubB) == "[1 2]"
+	})
+
+	// Direct delivery
+	send(t, alice, "", SendPrivateMessage{To: 2, Content: "hi bob"})
+	if msg := readType(t, bob, "private_message", 2*time.Second); msg.Payload.Content != "hi bob" || msg.Seq == 0 {
+		t.Errorf("bob got %+v", msg)
+	}
+	readType(t, alice, "private_message", 2*time.Second)
+
+	// Group fan-out
+	send(t, bob, "", SendGroupMessage{GroupID: 1, Content: "hi group"})
+	if msg := readType(t, alice, "group_message", 2*time.Second); msg.Payload.Content != "hi group" {
+		t.Errorf("alice got %+v", msg)
+	}
+
+	// Broadcasts
+	hubA.BroadcastToAll(NewPost{Content: "post"})
+	readType(t, bob, "new_post", 2*time.Second)
+
+	// Closing a session closes its connections on every instance
+	hubA.CloseSession("session2")
+	waitFor(t, "bob to be disconnected", func() bool { return !hubB.IsOnline(2) })
+	waitFor(t, "presence", func() bool {
+		return onlineIDs(hubA) == "[1]" && onlineIDs(hubB) == "[1]"
+	})
+}
+
+func TestRedisBrokerResyncsAfterReconnecting(t *testing.T) {
+	hubA, _, urlA, _ := twoInstances(t)
+	alice := dial(t, urlA, 1)
+	defer alice.Close()
+	stream := readType(t, alice, "hello", time.Second).Payload.Stream
+
+	// Deliveries published while A resubscribes are lost
+	broker := hubA.Broker.(*RedisBroker)
+	broker.mu.Lock()
+	broker.sub.Close()
+	broker.mu.Unlock()
+
+	msg := readType(t, alice, "resync", 5*time.Second)
+	if msg.Payload.Stream != stream || msg.Payload.Seq == 0 {
+		t.Errorf("got %+v", msg)
+	}
+}
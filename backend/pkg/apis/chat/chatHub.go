@@ -2,343 +2,559 @@ package chat
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"strconv"
+	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	database "socialnetwork/pkg/db"
 
-	"github.com/gorilla/websocket"
 	_ "modernc.org/sqlite"
 )
 
-type Frontend struct {
-	From         int       `json:"from"`
-	To           int       `json:"to"`
-	GroupID      int       `json:"group_id"`
-	Content      string    `json:"content"`
-	Username     string    `json:"username"`
-	Timestamp    time.Time `json:"timestamp"`
-	Type         string    `json:"type"`
-	PostId       int       `json:"post_id"`
-	CommentId    int       `json:"comment_id"`
-	IsLike       bool      `json:"is_like"`
-	IsPrivate    bool      `json:"isPrivate,omitempty"`
-	YesCount     int       `json:"yes_count,omitempty"`
-	NoCount      int       `json:"no_count,omitempty"`
-	UserVote     string    `json:"user_vote,omitempty"`
-	RequestID    int       `json:"request_id,omitempty"`
-	InvitationID int       `json:"invitation_id,omitempty"`
-	EventDate    string    `json:"event_date,omitempty"`
-}
-
-type Client struct {
-	UserID int
-	Conn   *websocket.Conn
-	Send   chan Frontend
+// SlowConsumerPolicy decides what happens to a connection whose send queue
+// is full, i.e. a client that reads slower than frames arrive.
+type SlowConsumerPolicy int
+
+const (
+	// DisconnectSlowConsumers closes the connection; the client reconnects
+	// and reloads what it missed. This is the default.
+	DisconnectSlowConsumers SlowConsumerPolicy = iota
+	// DropSlowConsumerFrames drops the frames that do not fit in the queue
+	// and keeps the connection.
+	DropSlowConsumerFrames
+)
+
+// SlowConsumerPolicyFromEnv reads WS_SLOW_CONSUMERS: "drop" or "disconnect"
+// (the default).
+func SlowConsumerPolicyFromEnv() SlowConsumerPolicy {
+	if os.Getenv("WS_SLOW_CONSUMERS") == "drop" {
+		return DropSlowConsumerFrames
+	}
+	return DisconnectSlowConsumers
 }
 
 type Hub struct {
-	Clients      map[int]*Client
-	Online       chan *Client
-	Offline      chan *Client
-	Broadcast    chan Frontend
-	MessageStore map[string][]Frontend
-	Mutex        sync.RWMutex
-	DB           *sql.DB
+	// Clients holds every open connection per user; a user can have several tabs/devices
+	Clients map[int]map[*Client]bool
+	Online  chan *Client
+	Offline chan *Client
+	Mutex   sync.RWMutex
+	DB      *sql.DB
+	// CanWrite, if set, decides whether a user may send messages; frames
+	// from users it rejects are answered with an error.
+	CanWrite func(userID int) bool
+	// SlowConsumers is what happens to connections that fall behind.
+	SlowConsumers SlowConsumerPolicy
+	// Broker shares deliveries and presence with the other server instances;
+	// set it before Run. The default, a MemoryBroker, serves a single one.
+	Broker Broker
+
+	events *eventLog
+	// Whether the users connected here, or to another instance, changed
+	// since the online users list was last sent
+	localPresenceChanged, remotePresenceChanged atomic.Bool
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
+const (
+	// sessionCheckInterval controls how often the hub re-checks that the session
+	// behind every open connection still exists and has not expired.
+	sessionCheckInterval = time.Minute
+	// presenceInterval is how often, at most, the online users list is sent
+	// to everyone, so a burst of connections does not send it once per
+	// connection to every other one.
+	presenceInterval = time.Second
+)
 
 func NewHub(db *sql.DB) *Hub {
 	return &Hub{
-		Clients:      make(map[int]*Client),
-		Online:       make(chan *Client),
-		Offline:      make(chan *Client),
-		Broadcast:    make(chan Frontend),
-		MessageStore: make(map[string][]Frontend),
-		DB:           db,
+		Clients: make(map[int]map[*Client]bool),
+		Online:  make(chan *Client),
+		Offline: make(chan *Client),
+		DB:      db,
+		Broker:  MemoryBroker{},
+		events:  newEventLog(),
 	}
 }
 
 func (h *Hub) Run() {
+	err := h.Broker.Subscribe(BrokerHandler{
+		Deliver:         h.deliver,
+		PresenceChanged: func() { h.remotePresenceChanged.Store(true) },
+		Lost:            h.resyncAll,
+	})
+	if err != nil {
+		fmt.Println("Error subscribing to the broker:", err)
+	}
+	go h.runPresence()
+
+	sessionTicker := time.NewTicker(sessionCheckInterval)
+	defer sessionTicker.Stop()
+
 	for {
 		select {
+		case <-sessionTicker.C:
+			go h.closeExpiredSessions()
+			h.events.expire(time.Now())
+
 		case client := <-h.Online:
 			h.Mutex.Lock()
-			h.Clients[client.UserID] = client
+			conns, ok := h.Clients[client.UserID]
+			if !ok {
+				conns = make(map[*Client]bool)
+				h.Clients[client.UserID] = conns
+			}
+			conns[client] = true
+			if len(conns) == 1 {
+				h.localPresenceChanged.Store(true)
+			}
+			h.events.connect(client.UserID)
+			// Nothing is delivered while the lock is held, so the replay
+			// ends exactly where live frames start
+			h.resume(client)
 			h.Mutex.Unlock()
 
-			// Broadcast updated online users list to all clients
-			h.broadcastOnlineUsers()
+			// The new connection gets the list right away, everyone else
+			// with the next presence update
+			go h.sendOnlineUsers(client)
 
 		case client := <-h.Offline:
 			h.Mutex.Lock()
-			delete(h.Clients, client.UserID)
-			h.Mutex.Unlock()
-
-			// Broadcast updated online users list to all clients
-			h.broadcastOnlineUsers()
-
-		case msg := <-h.Broadcast:
-			key := chatKey(msg.From, msg.To)
-			h.Mutex.Lock()
-			h.MessageStore[key] = append(h.MessageStore[key], msg)
-			h.Mutex.Unlock()
-			_ = h.saveMessageToDB(msg)
-			if toClient, ok := h.Clients[msg.To]; ok {
-				toClient.Send <- msg
+			if conns, ok := h.Clients[client.UserID]; ok && conns[client] {
+				delete(conns, client)
+				close(client.Send)
+				h.events.disconnect(client.UserID, time.Now())
+				// The user only goes offline when their last connection closes
+				if len(conns) == 0 {
+					delete(h.Clients, client.UserID)
+					h.localPresenceChanged.Store(true)
+				}
 			}
+			h.Mutex.Unlock()
 		}
 	}
 }
 
-func (h *Hub) GetOnlineUserIDs() []int {
-	h.Mutex.RLock()
-	defer h.Mutex.RUnlock()
+// SendToUser delivers p to every open connection of userID, on every
+// instance. Unless it is ephemeral, it is numbered and recorded for replay,
+// also while the user is briefly offline.
+func (h *Hub) SendToUser(userID int, p Payload) {
+	h.SendToUsers([]int{userID}, p)
+}
 
-	var userIDs []int
-	for id := range h.Clients {
-		userIDs = append(userIDs, id)
-	}
-	return userIDs
+// SendToUsers delivers p to every open connection of each user in userIDs.
+func (h *Hub) SendToUsers(userIDs []int, p Payload) {
+	h.publish(Delivery{UserIDs: userIDs}, p)
 }
 
-// broadcastOnlineUsers sends the updated list of online users to all connected clients
-func (h *Hub) broadcastOnlineUsers() {
-	h.Mutex.RLock()
-	defer h.Mutex.RUnlock()
+// SendToGroup delivers p to every open connection of the accepted members
+// of groupID.
+func (h *Hub) SendToGroup(groupID int, p Payload) {
+	h.publish(Delivery{GroupID: groupID}, p)
+}
 
-	// Get list of online user IDs with usernames
-	type OnlineUser struct {
-		ID       int    `json:"id"`
-		Username string `json:"username"`
-	}
+// BroadcastToAll delivers p to every open connection.
+func (h *Hub) BroadcastToAll(p Payload) {
+	h.BroadcastExcept(0, p)
+}
 
-	var onlineUsers []OnlineUser
-	for userID := range h.Clients {
-		// Fetch username from database
-		var username string
-		err := h.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-		if err == nil {
-			onlineUsers = append(onlineUsers, OnlineUser{ID: userID, Username: username})
-		}
+// BroadcastExcept delivers p to every open connection except those of
+// exceptUserID, and records it for the users who just went offline.
+func (h *Hub) BroadcastExcept(exceptUserID int, p Payload) {
+	h.publish(Delivery{All: true, Except: exceptUserID}, p)
+}
+
+// publish delivers p to the connections d targets on this instance and
+// passes it on to the other ones.
+func (h *Hub) publish(d Delivery, p Payload) {
+	msg := encodePayload(p)
+	if msg == nil {
+		return
 	}
+	d.Type, d.Payload = msg.typ, msg.payload
+	h.deliver(d)
+	if err := h.Broker.Publish(d); err != nil {
+		fmt.Println("Error publishing to the broker:", err)
+	}
+}
 
-	// Create a custom message with the users array
-	type OnlineUsersMessage struct {
-		Type      string       `json:"type"`
-		Users     []OnlineUser `json:"users"`
-		Timestamp time.Time    `json:"timestamp"`
+// deliver hands d to the connections on this instance.
+func (h *Hub) deliver(d Delivery) {
+	if d.CloseSession != "" {
+		h.closeLocalSession(d.CloseSession)
+		return
 	}
 
-	msg := OnlineUsersMessage{
-		Type:      "online_users",
-		Users:     onlineUsers,
-		Timestamp: time.Now(),
+	userIDs := d.UserIDs
+	if d.GroupID > 0 {
+		// Members are only looked up by the instances with someone to
+		// deliver to
+		if len(h.events.recipients()) == 0 {
+			return
+		}
+		var err error
+		if userIDs, err = h.getGroupMemberIDs(d.GroupID); err != nil {
+			fmt.Println("getGroupMemberIDs error:", err)
+			return
+		}
 	}
 
-	// Send to all connected clients
-	for _, client := range h.Clients {
-		// Convert to JSON and send directly
-		data, err := json.Marshal(msg)
-		if err == nil {
-			client.Conn.WriteMessage(websocket.TextMessage, data)
+	msg := &outgoing{typ: d.Type, payload: d.Payload}
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	if d.All {
+		userIDs = h.events.recipients()
+	}
+	for _, id := range userIDs {
+		if d.All && id == d.Except {
+			continue
 		}
+		h.sendToUserLocked(id, msg)
 	}
 }
 
-func chatKey(a, b int) string {
-	if a < b {
-		return fmt.Sprintf("%d-%d", a, b)
+// SendToPostAudience delivers p to the users allowed to see postID, so
+// pushes about a post never reach someone who could not load it.
+func (h *Hub) SendToPostAudience(postID int, p Payload) {
+	ids, everyone, err := authz.PostAudience(h.DB, postID)
+	if err != nil {
+		fmt.Println("Error getting post audience:", err)
+		return
+	}
+	if everyone {
+		h.BroadcastToAll(p)
+		return
 	}
-	return fmt.Sprintf("%d-%d", b, a)
+	h.SendToUsers(ids, p)
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("[WebSocket] ServeWs called from %s\n", r.RemoteAddr)
-	fmt.Printf("[WebSocket] Request URL: %s\n", r.URL.String())
-	fmt.Printf("[WebSocket] Request Headers: %v\n", r.Header)
+// IsOnline reports whether userID has at least one open connection to this
+// instance.
+func (h *Hub) IsOnline(userID int) bool {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	return len(h.Clients[userID]) > 0
+}
 
-	userIDStr := r.URL.Query().Get("user_id")
-	fmt.Printf("[WebSocket] userIDStr from query: '%s'\n", userIDStr)
+// sendToUserLocked must be called with h.Mutex held (read or write).
+func (h *Hub) sendToUserLocked(userID int, msg *outgoing) {
+	h.events.deliver(userID, msg, func(f *frame) {
+		for client := range h.Clients[userID] {
+			h.queue(client, f)
+		}
+	})
+}
 
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil || userID <= 0 {
-		fmt.Printf("[WebSocket] Invalid user ID: userIDStr='%s', err=%v, userID=%d\n", userIDStr, err, userID)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+// reply sends p to the connection c only, as the answer to the client frame
+// with the given id.
+func (h *Hub) reply(c *Client, id string, p Payload) {
+	msg := encodePayload(p)
+	if msg == nil {
 		return
 	}
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	if h.Clients[c.UserID][c] {
+		h.queue(c, msg.frame(id, 0))
+	}
+}
 
-	fmt.Printf("[WebSocket] Valid userID: %d, attempting upgrade\n", userID)
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		fmt.Printf("[WebSocket] Upgrade Error: %v\n", err)
+// queue hands a frame, encoded for the client's protocol version, to its
+// write pump without ever blocking; a full queue is handled by
+// h.SlowConsumers. It must be called with h.Mutex held, so the queue cannot
+// be closed meanwhile.
+func (h *Hub) queue(client *Client, f *frame) {
+	data := f.bytes(client.Version)
+	if data == nil {
 		return
 	}
+	select {
+	case client.Send <- data:
+	default:
+		if h.SlowConsumers == DisconnectSlowConsumers {
+			client.disconnectSlow()
+		}
+	}
+}
 
-	fmt.Printf("[WebSocket] Successfully upgraded connection for user %d\n", userID)
+// resume prepares what a new connection gets before any queued frame: a
+// "hello" frame with the sequence number the client is at, followed by the
+// events it missed when it resumes from an earlier connection, or a "resync"
+// frame when those are no longer available and it must reload everything.
+// It must be called with h.Mutex held for writing, right after the client is
+// registered, and releases the client's write pump.
+func (h *Hub) resume(client *Client) {
+	defer close(client.registered)
+
+	stream := h.events.stream
+	first := func(p Payload) {
+		client.replay = append(client.replay, encodePayload(p).frame("", 0).bytes(client.Version))
+	}
+	if client.resumeStream == "" {
+		// A fresh page load: the client has just loaded everything
+		first(Hello{Stream: stream, Seq: h.events.latest(client.UserID)})
+		return
+	}
 
-	client := &Client{UserID: userID, Conn: conn, Send: make(chan Frontend)}
-	hub.Online <- client
+	frames, last, ok := h.events.since(client.UserID, client.resumeSeq)
+	if client.resumeStream != stream || !ok {
+		first(Resync{Stream: stream, Seq: last})
+		return
+	}
+	first(Hello{Stream: stream, Seq: client.resumeSeq})
+	for _, f := range frames {
+		client.replay = append(client.replay, f.bytes(client.Version))
+	}
+}
 
-	go client.writePump()
-	go client.readPump(hub)
+// GetOnlineUserIDs returns the users connected to any instance.
+func (h *Hub) GetOnlineUserIDs() []int {
+	users := h.onlineUsers()
+	userIDs := make([]int, len(users))
+	for i, u := range users {
+		userIDs[i] = u.ID
+	}
+	return userIDs
 }
 
-func (c *Client) readPump(hub *Hub) {
-	defer func() {
-		hub.Offline <- c
-		c.Conn.Close()
-	}()
+// localUsers returns the users connected to this instance.
+func (h *Hub) localUsers() []OnlineUser {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
 
-	for {
-		_, data, err := c.Conn.ReadMessage()
-		if err != nil {
+	// Every connection knows its username, so no query is needed
+	users := make([]OnlineUser, 0, len(h.Clients))
+	for userID, conns := range h.Clients {
+		for client := range conns {
+			users = append(users, OnlineUser{ID: userID, Username: client.Username})
 			break
 		}
+	}
+	return users
+}
 
-		var msg Frontend
-		if err := json.Unmarshal(data, &msg); err != nil {
-			continue
+// onlineUsers returns the users connected to any instance, sorted by id.
+// Those of the other instances are left out when the broker fails.
+func (h *Hub) onlineUsers() []OnlineUser {
+	users := h.localUsers()
+	remote, err := h.Broker.Presence()
+	if err != nil {
+		fmt.Println("Error reading presence from the broker:", err)
+	}
+	seen := make(map[int]bool, len(users))
+	for _, u := range users {
+		seen[u.ID] = true
+	}
+	for _, u := range remote {
+		if !seen[u.ID] {
+			seen[u.ID] = true
+			users = append(users, u)
 		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
 
-		// Handle request for online users list
-		if msg.Type == "get_online_users" {
-			hub.broadcastOnlineUsers()
-			continue
-		}
+// onlineUsersMessage builds the "online_users" frame.
+func (h *Hub) onlineUsersMessage() *frame {
+	msg := encodePayload(OnlineUsers{Users: h.onlineUsers(), Timestamp: time.Now()})
+	return msg.frame("", 0)
+}
 
-		// Handle typing signal separately
-		if msg.Type == "typing" {
-			hub.Mutex.RLock()
-			if toClient, ok := hub.Clients[msg.To]; ok {
-				toClient.Send <- msg
+// runPresence records the users connected here with the broker and sends
+// the online users list to everyone, at most once every presenceInterval,
+// when they changed here or on another instance.
+func (h *Hub) runPresence() {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		local := h.localPresenceChanged.Swap(false)
+		remote := h.remotePresenceChanged.Swap(false)
+		if local {
+			if err := h.Broker.SetPresence(h.localUsers()); err != nil {
+				fmt.Println("Error recording presence with the broker:", err)
 			}
-			hub.Mutex.RUnlock()
-			continue
 		}
-
-		if msg.Type == "new_post" || msg.Type == "new_comment" || msg.Type == "new_postLike" || msg.Type == "new_commentLike" {
-			hub.Mutex.RLock()
-			for _, client := range hub.Clients {
-				client.Send <- msg
-			}
-			hub.Mutex.RUnlock()
-			continue
+		if local || remote {
+			h.broadcastOnlineUsers()
 		}
+	}
+}
 
-		// Group chat fan-out
-		if msg.Type == "group_message" || msg.Type == "new_groupPost" || msg.Type == "new_groupEvent" {
-			msg.Timestamp = time.Now()
+// broadcastOnlineUsers sends the updated list of online users to all connected clients
+func (h *Hub) broadcastOnlineUsers() {
+	f := h.onlineUsersMessage()
 
-			if msg.Type == "group_message" {
-				// 1) Save to DB
-				if err := hub.saveGroupMessageToDB(msg); err != nil {
-					// optional: log but don't break fan-out
-					fmt.Println("saveGroupMessageToDB error:", err)
-				}
-			}
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	for _, conns := range h.Clients {
+		for client := range conns {
+			h.queue(client, f)
+		}
+	}
+}
 
-			// 2) Find members of the group
-			memberIDs, err := hub.getGroupMemberIDs(msg.GroupID)
-			if err != nil {
-				fmt.Println("getGroupMemberIDs error:", err)
-				return
-			}
+// sendOnlineUsers sends the list of online users to a single connection
+func (h *Hub) sendOnlineUsers(client *Client) {
+	f := h.onlineUsersMessage()
 
-			// 3) Send to every online member (including sender for echo)
-			hub.Mutex.RLock()
-			for _, mid := range memberIDs {
-				if cl, ok := hub.Clients[mid]; ok {
-					cl.Send <- msg
-				}
-			}
-			hub.Mutex.RUnlock()
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	if h.Clients[client.UserID][client] {
+		h.queue(client, f)
+	}
+}
 
-			// handled — skip the 1:1 broadcast path
-			continue
+// resyncAll makes every client reload, after deliveries from other
+// instances may have been lost: connected ones get a "resync" frame, and the
+// others resync when they resume.
+func (h *Hub) resyncAll() {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	h.events.lose()
+	for userID, conns := range h.Clients {
+		f := encodePayload(Resync{Stream: h.events.stream, Seq: h.events.latest(userID)}).frame("", 0)
+		for client := range conns {
+			h.queue(client, f)
 		}
+	}
+	h.remotePresenceChanged.Store(true)
+}
 
-		// todo: Notifications
-		if msg.Type == "notif" {
-			hub.Mutex.RLock()
-			for _, client := range hub.Clients {
-				if client.UserID != msg.From {
-					client.Send <- msg
-				}
+// CloseSession closes every connection opened with the given session token,
+// on every instance. It is called when a session is deleted (e.g. on logout).
+func (h *Hub) CloseSession(sessionToken string) {
+	if sessionToken == "" {
+		return
+	}
+	d := Delivery{CloseSession: sessionToken}
+	h.deliver(d)
+	if err := h.Broker.Publish(d); err != nil {
+		fmt.Println("Error publishing to the broker:", err)
+	}
+}
+
+// closeLocalSession closes the connections to this instance opened with
+// sessionToken.
+func (h *Hub) closeLocalSession(sessionToken string) {
+	h.Mutex.RLock()
+	var clients []*Client
+	for _, conns := range h.Clients {
+		for client := range conns {
+			if client.SessionToken == sessionToken {
+				clients = append(clients, client)
 			}
-			hub.Mutex.RUnlock()
-			continue
 		}
+	}
+	h.Mutex.RUnlock()
 
-		// Handle private messages with follow validation
-		if msg.Type == "private_message" || msg.Type == "message" {
-			// Validate that at least one user follows the other
-			canChat, err := database.CheckFollowRelationship(hub.DB, msg.From, msg.To)
-			if err != nil {
-				fmt.Println("Error checking follow relationship:", err)
-				continue
-			}
+	for _, client := range clients {
+		client.closeWithReason("session ended")
+	}
+}
 
-			if !canChat {
-				// Send error message back to sender
-				errorMsg := Frontend{
-					Type:      "error",
-					Content:   "You can only message users you follow or who follow you",
-					Timestamp: time.Now(),
-				}
-				hub.Mutex.RLock()
-				if senderClient, ok := hub.Clients[msg.From]; ok {
-					select {
-					case senderClient.Send <- errorMsg:
-					default:
-					}
-				}
-				hub.Mutex.RUnlock()
-				continue
-			}
+// closeExpiredSessions drops connections whose session row was deleted or has
+// expired. Sessions are looked up without holding the lock, once each.
+func (h *Hub) closeExpiredSessions() {
+	h.Mutex.RLock()
+	sessions := make(map[string][]*Client)
+	for _, conns := range h.Clients {
+		for client := range conns {
+			sessions[client.SessionToken] = append(sessions[client.SessionToken], client)
+		}
+	}
+	h.Mutex.RUnlock()
 
-			// Save message to database
-			msg.Timestamp = time.Now()
-			if err := hub.saveMessageToDB(msg); err != nil {
-				fmt.Println("Error saving message:", err)
+	for token, clients := range sessions {
+		active, err := database.IsSessionActive(h.DB, token)
+		if err != nil {
+			fmt.Println("IsSessionActive error:", err)
+			continue
+		}
+		if !active {
+			for _, client := range clients {
+				client.closeWithReason("session expired")
 			}
+		}
+	}
+}
 
-			// Send to recipient if online
-			hub.Mutex.RLock()
-			if toClient, ok := hub.Clients[msg.To]; ok {
-				toClient.Send <- msg
-			}
-			// Echo back to sender for confirmation
-			if fromClient, ok := hub.Clients[msg.From]; ok {
-				fromClient.Send <- msg
+// handleFrame dispatches a frame received from c to the handler of its type
+// in clientFrames and answers with an error frame when it is refused.
+func (h *Hub) handleFrame(c *Client, data []byte) {
+	typ, id, payload, err := decodeFrame(c.Version, data)
+	if err == nil {
+		if f, ok := clientHandlers[typ]; ok {
+			var answer Payload
+			if answer, err = f.handle(h, c, payload); answer != nil {
+				h.reply(c, id, answer)
 			}
-			hub.Mutex.RUnlock()
-			continue
+		} else {
+			err = &Error{Code: "unknown_type", Content: fmt.Sprintf("Unknown frame type %q", typ)}
 		}
+	}
+	if err == nil {
+		return
+	}
 
-		msg.Timestamp = time.Now()
-		hub.Broadcast <- msg
+	var refused *Error
+	if !errors.As(err, &refused) {
+		refused = &Error{Code: "bad_frame", Content: "Invalid frame"}
 	}
+	h.reply(c, id, *refused)
 }
 
-func (c *Client) writePump() {
-	for msg := range c.Send {
-		data, _ := json.Marshal(msg)
-		c.Conn.WriteMessage(websocket.TextMessage, data)
+// saveMessageToDB stores a private message and returns its id. When the
+// sender already sent a message with msg.ClientID, nothing is stored and
+// duplicate is set, with the id of that message.
+func (h *Hub) saveMessageToDB(msg PrivateMessage) (id int, duplicate bool, err error) {
+	query := `
+		INSERT INTO messages (sender_id, receiver_id, content, created_at, client_id)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`
+	res, err := h.DB.Exec(query, msg.From, msg.To, msg.Content, msg.Timestamp, nullString(msg.ClientID))
+	if err != nil {
+		return 0, false, err
 	}
+	return h.insertedMessageID(res, "messages", msg.From, msg.ClientID)
 }
 
-func (h *Hub) saveMessageToDB(msg Frontend) error {
-	query := `INSERT INTO messages (sender_id, receiver_id, content, created_at) VALUES (?, ?, ?, ?)`
-	_, err := h.DB.Exec(query, msg.From, msg.To, msg.Content, msg.Timestamp)
-	return err
+// sentMessageID returns the id of the message of table ("messages" or
+// "group_messages") senderID sent with clientID, or 0.
+func (h *Hub) sentMessageID(table string, senderID int, clientID string) (int, error) {
+	if clientID == "" {
+		return 0, nil
+	}
+	var id int
+	err := h.DB.QueryRow(`SELECT id FROM `+table+` WHERE sender_id = ? AND client_id = ?`, senderID, clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// insertedMessageID returns the id of the message an INSERT ... ON CONFLICT
+// DO NOTHING stored, or of the one with the same client id that made it
+// store nothing.
+func (h *Hub) insertedMessageID(res sql.Result, table string, senderID int, clientID string) (id int, duplicate bool, err error) {
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+	if inserted == 0 {
+		id, err = h.sentMessageID(table, senderID, clientID)
+		return id, true, err
+	}
+	lastID, err := res.LastInsertId()
+	return int(lastID), false, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
 
 // getGroupMemberIDs returns all accepted member user_ids for a group.
@@ -364,7 +580,14 @@ func (h *Hub) getGroupMemberIDs(groupID int) ([]int, error) {
 	return ids, rows.Err()
 }
 
-func (h *Hub) saveGroupMessageToDB(msg Frontend) error {
+// errNotGroupMember refuses a group message from someone who is not an
+// accepted member.
+var errNotGroupMember = errors.New("not an accepted member of the group")
+
+// saveGroupMessageToDB stores a group message from an accepted member and
+// returns its id, or that of the message already sent with msg.ClientID as
+// saveMessageToDB does.
+func (h *Hub) saveGroupMessageToDB(msg GroupMessage) (id int, duplicate bool, err error) {
 	// 1) Verify sender is an accepted member of the group
 	var allowed int
 	checkQ := `
@@ -373,17 +596,21 @@ func (h *Hub) saveGroupMessageToDB(msg Frontend) error {
         WHERE group_id = ? AND user_id = ? AND status = 'accepted'
     `
 	if err := h.DB.QueryRow(checkQ, msg.GroupID, msg.From).Scan(&allowed); err != nil {
-		return fmt.Errorf("membership check failed: %w", err)
+		return 0, false, fmt.Errorf("membership check failed: %w", err)
 	}
 	if allowed == 0 {
-		return fmt.Errorf("user %d is not an accepted member of group %d", msg.From, msg.GroupID)
+		return 0, false, errNotGroupMember
 	}
 
 	// 2) Insert the message
 	const q = `
-        INSERT INTO group_messages (group_id, sender_id, content, created_at)
-        VALUES (?, ?, ?, ?)
+        INSERT INTO group_messages (group_id, sender_id, content, created_at, client_id)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT DO NOTHING
     `
-	_, err := h.DB.Exec(q, msg.GroupID, msg.From, msg.Content, msg.Timestamp)
-	return err
+	res, err := h.DB.Exec(q, msg.GroupID, msg.From, msg.Content, msg.Timestamp, nullString(msg.ClientID))
+	if err != nil {
+		return 0, false, err
+	}
+	return h.insertedMessageID(res, "group_messages", msg.From, msg.ClientID)
 }
@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	cor "socialnetwork/pkg/apis"
+	database "socialnetwork/pkg/db"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write may take before the connection
+	// is considered dead.
+	writeWait = 10 * time.Second
+	// pongWait is how long the client may stay silent: it must answer our
+	// pings (browsers do so automatically) within that time.
+	pongWait = 60 * time.Second
+	// pingPeriod is how often connections are pinged; it must be shorter
+	// than pongWait.
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize is the largest frame a client may send.
+	maxMessageSize = 16 << 10
+	// sendBufferSize is the number of frames queued per connection before
+	// the slow consumer policy applies.
+	sendBufferSize = 64
+)
+
+// upgrader only accepts connections from trusted origins, or from clients
+// that send no Origin at all (scripts), so other sites cannot open a socket
+// with the user's cookie.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || cor.IsTrustedOrigin(r, origin)
+	},
+	Subprotocols: subprotocols,
+}
+
+// Client is one WebSocket connection. Only its writePump writes to Conn
+// (apart from close frames, which gorilla/websocket allows concurrently);
+// everything else queues encoded frames on Send.
+type Client struct {
+	UserID       int
+	Username     string
+	SessionToken string
+	Conn         *websocket.Conn
+	Send         chan []byte
+	// Version is the protocol version negotiated for the connection
+	Version int
+
+	// resumeStream and resumeSeq are where the client's previous
+	// connection stopped (?stream=&since=), if any
+	resumeStream string
+	resumeSeq    int64
+	// replay is written before anything queued on Send, once the hub
+	// closes registered
+	replay     [][]byte
+	registered chan struct{}
+
+	kick sync.Once
+}
+
+// ServeWs upgrades an already authenticated request to a WebSocket connection.
+// The caller is responsible for resolving userID from the session cookie; the
+// session token is kept on the client so the connection can be closed when the
+// session is deleted or expires. A reconnecting client passes the stream and
+// the last sequence number it saw as ?stream=&since= to get what it missed.
+// The protocol version is negotiated with Sec-WebSocket-Protocol.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, userID int, sessionToken string) {
+	if userID <= 0 || sessionToken == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	username, err := database.GetUsernameUsingID(hub.DB, userID)
+	if err != nil || username == "" {
+		fmt.Printf("[WebSocket] Unknown user %d: %v\n", userID, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !supportsRequestedVersion(r) {
+		http.Error(w, "Unsupported protocol version", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("[WebSocket] Upgrade Error: %v\n", err)
+		return
+	}
+
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	client := &Client{
+		UserID:       userID,
+		Username:     username,
+		SessionToken: sessionToken,
+		Conn:         conn,
+		Send:         make(chan []byte, sendBufferSize),
+		Version:      connVersion(conn),
+		registered:   make(chan struct{}),
+		resumeStream: r.URL.Query().Get("stream"),
+		resumeSeq:    since,
+	}
+	hub.Online <- client
+
+	go client.writePump()
+	go client.readPump(hub)
+}
+
+// closeWithReason sends a close frame and closes the underlying connection,
+// which makes readPump exit and unregister the client.
+func (c *Client) closeWithReason(reason string) {
+	deadline := time.Now().Add(time.Second)
+	_ = c.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), deadline)
+	_ = c.Conn.Close()
+}
+
+// disconnectSlow closes a connection that does not keep up with its frames,
+// once. No close frame is sent: the write pump is stuck behind the frames the
+// client does not read. The client reconnects and reloads what it missed.
+func (c *Client) disconnectSlow() {
+	c.kick.Do(func() {
+		fmt.Printf("[WebSocket] Disconnecting slow consumer (user %d)\n", c.UserID)
+		c.Conn.Close()
+	})
+}
+
+// readPump reads frames from the client until the connection fails, the
+// client stops answering pings or sends a frame over maxMessageSize.
+func (c *Client) readPump(hub *Hub) {
+	defer func() {
+		hub.Offline <- c
+		c.Conn.Close()
+	}()
+
+	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		hub.handleFrame(c, data)
+	}
+}
+
+// writePump writes the replay, then the queued frames and pings to the
+// connection. It is the only writer of c.Conn and returns when Send is closed
+// or a write fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	<-c.registered
+	for _, data := range c.replay {
+		c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+	c.replay = nil
+
+	for {
+		select {
+		case data, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub unregistered the client
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
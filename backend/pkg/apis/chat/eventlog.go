@@ -0,0 +1,177 @@
+package chat
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// eventLogSize is how many events are kept per user for replay.
+	eventLogSize = 256
+	// eventLogRetention is how long the events of a user with no open
+	// connection are kept (and new ones recorded). A client reconnecting
+	// later has to resync.
+	eventLogRetention = 10 * time.Minute
+)
+
+// ephemeralTypes are frames that mean nothing once missed: they carry no
+// sequence number and are never replayed.
+var ephemeralTypes = map[string]bool{
+	"typing": true,
+	"error":  true,
+}
+
+// eventLog numbers the events delivered to each user (the frames' seq) and keeps
+// the latest ones, so a client that reconnects can ask for what it missed.
+// Sequence numbers belong to a stream, which starts with the process: after a
+// restart every client resyncs.
+type eventLog struct {
+	mu     sync.Mutex
+	stream string
+	users  map[int]*userEvents
+	// floor is where the numbering of users who connect starts: past every
+	// number handed out to the users forgotten so far, so a client resuming
+	// from one of those must resync
+	floor int64
+}
+
+type userEvents struct {
+	// last is the sequence number of the latest event, dropped the latest
+	// one no longer available for replay
+	last, dropped int64
+	events        []*frame // oldest first
+	connections   int
+	leftAt        time.Time // when the last connection closed
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{
+		stream: strconv.FormatInt(time.Now().UnixNano(), 36),
+		users:  make(map[int]*userEvents),
+	}
+}
+
+// connect records a new connection of userID.
+func (l *eventLog) connect(userID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.users[userID]
+	if e == nil {
+		e = &userEvents{last: l.floor, dropped: l.floor}
+		l.users[userID] = e
+	}
+	e.connections++
+}
+
+// disconnect records that a connection of userID closed.
+func (l *eventLog) disconnect(userID int, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e := l.users[userID]; e != nil && e.connections > 0 {
+		e.connections--
+		if e.connections == 0 {
+			e.leftAt = now
+		}
+	}
+}
+
+// deliver numbers msg as the next event of userID, records it and passes the
+// frame to send, all under the log's lock so frames are queued in sequence
+// order. Users the log does not follow (never connected, or gone for longer
+// than eventLogRetention) get nothing.
+func (l *eventLog) deliver(userID int, msg *outgoing, send func(*frame)) {
+	if ephemeralTypes[msg.typ] {
+		send(msg.frame("", 0))
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.users[userID]
+	if e == nil {
+		return
+	}
+	e.last++
+	f := msg.frame("", e.last)
+	if len(e.events) == eventLogSize {
+		e.dropped = e.events[0].seq
+		e.events = append(e.events[1:], f)
+	} else {
+		e.events = append(e.events, f)
+	}
+	send(f)
+}
+
+// since returns the events of userID after seq, oldest first, and the
+// latest sequence number. ok is false when some of them are no longer
+// available, or seq is unknown, and the client must resync. Users the log
+// does not follow always have to.
+func (l *eventLog) since(userID int, seq int64) (frames []*frame, last int64, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.users[userID]
+	if e == nil {
+		return nil, l.floor, false
+	}
+	if seq < e.dropped || seq > e.last {
+		return nil, e.last, false
+	}
+	for _, f := range e.events {
+		if f.seq > seq {
+			frames = append(frames, f)
+		}
+	}
+	return frames, e.last, true
+}
+
+// latest returns the latest sequence number of userID.
+func (l *eventLog) latest(userID int) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e := l.users[userID]; e != nil {
+		return e.last
+	}
+	return l.floor
+}
+
+// recipients returns the users whose events are recorded: those online and
+// those gone for less than eventLogRetention.
+func (l *eventLog) recipients() []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := make([]int, 0, len(l.users))
+	for id := range l.users {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// lose marks the events of every user so far as no longer available, when
+// some of them may have been missed: clients resuming from before must
+// resync.
+func (l *eventLog) lose() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.users {
+		e.events = nil
+		e.last++
+		e.dropped = e.last
+	}
+}
+
+// expire forgets the users offline for longer than eventLogRetention. The
+// floor is raised past the numbers they were given, and one more to stand
+// for the events they miss from then on, so a client resuming from before
+// it must resync.
+func (l *eventLog) expire(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, e := range l.users {
+		if e.connections > 0 || now.Sub(e.leftAt) < eventLogRetention {
+			continue
+		}
+		l.floor = max(l.floor, e.last+1)
+		delete(l.users, id)
+	}
+}
@@ -0,0 +1,214 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	database "socialnetwork/pkg/db"
+)
+
+// The handlers of the frames clients send, registered in clientFrames. The
+// payload they answer with, or an *Error they return, is sent back to the
+// connection.
+
+func (h *Hub) getOnlineUsers(c *Client, _ GetOnlineUsers) (Payload, error) {
+	h.sendOnlineUsers(c)
+	return nil, nil
+}
+
+// markRead marks the conversation with p.To read and tells the other party
+// (and the reader's other tabs) with a message_read frame.
+func (h *Hub) markRead(c *Client, p MarkRead) (Payload, error) {
+	if p.To <= 0 || p.To == c.UserID {
+		return nil, nil
+	}
+	readAt := time.Now()
+	updated, err := database.MarkConversationRead(h.DB, c.UserID, p.To, readAt)
+	if err != nil {
+		fmt.Println("Error marking messages read:", err)
+		return nil, nil
+	}
+	if updated == 0 {
+		return nil, nil
+	}
+	h.SendToUsers([]int{p.To, c.UserID}, MessageRead{
+		From:     c.UserID,
+		To:       p.To,
+		Username: c.Username,
+		ReadAt:   readAt,
+	})
+	return nil, nil
+}
+
+// sendTyping relays a typing indicator to p.To, if the user could send them
+// a message. Other indicators are dropped silently: they are not worth an
+// answer.
+func (h *Hub) sendTyping(c *Client, p SendTyping) (Payload, error) {
+	if p.To <= 0 || p.To == c.UserID || h.checkCanWrite(c) != nil {
+		return nil, nil
+	}
+	canChat, err := database.CheckFollowRelationship(h.DB, c.UserID, p.To)
+	if err != nil {
+		fmt.Println("Error checking follow relationship:", err)
+		return nil, nil
+	}
+	if !canChat {
+		return nil, nil
+	}
+	h.SendToUser(p.To, Typing{From: c.UserID, To: p.To, Username: c.Username})
+	return nil, nil
+}
+
+// sendPrivateMessage stores a message between users of whom at least one
+// follows the other and sends it to both. The sender is answered with an ack
+// carrying the stored id, or a nack.
+func (h *Hub) sendPrivateMessage(c *Client, p SendPrivateMessage) (Payload, error) {
+	if err := h.checkCanWrite(c); err != nil {
+		return nack(p.ClientID, err)
+	}
+	if strings.TrimSpace(p.Content) == "" || p.To <= 0 {
+		return nack(p.ClientID, &Error{Code: "bad_frame", Content: ErrEmptyMessage.Error()})
+	}
+	if len(p.ClientID) > maxClientIDLength {
+		return nack(p.ClientID, &Error{Code: "bad_frame", Content: "client_id is too long"})
+	}
+
+	// A retry of a message that was stored already is only acknowledged
+	if id, err := h.sentMessageID("messages", c.UserID, p.ClientID); err != nil {
+		fmt.Println("Error looking up message:", err)
+		return nack(p.ClientID, errSendFailed)
+	} else if id != 0 {
+		return Ack{ClientID: p.ClientID, MessageID: id, Duplicate: true}, nil
+	}
+
+	canChat, err := database.CheckFollowRelationship(h.DB, c.UserID, p.To)
+	if err != nil {
+		fmt.Println("Error checking follow relationship:", err)
+		return nack(p.ClientID, errSendFailed)
+	}
+	if !canChat {
+		return nack(p.ClientID, &Error{Code: "not_allowed", Content: "You can only message users you follow or who follow you"})
+	}
+
+	msg := PrivateMessage{
+		From:      c.UserID,
+		To:        p.To,
+		Username:  c.Username,
+		Content:   p.Content,
+		Timestamp: time.Now(),
+		ClientID:  p.ClientID,
+	}
+	id, duplicate, err := h.saveMessageToDB(msg)
+	if err != nil {
+		fmt.Println("Error saving message:", err)
+		return nack(p.ClientID, errSendFailed)
+	}
+	if !duplicate {
+		msg.MessageID = id
+		// The sender's other connections get it too
+		h.SendToUsers([]int{p.To, c.UserID}, msg)
+	}
+	return Ack{ClientID: p.ClientID, MessageID: id, Duplicate: duplicate}, nil
+}
+
+// sendGroupMessage stores a message from an accepted member and sends it to
+// every member, the sender included. The sender is answered with an ack or
+// a nack as for private messages.
+func (h *Hub) sendGroupMessage(c *Client, p SendGroupMessage) (Payload, error) {
+	if err := h.checkCanWrite(c); err != nil {
+		return nack(p.ClientID, err)
+	}
+	if strings.TrimSpace(p.Content) == "" || p.GroupID <= 0 {
+		return nack(p.ClientID, &Error{Code: "bad_frame", Content: ErrEmptyMessage.Error()})
+	}
+	if len(p.ClientID) > maxClientIDLength {
+		return nack(p.ClientID, &Error{Code: "bad_frame", Content: "client_id is too long"})
+	}
+
+	if id, err := h.sentMessageID("group_messages", c.UserID, p.ClientID); err != nil {
+		fmt.Println("Error looking up group message:", err)
+		return nack(p.ClientID, errSendFailed)
+	} else if id != 0 {
+		return Ack{ClientID: p.ClientID, MessageID: id, Duplicate: true}, nil
+	}
+
+	msg := GroupMessage{
+		GroupID:   p.GroupID,
+		From:      c.UserID,
+		Username:  c.Username,
+		Content:   p.Content,
+		Timestamp: time.Now(),
+		ClientID:  p.ClientID,
+	}
+	id, duplicate, err := h.saveGroupMessageToDB(msg)
+	if errors.Is(err, errNotGroupMember) {
+		return nack(p.ClientID, &Error{Code: "not_allowed", Content: "You are not a member of this group"})
+	}
+	if err != nil {
+		fmt.Println("saveGroupMessageToDB error:", err)
+		return nack(p.ClientID, errSendFailed)
+	}
+	if !duplicate {
+		msg.MessageID = id
+		h.SendToGroup(p.GroupID, msg)
+	}
+	return Ack{ClientID: p.ClientID, MessageID: id, Duplicate: duplicate}, nil
+}
+
+func (h *Hub) editMessage(c *Client, p EditMessageRequest) (Payload, error) {
+	if err := h.checkCanWrite(c); err != nil {
+		return nil, err
+	}
+	if _, err := h.EditMessage(c.UserID, p.MessageID, p.GroupID, p.Content); err != nil {
+		return nil, messageUpdateError(p.MessageID, err)
+	}
+	return nil, nil
+}
+
+func (h *Hub) deleteMessage(c *Client, p DeleteMessageRequest) (Payload, error) {
+	if err := h.checkCanWrite(c); err != nil {
+		return nil, err
+	}
+	if _, err := h.DeleteMessage(c.UserID, p.MessageID, p.GroupID); err != nil {
+		return nil, messageUpdateError(p.MessageID, err)
+	}
+	return nil, nil
+}
+
+// messageUpdateError refuses an edit or delete of messageID. The reasons
+// meant for the user are passed on; other errors are only logged.
+func messageUpdateError(messageID int, err error) *Error {
+	for _, reason := range []error{ErrMessageNotFound, ErrNotMessageOwner, ErrEditWindowExpired, ErrMessageDeleted, ErrEmptyMessage} {
+		if errors.Is(err, reason) {
+			return &Error{Code: "rejected", Content: reason.Error(), MessageID: messageID}
+		}
+	}
+	fmt.Println("Error updating message:", err)
+	return &Error{Code: "failed", Content: "Could not update message", MessageID: messageID}
+}
+
+// maxClientIDLength bounds the client_id of chat messages.
+const maxClientIDLength = 64
+
+// errSendFailed refuses a message that could not be stored.
+var errSendFailed = &Error{Code: "failed", Content: "The message could not be sent, please try again"}
+
+// nack answers a refused send, err being an *Error.
+func nack(clientID string, err error) (Payload, error) {
+	var refused *Error
+	if !errors.As(err, &refused) {
+		return nil, err
+	}
+	return Nack{ClientID: clientID, Code: refused.Code, Reason: refused.Content}, nil
+}
+
+// checkCanWrite refuses frames that send or change something from users
+// h.CanWrite rejects.
+func (h *Hub) checkCanWrite(c *Client) error {
+	if h.CanWrite != nil && !h.CanWrite(c.UserID) {
+		return &Error{Code: "unverified", Content: "Please verify your email address before sending messages"}
+	}
+	return nil
+}
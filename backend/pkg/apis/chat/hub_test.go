@@ -0,0 +1,605 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"socialnetwork/pkg/db/sqlite"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub starts a hub on a migrated database with users 1..users, where
+// users 1 and 2 follow each other, and a server upgrading /ws?user=N.
+func newTestHub(t *testing.T, users int) (*Hub, string) {
+	t.Helper()
+	return startTestHub(t, newTestDB(t, users), MemoryBroker{})
+}
+
+func newTestDB(t *testing.T, users int) *sql.DB {
+	t.Helper()
+	migrations, err := filepath.Abs("../../db/migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlite.ConnectAndMigrate(filepath.Join(t.TempDir(), "test.db"), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 1; id <= users; id++ {
+		_, err := tx.Exec(`
+			INSERT INTO users (id, username, firstname, lastname, age, gender, email, password)
+			VALUES (?, ?, 'F', 'L', '20', 'other', ?, 'x')`,
+			id, fmt.Sprintf("user%d", id), fmt.Sprintf("user%d@example.com", id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO userFollow (follower_id, following_id) VALUES (1, 2), (2, 1)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// startTestHub starts a hub on db with broker, and a server upgrading
+// /ws?user=N.
+func startTestHub(t *testing.T, db *sql.DB, broker Broker) (*Hub, string) {
+	t.Helper()
+	hub := NewHub(db)
+	hub.Broker = broker
+	go hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		ServeWs(hub, w, r, userID, "session"+strconv.Itoa(userID))
+	}))
+	t.Cleanup(srv.Close)
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// dial connects userID with protocol version 2.
+func dial(t testing.TB, url string, userID int) *websocket.Conn {
+	t.Helper()
+	conn, _, err := dialProtocols(url, userID, "socialnetwork.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func dialProtocols(url string, userID int, protocols ...string) (*websocket.Conn, *http.Response, error) {
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = protocols
+	return dialer.Dial(url+sep+"user="+strconv.Itoa(userID), nil)
+}
+
+// testFrame is a version 2 frame, with the payload fields the tests look at.
+type testFrame struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Seq     int64  `json:"seq"`
+	Payload struct {
+		From      int    `json:"from"`
+		Content   string `json:"content"`
+		MessageID int    `json:"message_id"`
+		ClientID  string `json:"client_id"`
+		Duplicate bool   `json:"duplicate"`
+		Code      string `json:"code"`
+		Stream    string `json:"stream"`
+		Seq       int64  `json:"seq"`
+	} `json:"payload"`
+}
+
+// readType reads frames until one of the given type arrives.
+func readType(t *testing.T, conn *websocket.Conn, frameType string, timeout time.Duration) testFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", frameType, err)
+		}
+		var msg testFrame
+		if json.Unmarshal(data, &msg) == nil && msg.Type == frameType {
+			return msg
+		}
+	}
+}
+
+// send writes p in a version 2 envelope.
+func send(t *testing.T, conn *websocket.Conn, id string, p Payload) {
+	t.Helper()
+	payload, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(envelope{V: ProtocolV2, Type: p.FrameType(), ID: id, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func connectionCount(h *Hub) int {
+	h.Mutex.RLock()
+	defer h.Mutex.RUnlock()
+	n := 0
+	for _, conns := range h.Clients {
+		n += len(conns)
+	}
+	return n
+}
+
+func TestHubStaysResponsiveWithIdleConnections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("opens thousands of connections")
+	}
+	const users, tabs = 500, 4
+	hub, url := newTestHub(t, users)
+
+	// Idle clients never send anything but keep reading, like a browser tab
+	var idle sync.WaitGroup
+	for id := 3; id <= users; id++ {
+		for i := 0; i < tabs; i++ {
+			conn := dial(t, url, id)
+			t.Cleanup(func() { conn.Close() })
+			idle.Add(1)
+			go func() {
+				defer idle.Done()
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}
+	alice, bob := dial(t, url, 1), dial(t, url, 2)
+	defer alice.Close()
+	defer bob.Close()
+	want := (users-2)*tabs + 2
+	waitFor(t, "all connections", func() bool { return connectionCount(hub) == want })
+
+	start := time.Now()
+	send(t, alice, "", SendPrivateMessage{To: 2, Content: "hi"})
+	msg := readType(t, bob, "private_message", 2*time.Second)
+	if msg.Payload.From != 1 || msg.Payload.Content != "hi" || msg.Payload.MessageID == 0 {
+		t.Errorf("got %+v", msg)
+	}
+	readType(t, alice, "private_message", 2*time.Second)
+	t.Logf("message delivered in %v with %d connections", time.Since(start), want)
+
+	// A broadcast reaches everyone without stalling the hub
+	start = time.Now()
+	hub.BroadcastToAll(NewPost{Content: "post"})
+	readType(t, bob, "new_post", 2*time.Second)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("broadcast took %v", d)
+	}
+
+	// Presence updates are coalesced and list every user once
+	readType(t, bob, "online_users", 3*time.Second)
+	if n := len(hub.GetOnlineUserIDs()); n != users {
+		t.Errorf("%d users online, want %d", n, users)
+	}
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	hub, url := newTestHub(t, 2)
+
+	// The slow client never reads, the other one does
+	slow := dial(t, url, 1)
+	defer slow.Close()
+	fast := dial(t, url, 2)
+	defer fast.Close()
+	waitFor(t, "connections", func() bool { return connectionCount(hub) == 2 })
+
+	received := make(chan struct{})
+	go func() {
+		for {
+			_, data, err := fast.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(data), `"type":"new_post"`) {
+				received <- struct{}{}
+			}
+		}
+	}()
+
+	// Send in step with the reading client until the other one falls behind
+	big := NewPost{Content: strings.Repeat("x", 64<<10)}
+	for i := 0; hub.IsOnline(1); i++ {
+		if i == 2000 {
+			t.Fatal("the slow client was never disconnected")
+		}
+		start := time.Now()
+		hub.BroadcastToAll(big)
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Fatalf("sending took %v; a slow client must not block the hub", d)
+		}
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the reading client stopped receiving after %d frames", i)
+		}
+	}
+	if !hub.IsOnline(2) {
+		t.Fatal("the reading client was disconnected too")
+	}
+}
+
+func TestDropPolicyKeepsSlowConsumer(t *testing.T) {
+	hub, url := newTestHub(t, 1)
+	hub.SlowConsumers = DropSlowConsumerFrames
+
+	slow := dial(t, url, 1)
+	defer slow.Close()
+	waitFor(t, "connection", func() bool { return connectionCount(hub) == 1 })
+
+	big := NewPost{Content: strings.Repeat("x", 64<<10)}
+	for i := 0; i < 1000; i++ {
+		hub.BroadcastToAll(big)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !hub.IsOnline(1) {
+		t.Fatal("the slow client was disconnected")
+	}
+}
+
+func TestOversizedFrameClosesConnection(t *testing.T) {
+	hub, url := newTestHub(t, 1)
+	conn := dial(t, url, 1)
+	defer conn.Close()
+	waitFor(t, "connection", func() bool { return hub.IsOnline(1) })
+
+	if err := conn.WriteJSON(map[string]string{"type": "typing", "content": strings.Repeat("x", maxMessageSize)}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the connection to close", func() bool { return !hub.IsOnline(1) })
+}
+
+// resumeURL is url for a client resuming after seq of stream.
+func resumeURL(url, stream string, seq int64) string {
+	return fmt.Sprintf("%s?stream=%s&since=%d", url, stream, seq)
+}
+
+func TestReconnectReplaysMissedEvents(t *testing.T) {
+	hub, url := newTestHub(t, 2)
+	conn := dial(t, url, 1)
+	hello := readType(t, conn, "hello", time.Second)
+	if hello.Payload.Stream == "" || hello.Payload.Seq != 0 {
+		t.Fatalf("got %+v", hello)
+	}
+
+	hub.SendToUser(1, NewFollower{Notice{Content: "a"}})
+	if msg := readType(t, conn, "new_follower", time.Second); msg.Seq != 1 {
+		t.Fatalf("first event has seq %d", msg.Seq)
+	}
+	conn.Close()
+	waitFor(t, "disconnect", func() bool { return !hub.IsOnline(1) })
+
+	// Missed while offline: a direct event, a broadcast and an ephemeral frame
+	hub.SendToUser(1, GroupInvitation{Notice: Notice{Content: "b"}})
+	hub.SendToUser(1, Typing{From: 2})
+	hub.BroadcastToAll(NewPost{Content: "c"})
+
+	conn = dial(t, resumeURL(url, hello.Payload.Stream, 1), 1)
+	defer conn.Close()
+	if msg := readType(t, conn, "hello", time.Second); msg.Payload.Seq != 1 {
+		t.Fatalf("resumed at %d, want 1", msg.Payload.Seq)
+	}
+	if msg := readType(t, conn, "group_invitation", time.Second); msg.Seq != 2 || msg.Payload.Content != "b" {
+		t.Errorf("got %+v", msg)
+	}
+	if msg := readType(t, conn, "new_post", time.Second); msg.Seq != 3 || msg.Payload.Content != "c" {
+		t.Errorf("got %+v", msg)
+	}
+
+	// Live events carry on from there
+	hub.SendToUser(1, NewFollower{})
+	if msg := readType(t, conn, "new_follower", time.Second); msg.Seq != 4 {
+		t.Errorf("live event has seq %d, want 4", msg.Seq)
+	}
+}
+
+func TestReconnectResyncsWhenEventsAreGone(t *testing.T) {
+	hub, url := newTestHub(t, 1)
+	conn := dial(t, url, 1)
+	stream := readType(t, conn, "hello", time.Second).Payload.Stream
+	conn.Close()
+	waitFor(t, "disconnect", func() bool { return !hub.IsOnline(1) })
+
+	resync := func(name, url string) {
+		t.Helper()
+		conn := dial(t, url, 1)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var msg testFrame
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "resync" || msg.Payload.Stream != stream {
+			t.Errorf("%s: got %+v, want a resync", name, msg)
+		}
+		conn.Close()
+		waitFor(t, "disconnect", func() bool { return !hub.IsOnline(1) })
+	}
+
+	resync("unknown stream", resumeURL(url, "other", 0))
+	resync("future seq", resumeURL(url, stream, 5))
+
+	// More events than the log keeps
+	for i := 0; i < eventLogSize+1; i++ {
+		hub.SendToUser(1, NewFollower{})
+	}
+	resync("overflowed log", resumeURL(url, stream, 0))
+
+	// Offline for longer than the retention
+	last := hub.events.latest(1)
+	hub.events.expire(time.Now().Add(eventLogRetention))
+	hub.events.mu.Lock()
+	_, kept := hub.events.users[1]
+	hub.events.mu.Unlock()
+	if kept {
+		t.Error("the expired user is still in the log")
+	}
+	hub.SendToUser(1, NewFollower{})
+	resync("expired log", resumeURL(url, stream, last))
+	resync("expired log, seq 0", resumeURL(url, stream, 0))
+}
+
+func TestInvalidFramesAreAnsweredWithErrors(t *testing.T) {
+	hub, url := newTestHub(t, 1)
+	conn := dial(t, url, 1)
+	defer conn.Close()
+	readType(t, conn, "hello", time.Second)
+
+	for _, tc := range []struct {
+		name, frame, code string
+	}{
+		{"unknown type", `{"v":2,"type":"new_post","id":"1","payload":{}}`, "unknown_type"},
+		{"bad payload", `{"v":2,"type":"private_message","id":"2","payload":{"to":"bob"}}`, "bad_frame"},
+		{"wrong version", `{"v":3,"type":"typing","id":"3","payload":{"to":1}}`, "unsupported_version"},
+	} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tc.frame)); err != nil {
+			t.Fatal(err)
+		}
+		msg := readType(t, conn, "error", time.Second)
+		if msg.Payload.Code != tc.code || msg.ID == "" || msg.Seq != 0 {
+			t.Errorf("%s: got %+v, want a %s error", tc.name, msg, tc.code)
+		}
+	}
+	if !hub.IsOnline(1) {
+		t.Error("an invalid frame closed the connection")
+	}
+}
+
+func TestMessageUpdateErrorsHideInternalErrors(t *testing.T) {
+	if e := messageUpdateError(7, fmt.Errorf("edit: %w", ErrEditWindowExpired)); e.Code != "rejected" || e.Content != ErrEditWindowExpired.Error() || e.MessageID != 7 {
+		t.Errorf("got %+v", e)
+	}
+	if e := messageUpdateError(7, errors.New("sqlite: database is locked")); e.Code != "failed" || strings.Contains(e.Content, "sqlite") {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestMessageUpdateHandler(t *testing.T) {
+	hub, _ := newTestHub(t, 2)
+	if _, err := hub.DB.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (1, 1, 2, 'hi')`); err != nil {
+		t.Fatal(err)
+	}
+	session := func(r *http.Request) (int, bool) {
+		id, _ := strconv.Atoi(r.Header.Get("X-User"))
+		return id, id > 0
+	}
+
+	for _, tc := range []struct {
+		name          string
+		user          string
+		group, remove bool
+		body          string
+		code          int
+	}{
+		{"logged out", "", false, false, `{"message_id": 1, "content": "x"}`, http.StatusUnauthorized},
+		{"not the sender", "2", false, false, `{"message_id": 1, "content": "x"}`, http.StatusForbidden},
+		{"empty edit", "1", false, false, `{"message_id": 1, "content": " "}`, http.StatusBadRequest},
+		{"edit", "1", false, false, `{"message_id": 1, "content": "changed"}`, http.StatusOK},
+		{"group without group_id", "1", true, true, `{"message_id": 1}`, http.StatusBadRequest},
+		{"unknown message", "1", false, true, `{"message_id": 9}`, http.StatusNotFound},
+		{"delete", "1", false, true, `{"message_id": 1}`, http.StatusOK},
+		{"delete again", "1", false, true, `{"message_id": 1}`, http.StatusConflict},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/messages/edit", strings.NewReader(tc.body))
+		req.Header.Set("X-User", tc.user)
+		rec := httptest.NewRecorder()
+		hub.MessageUpdateHandler(session, tc.group, tc.remove)(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s: status %d, want %d (%s)", tc.name, rec.Code, tc.code, rec.Body)
+		}
+	}
+
+	var edited, deleted bool
+	err := hub.DB.QueryRow(`SELECT edited_at IS NOT NULL, deleted_at IS NOT NULL FROM messages WHERE id = 1`).Scan(&edited, &deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !edited || !deleted {
+		t.Errorf("edited %v, deleted %v; want both", edited, deleted)
+	}
+}
+
+func TestChatSendsAreAcknowledgedOnce(t *testing.T) {
+	hub, url := newTestHub(t, 3)
+	alice := dial(t, url, 1)
+	defer alice.Close()
+	bob := dial(t, url, 2)
+	defer bob.Close()
+	readType(t, alice, "hello", time.Second)
+	readType(t, bob, "hello", time.Second)
+
+	send(t, alice, "f1", SendPrivateMessage{To: 2, Content: "hi", ClientID: "c1"})
+	ack := readType(t, alice, "ack", time.Second)
+	if ack.ID != "f1" || ack.Payload.ClientID != "c1" || ack.Payload.MessageID == 0 || ack.Payload.Duplicate {
+		t.Fatalf("got %+v", ack)
+	}
+	if msg := readType(t, bob, "private_message", time.Second); msg.Payload.MessageID != ack.Payload.MessageID || msg.Payload.ClientID != "c1" {
+		t.Errorf("bob got %+v", msg)
+	}
+
+	// A retry is acknowledged with the stored message, not stored again
+	send(t, alice, "f2", SendPrivateMessage{To: 2, Content: "hi", ClientID: "c1"})
+	retry := readType(t, alice, "ack", time.Second)
+	if retry.ID != "f2" || retry.Payload.MessageID != ack.Payload.MessageID || !retry.Payload.Duplicate {
+		t.Errorf("retry got %+v", retry)
+	}
+	var count int
+	if err := hub.DB.QueryRow(`SELECT COUNT(*) FROM messages WHERE sender_id = 1`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d messages stored, want 1", count)
+	}
+
+	// Nobody follows user 3
+	send(t, alice, "f3", SendPrivateMessage{To: 3, Content: "hi", ClientID: "c2"})
+	nack := readType(t, alice, "nack", time.Second)
+	if nack.ID != "f3" || nack.Payload.ClientID != "c2" || nack.Payload.Code != "not_allowed" {
+		t.Errorf("got %+v", nack)
+	}
+
+	// Client ids are per sender
+	send(t, bob, "f4", SendPrivateMessage{To: 1, Content: "hello", ClientID: "c1"})
+	if ack := readType(t, bob, "ack", time.Second); ack.Payload.Duplicate || ack.Payload.MessageID == retry.Payload.MessageID {
+		t.Errorf("bob got %+v", ack)
+	}
+}
+
+func TestTypingOnlyReachesChatPartners(t *testing.T) {
+	_, url := newTestHub(t, 3)
+	alice := dial(t, url, 1)
+	defer alice.Close()
+	readType(t, alice, "hello", time.Second)
+	bob := dial(t, url, 2)
+	defer bob.Close()
+	readType(t, bob, "hello", time.Second)
+	carol := dial(t, url, 3)
+	defer carol.Close()
+	readType(t, carol, "hello", time.Second)
+
+	// Nobody follows user 3, so alice may not message carol
+	send(t, alice, "", SendTyping{To: 3})
+	send(t, alice, "", SendTyping{To: 2})
+	if msg := readType(t, bob, "typing", time.Second); msg.Payload.From != 1 {
+		t.Errorf("bob got %+v", msg)
+	}
+	// alice's frames are handled in order, so anything for carol was queued
+	// before bob got his, and would come before her online users
+	send(t, carol, "", GetOnlineUsers{})
+	carol.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var msg testFrame
+		if err := carol.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type == "typing" {
+			t.Fatalf("carol got %+v", msg)
+		}
+		if msg.Type == "online_users" {
+			break
+		}
+	}
+}
+
+func TestVersion1FramesAreFlat(t *testing.T) {
+	_, url := newTestHub(t, 2)
+	alice, _, err := dialProtocols(url, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	bob := dial(t, url, 2)
+	defer bob.Close()
+	readType(t, bob, "hello", time.Second)
+
+	if err := alice.WriteJSON(map[string]any{"type": "private_message", "to": 2, "content": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readType(t, bob, "private_message", time.Second); msg.Payload.Content != "hi" {
+		t.Errorf("version 2 client got %+v", msg)
+	}
+
+	// The version 1 client gets the payload's fields next to the type
+	alice.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var msg map[string]any
+		if err := alice.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg["type"] != "private_message" {
+			continue
+		}
+		if msg["content"] != "hi" || msg["to"] != float64(2) || msg["seq"] == nil || msg["payload"] != nil {
+			t.Errorf("version 1 client got %v", msg)
+		}
+		break
+	}
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	_, url := newTestHub(t, 1)
+	for _, tc := range []struct {
+		offered []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"socialnetwork.v1"}, "socialnetwork.v1"},
+		{[]string{"socialnetwork.v1", "socialnetwork.v2"}, "socialnetwork.v2"},
+		{[]string{"socialnetwork.v9", "socialnetwork.v1"}, "socialnetwork.v1"},
+	} {
+		conn, _, err := dialProtocols(url, 1, tc.offered...)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.offered, err)
+		}
+		if got := conn.Subprotocol(); got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.offered, got, tc.want)
+		}
+		conn.Close()
+	}
+
+	_, resp, err := dialProtocols(url, 1, "socialnetwork.v9")
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsupported version: got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,192 @@
+package chat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	database "socialnetwork/pkg/db"
+)
+
+// MessageEditWindow is how long after sending a message its author can still edit it.
+const MessageEditWindow = 15 * time.Minute
+
+var (
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrNotMessageOwner   = errors.New("you can only change your own messages")
+	ErrEditWindowExpired = errors.New("this message can no longer be edited")
+	ErrMessageDeleted    = errors.New("this message has been deleted")
+	ErrEmptyMessage      = errors.New("message content cannot be empty")
+)
+
+// EditMessage changes the content of one of userID's messages and notifies the
+// other participant, or every accepted member for a group message, with a
+// "message_edited" frame. groupID > 0 selects a group chat message.
+func (h *Hub) EditMessage(userID, messageID, groupID int, content string) (MessageEdited, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return MessageEdited{}, ErrEmptyMessage
+	}
+
+	info, err := h.ownMessage(userID, messageID, groupID)
+	if err != nil {
+		return MessageEdited{}, err
+	}
+	if time.Since(info.CreatedAt) > MessageEditWindow {
+		return MessageEdited{}, ErrEditWindowExpired
+	}
+
+	editedAt := time.Now()
+	if groupID > 0 {
+		err = database.EditGroupMessage(h.DB, messageID, content, editedAt)
+	} else {
+		err = database.EditMessage(h.DB, messageID, content, editedAt)
+	}
+	if err != nil {
+		return MessageEdited{}, err
+	}
+
+	event := MessageEdited{
+		MessageID: messageID,
+		From:      userID,
+		To:        info.ReceiverID,
+		GroupID:   info.GroupID,
+		Content:   content,
+		Timestamp: info.CreatedAt,
+		EditedAt:  editedAt,
+	}
+	h.deliverMessageUpdate(info, event)
+	return event, nil
+}
+
+// DeleteMessage soft deletes one of userID's messages and notifies the same
+// recipients as EditMessage with a "message_deleted" frame.
+func (h *Hub) DeleteMessage(userID, messageID, groupID int) (MessageDeleted, error) {
+	info, err := h.ownMessage(userID, messageID, groupID)
+	if err != nil {
+		return MessageDeleted{}, err
+	}
+
+	deletedAt := time.Now()
+	if groupID > 0 {
+		err = database.DeleteGroupMessage(h.DB, messageID, deletedAt)
+	} else {
+		err = database.DeleteMessage(h.DB, messageID, deletedAt)
+	}
+	if err != nil {
+		return MessageDeleted{}, err
+	}
+
+	event := MessageDeleted{
+		MessageID: messageID,
+		From:      userID,
+		To:        info.ReceiverID,
+		GroupID:   info.GroupID,
+		Timestamp: info.CreatedAt,
+	}
+	h.deliverMessageUpdate(info, event)
+	return event, nil
+}
+
+// ownMessage loads a message and checks that userID sent it and it is not deleted.
+func (h *Hub) ownMessage(userID, messageID, groupID int) (*database.ChatMessageInfo, error) {
+	var info *database.ChatMessageInfo
+	var err error
+	if groupID > 0 {
+		info, err = database.GetGroupMessageInfo(h.DB, messageID)
+	} else {
+		info, err = database.GetMessageInfo(h.DB, messageID)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if groupID > 0 && info.GroupID != groupID {
+		return nil, ErrMessageNotFound
+	}
+	if info.SenderID != userID {
+		return nil, ErrNotMessageOwner
+	}
+	if info.Deleted {
+		return nil, ErrMessageDeleted
+	}
+	return info, nil
+}
+
+// deliverMessageUpdate sends an edit/delete event to everyone who can see the message.
+func (h *Hub) deliverMessageUpdate(info *database.ChatMessageInfo, event Payload) {
+	if info.GroupID > 0 {
+		h.SendToGroup(info.GroupID, event)
+		return
+	}
+	h.SendToUsers([]int{info.ReceiverID, info.SenderID}, event)
+}
+
+// MessageUpdateHandler returns the handler of POST {"message_id", "content"}
+// editing one of the logged in user's messages, or deleting it if remove is
+// set. Group chat messages (group) also need "group_id". session resolves
+// the user from the request.
+func (h *Hub) MessageUpdateHandler(session func(*http.Request) (int, bool), group, remove bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := session(r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			MessageID int    `json:"message_id"`
+			GroupID   int    `json:"group_id"`
+			Content   string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 || group && req.GroupID <= 0 {
+			http.Error(w, "Bad JSON", http.StatusBadRequest)
+			return
+		}
+		if !group {
+			req.GroupID = 0
+		}
+
+		var event Payload
+		var err error
+		if remove {
+			event, err = h.DeleteMessage(userID, req.MessageID, req.GroupID)
+		} else {
+			event, err = h.EditMessage(userID, req.MessageID, req.GroupID, req.Content)
+		}
+		if err != nil {
+			writeMessageUpdateError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": event})
+	}
+}
+
+// writeMessageUpdateError maps edit/delete errors to HTTP responses.
+func writeMessageUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotMessageOwner), errors.Is(err, ErrEditWindowExpired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrMessageDeleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrEmptyMessage):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		fmt.Println("Error updating message:", err)
+		http.Error(w, "Failed to update message", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,580 @@
+package chat
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The payload types below are the protocol: PROTOCOL.md is generated from
+// them and their comments (go generate ./pkg/apis/chat). Each has its own
+// frame type, returned by FrameType; frames sent by the server are listed in
+// serverFrames, frames sent by clients in clientFrames.
+
+// Notice holds the fields shared by the frames that are also stored as
+// notifications (see the notification package).
+type Notice struct {
+	// Id of the stored notification, when it was stored
+	NotificationID int `json:"notification_id,omitempty"`
+	// User who caused the notification, 0 for the system
+	From int `json:"from"`
+	// Username of From
+	Username string `json:"username,omitempty"`
+	// Text to show
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NoticeFields gives the notification package access to the embedded Notice.
+func (n *Notice) NoticeFields() *Notice { return n }
+
+// Notification is implemented by the payloads embedding Notice.
+type Notification interface {
+	Payload
+	NoticeFields() *Notice
+}
+
+// Connection
+
+// Hello is the first frame on every connection. When the client resumes,
+// the events it missed follow (see Resync).
+type Hello struct {
+	// Stream the sequence numbers belong to; pass it back with ?stream= when reconnecting
+	Stream string `json:"stream"`
+	// Sequence number the client is at; pass the latest one seen back with ?since=
+	Seq int64 `json:"seq"`
+}
+
+func (Hello) FrameType() string { return "hello" }
+
+// Resync replaces Hello when the events a resuming client missed are no
+// longer available: the client must reload everything and continue from Seq.
+type Resync struct {
+	Stream string `json:"stream"`
+	Seq    int64  `json:"seq"`
+}
+
+func (Resync) FrameType() string { return "resync" }
+
+// OnlineUsers lists the users with an open connection. It is sent on
+// connect, on request and at most once a second while it changes.
+type OnlineUsers struct {
+	// Sorted by id
+	Users     []OnlineUser `json:"users"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+func (OnlineUsers) FrameType() string { return "online_users" }
+
+type OnlineUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// Error answers a client frame that was refused. It carries the id of that
+// frame.
+type Error struct {
+	// unknown_type, bad_frame, unsupported_version, unverified, rejected or
+	// failed (the server could not do it)
+	Code string `json:"code"`
+	// Explanation for the user
+	Content string `json:"content"`
+	// Message the refused edit or delete was about
+	MessageID int `json:"message_id,omitempty"`
+}
+
+func (Error) FrameType() string { return "error" }
+
+func (e *Error) Error() string { return e.Content }
+
+// Ack confirms a private_message or group_message frame once the message is
+// stored. It carries the id of that frame.
+type Ack struct {
+	// client_id of the message
+	ClientID string `json:"client_id,omitempty"`
+	// Id of the stored message
+	MessageID int `json:"message_id"`
+	// Set when the message had already been sent with this client_id; it
+	// was not stored or delivered again
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+func (Ack) FrameType() string { return "ack" }
+
+// Nack refuses a private_message or group_message frame; the message was
+// not stored. It carries the id of that frame.
+type Nack struct {
+	// client_id of the message
+	ClientID string `json:"client_id,omitempty"`
+	// bad_frame, unverified, not_allowed or failed (the client may retry)
+	Code string `json:"code"`
+	// Explanation for the user
+	Reason string `json:"reason"`
+}
+
+func (Nack) FrameType() string { return "nack" }
+
+// Chat
+
+// PrivateMessage is a chat message between two users, sent to both of them.
+type PrivateMessage struct {
+	MessageID int    `json:"message_id"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Username  string `json:"username,omitempty"`
+	Content   string `json:"content"`
+	// When it was sent
+	Timestamp time.Time  `json:"timestamp"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	// client_id the sender chose for it
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (PrivateMessage) FrameType() string { return "private_message" }
+
+// GroupMessage is a message in a group chat, sent to every accepted member.
+type GroupMessage struct {
+	MessageID int        `json:"message_id"`
+	GroupID   int        `json:"group_id"`
+	From      int        `json:"from"`
+	Username  string     `json:"username"`
+	Content   string     `json:"content"`
+	Timestamp time.Time  `json:"timestamp"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	// client_id the sender chose for it
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (GroupMessage) FrameType() string { return "group_message" }
+
+// Typing tells a user that From is typing to them.
+type Typing struct {
+	From     int    `json:"from"`
+	To       int    `json:"to"`
+	Username string `json:"username"`
+}
+
+func (Typing) FrameType() string { return "typing" }
+
+// MessageRead tells both users of a conversation that From has read the
+// messages To sent them.
+type MessageRead struct {
+	From     int       `json:"from"`
+	To       int       `json:"to"`
+	Username string    `json:"username"`
+	ReadAt   time.Time `json:"read_at"`
+}
+
+func (MessageRead) FrameType() string { return "message_read" }
+
+// MessageEdited is sent to everyone who can see a message its author edited.
+type MessageEdited struct {
+	MessageID int `json:"message_id"`
+	From      int `json:"from"`
+	// Other user of a private message
+	To int `json:"to,omitempty"`
+	// Group of a group message
+	GroupID int    `json:"group_id,omitempty"`
+	Content string `json:"content"`
+	// When the message was sent
+	Timestamp time.Time `json:"timestamp"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+func (MessageEdited) FrameType() string { return "message_edited" }
+
+// MessageDeleted is sent to everyone who can see a message its author deleted.
+type MessageDeleted struct {
+	MessageID int       `json:"message_id"`
+	From      int       `json:"from"`
+	To        int       `json:"to,omitempty"`
+	GroupID   int       `json:"group_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (MessageDeleted) FrameType() string { return "message_deleted" }
+
+// Posts
+
+// NewPost is sent to everyone allowed to see a new post.
+type NewPost struct {
+	PostID   int    `json:"post_id"`
+	From     int    `json:"from"`
+	Username string `json:"username"`
+	// The post, JSON encoded as returned by the posts API
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (NewPost) FrameType() string { return "new_post" }
+
+// NewComment is sent to everyone allowed to see the post commented on.
+type NewComment struct {
+	PostID   int    `json:"post_id"`
+	From     int    `json:"from"`
+	Username string `json:"username"`
+	// The comment, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (NewComment) FrameType() string { return "new_comment" }
+
+// PostLikeUpdate carries the new like counts of a post to everyone allowed
+// to see it.
+type PostLikeUpdate struct {
+	PostID int `json:"post_id"`
+	From   int `json:"from"`
+	// {"post_id", "likes_count", "dislikes_count"}, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (PostLikeUpdate) FrameType() string { return "new_postLike" }
+
+// CommentLikeUpdate carries the new like counts of a comment to everyone
+// allowed to see its post.
+type CommentLikeUpdate struct {
+	CommentID int `json:"comment_id"`
+	From      int `json:"from"`
+	// {"comment_id", "likes_count", "dislikes_count"}, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (CommentLikeUpdate) FrameType() string { return "new_commentLike" }
+
+// NewGroupPost is sent to the members of the group posted in.
+type NewGroupPost struct {
+	GroupID  int    `json:"group_id"`
+	PostID   int    `json:"post_id"`
+	From     int    `json:"from"`
+	Username string `json:"username"`
+	// The post, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (NewGroupPost) FrameType() string { return "new_groupPost" }
+
+// GroupPostLikeUpdate carries the new like counts of a group post to the
+// group's members.
+type GroupPostLikeUpdate struct {
+	GroupID  int    `json:"group_id"`
+	PostID   int    `json:"post_id"`
+	From     int    `json:"from"`
+	Username string `json:"username"`
+	// {"post_id", "group_id", "likes_count", "dislikes_count"}, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (GroupPostLikeUpdate) FrameType() string { return "group_post_like_update" }
+
+// GroupPostComment is sent to the group's members when a group post gets a
+// comment.
+type GroupPostComment struct {
+	GroupID   int    `json:"group_id"`
+	PostID    int    `json:"post_id"`
+	CommentID int    `json:"comment_id"`
+	From      int    `json:"from"`
+	Username  string `json:"username"`
+	// The comment, JSON encoded
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (GroupPostComment) FrameType() string { return "group_post_comment" }
+
+// Follows
+
+// FollowRequest tells a private user that From asked to follow them.
+type FollowRequest struct{ Notice }
+
+func (FollowRequest) FrameType() string { return "follow_request" }
+
+// NewFollower tells a user that From follows them now.
+type NewFollower struct{ Notice }
+
+func (NewFollower) FrameType() string { return "new_follower" }
+
+// FollowRequestResponse tells a user that From accepted or declined their
+// follow request.
+type FollowRequestResponse struct{ Notice }
+
+func (FollowRequestResponse) FrameType() string { return "follow_request_response" }
+
+// Unfollowed tells a user that From stopped following them.
+type Unfollowed struct {
+	From      int       `json:"from"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (Unfollowed) FrameType() string { return "unfollow_update" }
+
+// FollowUpdate tells the connections of From that they unfollowed UserID.
+type FollowUpdate struct {
+	From      int       `json:"from"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (FollowUpdate) FrameType() string { return "follow_update" }
+
+// PrivacyUpdate is sent to everyone when From makes their profile private
+// or public.
+type PrivacyUpdate struct {
+	From      int       `json:"from"`
+	Username  string    `json:"username"`
+	IsPrivate bool      `json:"isPrivate"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (PrivacyUpdate) FrameType() string { return "privacy_update" }
+
+// Groups
+
+// NewGroup is sent to everyone when From creates a group.
+type NewGroup struct {
+	Notice
+	GroupID int `json:"group_id"`
+}
+
+func (NewGroup) FrameType() string { return "new_group_created" }
+
+// GroupInvitation tells a user that From invited them to a group.
+type GroupInvitation struct {
+	Notice
+	GroupID      int `json:"group_id"`
+	InvitationID int `json:"invitation_id,omitempty"`
+}
+
+func (GroupInvitation) FrameType() string { return "group_invitation" }
+
+// InvitationResponse tells the inviter, and the invitee's other connections,
+// that From accepted or declined an invitation.
+type InvitationResponse struct {
+	Notice
+	GroupID      int `json:"group_id"`
+	InvitationID int `json:"invitation_id"`
+}
+
+func (InvitationResponse) FrameType() string { return "invitation_response" }
+
+// GroupMemberUpdate is sent when From joined a group, and to the admin who
+// handled a join request.
+type GroupMemberUpdate struct {
+	GroupID   int       `json:"group_id"`
+	From      int       `json:"from"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (GroupMemberUpdate) FrameType() string { return "group_member_update" }
+
+// GroupMemberLeft is sent when From left a group.
+type GroupMemberLeft struct {
+	GroupID   int       `json:"group_id"`
+	From      int       `json:"from"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (GroupMemberLeft) FrameType() string { return "group_member_left" }
+
+// JoinRequestSent tells the connections of From that their request to join
+// a group is waiting for approval.
+type JoinRequestSent struct {
+	GroupID   int       `json:"group_id"`
+	RequestID int       `json:"request_id,omitempty"`
+	From      int       `json:"from"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (JoinRequestSent) FrameType() string { return "join_request_sent" }
+
+// GroupJoinRequest tells a group's creator that From asked to join it.
+type GroupJoinRequest struct {
+	Notice
+	GroupID int `json:"group_id"`
+	// Id to accept or decline the request with
+	RequestID int `json:"request_id,omitempty"`
+}
+
+func (GroupJoinRequest) FrameType() string { return "group_join_request" }
+
+// GroupRequestResponse tells a user that From approved or declined their
+// request to join a group.
+type GroupRequestResponse struct {
+	Notice
+	GroupID int `json:"group_id"`
+}
+
+func (GroupRequestResponse) FrameType() string { return "group_request_response" }
+
+// Group events
+
+// NewGroupEvent tells a group's members that From created an event.
+type NewGroupEvent struct {
+	Notice
+	GroupID int `json:"group_id"`
+	EventID int `json:"event_id"`
+	// Start, RFC 3339
+	EventDate string `json:"event_date"`
+}
+
+func (NewGroupEvent) FrameType() string { return "new_groupEvent" }
+
+// GroupEventUpdated carries an event its creator changed to the group's
+// members.
+type GroupEventUpdated struct {
+	GroupID   int    `json:"group_id"`
+	EventID   int    `json:"event_id"`
+	EventDate string `json:"event_date"`
+	From      int    `json:"from"`
+	Username  string `json:"username"`
+	// The event as returned by the events API, without the RSVP of the viewer
+	Event     json.RawMessage `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+func (GroupEventUpdated) FrameType() string { return "group_event_updated" }
+
+// GroupEventRSVPUpdate carries an event's new attendance to the group's
+// members after From answered it.
+type GroupEventRSVPUpdate struct {
+	GroupID   int    `json:"group_id"`
+	EventID   int    `json:"event_id"`
+	EventDate string `json:"event_date"`
+	From      int    `json:"from"`
+	Username  string `json:"username"`
+	// The answer of From: going, not_going or waitlisted
+	UserVote  string          `json:"user_vote"`
+	Event     json.RawMessage `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+func (GroupEventRSVPUpdate) FrameType() string { return "group_event_rsvp_update" }
+
+// GroupEventCancelled is sent to a group's members when From cancels an
+// event; it is stored as a notification for those who planned to attend.
+type GroupEventCancelled struct {
+	Notice
+	GroupID   int             `json:"group_id"`
+	EventID   int             `json:"event_id"`
+	EventDate string          `json:"event_date"`
+	Event     json.RawMessage `json:"event"`
+}
+
+func (GroupEventCancelled) FrameType() string { return "group_event_cancelled" }
+
+// WaitlistPromoted tells a user on an event's waitlist that they are going now.
+type WaitlistPromoted struct {
+	Notice
+	GroupID   int    `json:"group_id"`
+	EventID   int    `json:"event_id"`
+	EventDate string `json:"event_date"`
+	// Always going
+	UserVote string `json:"user_vote"`
+}
+
+func (WaitlistPromoted) FrameType() string { return "event_waitlist_promoted" }
+
+// Notifications and account
+
+// NotificationsUpdated tells the user's connections that notifications were
+// read or deleted elsewhere.
+type NotificationsUpdated struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+func (NotificationsUpdated) FrameType() string { return "notifications_updated" }
+
+// DataExportReady tells a user that the copy of their data can be downloaded.
+type DataExportReady struct{ Notice }
+
+func (DataExportReady) FrameType() string { return "data_export_ready" }
+
+// DataExportFailed tells a user that their data export could not be built.
+type DataExportFailed struct{ Notice }
+
+func (DataExportFailed) FrameType() string { return "data_export_failed" }
+
+// Client frames
+
+// GetOnlineUsers asks for an OnlineUsers frame.
+type GetOnlineUsers struct{}
+
+func (GetOnlineUsers) FrameType() string { return "get_online_users" }
+
+// MarkRead marks the messages To sent to the user as read; both get a
+// MessageRead frame.
+type MarkRead struct {
+	To int `json:"to"`
+}
+
+func (MarkRead) FrameType() string { return "mark_read" }
+
+// SendTyping tells To that the user is typing, if they could message To.
+// Otherwise it is dropped.
+type SendTyping struct {
+	To int `json:"to"`
+}
+
+func (SendTyping) FrameType() string { return "typing" }
+
+// SendPrivateMessage sends a message to To, which requires one of them to
+// follow the other. Both get the stored PrivateMessage, and the sending
+// connection an ack or a nack.
+type SendPrivateMessage struct {
+	To      int    `json:"to"`
+	Content string `json:"content"`
+	// Unique among the sender's messages, at most 64 characters. A message
+	// sent again with the same client_id is only stored once, so it can be
+	// retried safely
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (SendPrivateMessage) FrameType() string { return "private_message" }
+
+// SendGroupMessage sends a message to a group the user is an accepted
+// member of. Every member gets the stored GroupMessage, and the sending
+// connection an ack or a nack.
+type SendGroupMessage struct {
+	GroupID int    `json:"group_id"`
+	Content string `json:"content"`
+	// As in private_message
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (SendGroupMessage) FrameType() string { return "group_message" }
+
+// EditMessageRequest changes one of the user's messages within
+// MessageEditWindow of sending it.
+type EditMessageRequest struct {
+	MessageID int `json:"message_id"`
+	// Set for a group message
+	GroupID int    `json:"group_id,omitempty"`
+	Content string `json:"content"`
+}
+
+func (EditMessageRequest) FrameType() string { return "edit_message" }
+
+// DeleteMessageRequest deletes one of the user's messages.
+type DeleteMessageRequest struct {
+	MessageID int `json:"message_id"`
+	// Set for a group message
+	GroupID int `json:"group_id,omitempty"`
+}
+
+func (DeleteMessageRequest) FrameType() string { return "delete_message" }
@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:generate go test -run TestProtocolDoc -update
+
+// Protocol versions. Clients choose one with the Sec-WebSocket-Protocol
+// header; those that send none get version 1.
+const (
+	// ProtocolV1 frames are flat JSON objects: "type", "seq" and the
+	// payload's fields side by side.
+	ProtocolV1 = 1
+	// ProtocolV2 frames are envelopes: {"v", "type", "id", "seq", "payload"}.
+	ProtocolV2 = 2
+)
+
+// subprotocols are the Sec-WebSocket-Protocol values of the versions,
+// newest (preferred) first.
+var subprotocols = []string{"socialnetwork.v2", "socialnetwork.v1"}
+
+var subprotocolVersions = map[string]int{
+	"socialnetwork.v2": ProtocolV2,
+	"socialnetwork.v1": ProtocolV1,
+}
+
+// Payload is the typed content of a frame. Each frame type has its own
+// payload type (see payloads.go).
+type Payload interface {
+	FrameType() string
+}
+
+// serverFrames lists every frame the server sends, in the order of
+// PROTOCOL.md.
+var serverFrames = []Payload{
+	Hello{}, Resync{}, OnlineUsers{}, Error{}, Ack{}, Nack{},
+	PrivateMessage{}, GroupMessage{}, Typing{}, MessageRead{}, MessageEdited{}, MessageDeleted{},
+	NewPost{}, NewComment{}, PostLikeUpdate{}, CommentLikeUpdate{},
+	NewGroupPost{}, GroupPostLikeUpdate{}, GroupPostComment{},
+	FollowRequest{}, NewFollower{}, FollowRequestResponse{}, Unfollowed{}, FollowUpdate{}, PrivacyUpdate{},
+	NewGroup{}, GroupInvitation{}, InvitationResponse{}, GroupMemberUpdate{}, GroupMemberLeft{},
+	JoinRequestSent{}, GroupJoinRequest{}, GroupRequestResponse{},
+	NewGroupEvent{}, GroupEventUpdated{}, GroupEventRSVPUpdate{}, GroupEventCancelled{}, WaitlistPromoted{},
+	NotificationsUpdated{}, DataExportReady{}, DataExportFailed{},
+}
+
+// clientFrame is the handler of one type of frame sent by clients.
+type clientFrame struct {
+	payload Payload
+	handle  func(h *Hub, c *Client, raw json.RawMessage) (Payload, error)
+}
+
+// handle makes the clientFrame of a typed handler, which may answer with a
+// payload.
+func handle[P Payload](fn func(h *Hub, c *Client, p P) (Payload, error)) clientFrame {
+	var zero P
+	return clientFrame{
+		payload: zero,
+		handle: func(h *Hub, c *Client, raw json.RawMessage) (Payload, error) {
+			var p P
+			if len(raw) > 0 {
+				if err := json.Unmarshal(raw, &p); err != nil {
+					return nil, &Error{Code: "bad_frame", Content: "Invalid " + zero.FrameType() + " frame"}
+				}
+			}
+			return fn(h, c, p)
+		},
+	}
+}
+
+// clientFrames lists every frame clients may send, in the order of
+// PROTOCOL.md. Any other type is answered with an error.
+var clientFrames = []clientFrame{
+	handle((*Hub).getOnlineUsers),
+	handle((*Hub).markRead),
+	handle((*Hub).sendTyping),
+	handle((*Hub).sendPrivateMessage),
+	handle((*Hub).sendGroupMessage),
+	handle((*Hub).editMessage),
+	handle((*Hub).deleteMessage),
+}
+
+var clientHandlers = func() map[string]clientFrame {
+	m := make(map[string]clientFrame, len(clientFrames))
+	for _, f := range clientFrames {
+		m[f.payload.FrameType()] = f
+	}
+	return m
+}()
+
+// envelope is a version 2 frame.
+type envelope struct {
+	V    int    `json:"v"`
+	Type string `json:"type"`
+	// Chosen by the client, echoed on the frames answering it
+	ID      string          `json:"id,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// supportsRequestedVersion reports whether the client asked for no version
+// in Sec-WebSocket-Protocol or for at least one the server speaks. The
+// upgrader picks the newest of them.
+func supportsRequestedVersion(r *http.Request) bool {
+	requested := websocket.Subprotocols(r)
+	for _, name := range requested {
+		if subprotocolVersions[name] != 0 {
+			return true
+		}
+	}
+	return len(requested) == 0
+}
+
+// connVersion returns the protocol version chosen for conn.
+func connVersion(conn *websocket.Conn) int {
+	if v := subprotocolVersions[conn.Subprotocol()]; v != 0 {
+		return v
+	}
+	return ProtocolV1
+}
+
+// decodeFrame splits a frame received in the given version into its type,
+// id and payload.
+func decodeFrame(version int, data []byte) (typ, id string, payload json.RawMessage, err error) {
+	if version == ProtocolV1 {
+		var head struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &head); err != nil {
+			return "", "", nil, err
+		}
+		// The whole object is the payload
+		return head.Type, head.ID, data, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return "", "", nil, err
+	}
+	if env.V != ProtocolV2 {
+		return env.Type, env.ID, nil, &Error{Code: "unsupported_version", Content: fmt.Sprintf("Unsupported protocol version %d", env.V)}
+	}
+	return env.Type, env.ID, env.Payload, nil
+}
+
+// outgoing is a payload encoded once for all of its recipients.
+type outgoing struct {
+	typ     string
+	payload json.RawMessage
+}
+
+func encodePayload(p Payload) *outgoing {
+	data, err := json.Marshal(p)
+	if err != nil {
+		fmt.Println("[WebSocket] Error encoding frame:", err)
+		return nil
+	}
+	return &outgoing{typ: p.FrameType(), payload: data}
+}
+
+// frame returns the frame for one recipient.
+func (o *outgoing) frame(id string, seq int64) *frame {
+	return &frame{typ: o.typ, id: id, seq: seq, payload: o.payload}
+}
+
+// frame is an outgoing frame, encoded for each protocol version when first
+// needed.
+type frame struct {
+	typ     string
+	id      string
+	seq     int64
+	payload json.RawMessage
+
+	once [2]sync.Once
+	data [2][]byte
+}
+
+// bytes returns the frame encoded for version.
+func (f *frame) bytes(version int) []byte {
+	i := 0
+	if version == ProtocolV2 {
+		i = 1
+	}
+	f.once[i].Do(func() {
+		var err error
+		if version == ProtocolV2 {
+			f.data[i], err = json.Marshal(envelope{V: ProtocolV2, Type: f.typ, ID: f.id, Seq: f.seq, Payload: f.payload})
+		} else {
+			f.data[i], err = f.flat()
+		}
+		if err != nil {
+			fmt.Println("[WebSocket] Error encoding frame:", err)
+		}
+	})
+	return f.data[i]
+}
+
+// flat encodes the frame for version 1.
+func (f *frame) flat() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(f.payload, &fields); err != nil {
+		return nil, err
+	}
+	fields["type"], _ = json.Marshal(f.typ)
+	if f.id != "" {
+		fields["id"], _ = json.Marshal(f.id)
+	}
+	if f.seq != 0 {
+		fields["seq"], _ = json.Marshal(f.seq)
+	}
+	// Version 1 clients have always found the id of an event in post_id
+	if id, ok := fields["event_id"]; ok {
+		fields["post_id"] = id
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,234 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite PROTOCOL.md")
+
+// protocolDocs holds the doc comments of the package's types and of their
+// fields, by type name and by "Type.Field".
+type protocolDocs struct {
+	types      map[string]string
+	fields     map[string]string
+	frameTypes []string // types with a FrameType method
+}
+
+func parseProtocolDocs(t *testing.T) protocolDocs {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := protocolDocs{types: map[string]string{}, fields: map[string]string{}}
+	for _, file := range pkgs["chat"].Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					doc := ts.Doc
+					if doc == nil {
+						doc = decl.Doc
+					}
+					docs.types[ts.Name.Name] = doc.Text()
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, f := range st.Fields.List {
+						text := f.Doc.Text()
+						if text == "" {
+							text = f.Comment.Text()
+						}
+						for _, name := range f.Names {
+							docs.fields[ts.Name.Name+"."+name.Name] = text
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Name.Name != "FrameType" || decl.Recv == nil {
+					continue
+				}
+				if ident, ok := decl.Recv.List[0].Type.(*ast.Ident); ok {
+					docs.frameTypes = append(docs.frameTypes, ident.Name)
+				}
+			}
+		}
+	}
+	return docs
+}
+
+// protocolDoc renders PROTOCOL.md.
+func protocolDoc(docs protocolDocs) []byte {
+	var b bytes.Buffer
+	b.WriteString(`# WebSocket protocol
+
+<!-- Generated from the payload types in pkg/apis/chat by "go generate ./pkg/apis/chat". Do not edit. -->
+
+Clients connect to ` + "`/ws`" + ` and pick a protocol version with the
+` + "`Sec-WebSocket-Protocol`" + ` header. The server chooses the newest version it
+speaks among those offered and answers 400 when it speaks none of them.
+
+| Subprotocol | Version | Frames |
+|---|---|---|
+| ` + "`socialnetwork.v2`" + ` | 2 | ` + "`{\"v\": 2, \"type\", \"id\", \"seq\", \"payload\"}`" + ` |
+| ` + "`socialnetwork.v1`" + `, or none | 1 | the payload's fields with ` + "`type`, `id` and `seq`" + ` next to them; event frames repeat ` + "`event_id`" + ` as ` + "`post_id`" + ` |
+
+` + "`id`" + ` is chosen by the client for the frames it sends and echoed on the
+frames answering them. ` + "`seq`" + ` numbers the events delivered to a user; a
+client reconnecting with ` + "`?stream=<stream>&since=<seq>`" + ` gets the events
+it missed. ` + "`typing`" + `, ` + "`error`" + `, ` + "`ack`" + ` and ` + "`nack`" + ` frames carry
+no ` + "`seq`" + ` and are never replayed.
+
+A frame of an unknown type, or one that cannot be decoded, is answered with
+an ` + "`error`" + ` frame.
+`)
+
+	b.WriteString("\n## Server frames\n")
+	for _, p := range serverFrames {
+		writeFrameDoc(&b, docs, p)
+	}
+	b.WriteString("\n## Client frames\n")
+	for _, f := range clientFrames {
+		writeFrameDoc(&b, docs, f.payload)
+	}
+	return b.Bytes()
+}
+
+func writeFrameDoc(b *bytes.Buffer, docs protocolDocs, p Payload) {
+	typ := reflect.TypeOf(p)
+	fmt.Fprintf(b, "\n### `%s`\n\n", p.FrameType())
+	if doc := oneLine(docs.types[typ.Name()]); doc != "" {
+		fmt.Fprintf(b, "%s\n\n", doc)
+	}
+	var rows []string
+	collectFields(docs, typ, &rows)
+	if len(rows) == 0 {
+		b.WriteString("No fields.\n")
+		return
+	}
+	b.WriteString("| Field | Type | Description |\n|---|---|---|\n")
+	for _, row := range rows {
+		b.WriteString(row + "\n")
+	}
+}
+
+// collectFields adds a table row for each JSON field of typ, those of
+// embedded structs included.
+func collectFields(docs protocolDocs, typ reflect.Type, rows *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous {
+			collectFields(docs, f.Type, rows)
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		desc := oneLine(docs.fields[typ.Name()+"."+f.Name])
+		if opts == "omitempty" || f.Type.Kind() == reflect.Pointer {
+			desc = strings.TrimSpace("Optional. " + desc)
+		}
+		*rows = append(*rows, fmt.Sprintf("| `%s` | %s | %s |", name, jsonType(f.Type), desc))
+	}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func jsonType(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time (RFC 3339)"
+	case t == rawType:
+		return "object"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	case reflect.Int, reflect.Int64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		return "array of " + jsonType(t.Elem())
+	case reflect.Struct:
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			names = append(names, "`"+name+"`")
+		}
+		return "{" + strings.Join(names, ", ") + "}"
+	}
+	return t.Kind().String()
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func TestProtocolDoc(t *testing.T) {
+	docs := parseProtocolDocs(t)
+
+	// Every payload type is registered, once
+	registered := map[string]int{}
+	for _, p := range serverFrames {
+		registered[reflect.TypeOf(p).Name()]++
+	}
+	for _, f := range clientFrames {
+		registered[reflect.TypeOf(f.payload).Name()]++
+	}
+	for _, name := range docs.frameTypes {
+		if registered[name] != 1 {
+			t.Errorf("%s is listed %d times in serverFrames and clientFrames, want once", name, registered[name])
+		}
+	}
+	clientTypes := map[string]bool{}
+	for _, f := range clientFrames {
+		if clientTypes[f.payload.FrameType()] {
+			t.Errorf("two client frames of type %s", f.payload.FrameType())
+		}
+		clientTypes[f.payload.FrameType()] = true
+	}
+
+	want := protocolDoc(docs)
+	if *update {
+		if err := os.WriteFile("PROTOCOL.md", want, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	got, err := os.ReadFile("PROTOCOL.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("PROTOCOL.md is out of date; run go generate ./pkg/apis/chat")
+	}
+}
@@ -0,0 +1,439 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultRedisPrefix starts the names of the keys and channels of a
+	// RedisBroker.
+	DefaultRedisPrefix = "socialnetwork:"
+
+	// presenceTTL is how long the users of an instance stay listed after it
+	// last refreshed them; an instance that dies drops out after that.
+	presenceTTL = 30 * time.Second
+	// presenceRefresh is how often an instance refreshes its users.
+	presenceRefresh = presenceTTL / 3
+
+	redisDialTimeout = 5 * time.Second
+	// redisRetryDelay is the longest wait between two attempts to
+	// resubscribe.
+	redisRetryDelay = 5 * time.Second
+)
+
+// RedisBroker shares deliveries through Redis pub/sub, on one channel that
+// every instance subscribes to, and presence in one key per instance that
+// expires after presenceTTL.
+type RedisBroker struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	// instance tells the messages of this instance apart
+	instance string
+
+	mu       sync.Mutex
+	conn     *redisConn // for commands, opened when first needed
+	sub      *redisConn // subscribed to the channel
+	presence []byte     // last users set, JSON encoded
+	closed   bool
+	done     chan struct{}
+}
+
+// brokerMessage is what goes on the channel.
+type brokerMessage struct {
+	Origin string `json:"origin"`
+	// "deliver" or "presence"
+	Kind     string    `json:"kind"`
+	Delivery *Delivery `json:"delivery,omitempty"`
+}
+
+// NewRedisBroker returns a broker for the Redis server at redisURL
+// (redis://[:password@]host:port[/db]). It connects when first used and
+// reconnects on its own.
+func NewRedisBroker(redisURL, prefix string) (*RedisBroker, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", redisURL)
+	}
+	b := &RedisBroker{
+		addr:     u.Host,
+		prefix:   prefix,
+		instance: uuid.NewString(),
+		presence: []byte("[]"),
+		done:     make(chan struct{}),
+	}
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		b.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if b.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	return b, nil
+}
+
+func (b *RedisBroker) channel() string { return b.prefix + "hub" }
+
+func (b *RedisBroker) instancesKey() string { return b.prefix + "instances" }
+
+func (b *RedisBroker) presenceKey(instance string) string {
+	return b.prefix + "presence:" + instance
+}
+
+func (b *RedisBroker) Publish(d Delivery) error {
+	return b.publish(brokerMessage{Kind: "deliver", Delivery: &d})
+}
+
+func (b *RedisBroker) publish(msg brokerMessage) error {
+	msg.Origin = b.instance
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.do("PUBLISH", b.channel(), string(data))
+	return err
+}
+
+// Subscribe listens to the channel, and refreshes this instance's presence,
+// until Close.
+func (b *RedisBroker) Subscribe(h BrokerHandler) error {
+	go b.listen(h)
+	go b.refreshPresence()
+	return nil
+}
+
+// listen subscribes to the channel and passes on the messages of the other
+// instances, resubscribing whenever the connection fails.
+func (b *RedisBroker) listen(h BrokerHandler) {
+	missed := false
+	delay := 100 * time.Millisecond
+	for {
+		err := b.subscribe(func() {
+			// Whatever was published while unsubscribed is gone
+			if missed {
+				h.Lost()
+				h.PresenceChanged()
+			}
+			missed = true
+			delay = 100 * time.Millisecond
+		}, h)
+		if b.isClosed() {
+			return
+		}
+		fmt.Println("[Redis] Subscription lost, retrying:", err)
+		select {
+		case <-b.done:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > redisRetryDelay {
+			delay = redisRetryDelay
+		}
+	}
+}
+
+// subscribe reads the channel until the connection fails. subscribed is
+// called once the subscription is confirmed.
+func (b *RedisBroker) subscribe(subscribed func(), h BrokerHandler) error {
+	conn, err := b.dial()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	b.sub = conn
+	b.mu.Unlock()
+	defer conn.Close()
+
+	if err := conn.send("SUBSCRIBE", b.channel()); err != nil {
+		return err
+	}
+	if _, err := conn.read(); err != nil {
+		return err
+	}
+	subscribed()
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		// ["message", channel, data]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		data, _ := parts[2].(string)
+		var msg brokerMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			fmt.Println("[Redis] Error decoding message:", err)
+			continue
+		}
+		if msg.Origin == b.instance {
+			continue
+		}
+		switch {
+		case msg.Kind == "deliver" && msg.Delivery != nil:
+			h.Deliver(*msg.Delivery)
+		case msg.Kind == "presence":
+			h.PresenceChanged()
+		}
+	}
+}
+
+// refreshPresence keeps this instance's users from expiring.
+func (b *RedisBroker) refreshPresence() {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			data := b.presence
+			b.mu.Unlock()
+			if err := b.storePresence(data); err != nil {
+				fmt.Println("[Redis] Error refreshing presence:", err)
+			}
+		}
+	}
+}
+
+func (b *RedisBroker) SetPresence(users []OnlineUser) error {
+	data, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.presence = data
+	b.mu.Unlock()
+	if err := b.storePresence(data); err != nil {
+		return err
+	}
+	return b.publish(brokerMessage{Kind: "presence"})
+}
+
+func (b *RedisBroker) storePresence(data []byte) error {
+	ttl := strconv.Itoa(int(presenceTTL / time.Second))
+	if _, err := b.do("SET", b.presenceKey(b.instance), string(data), "EX", ttl); err != nil {
+		return err
+	}
+	_, err := b.do("SADD", b.instancesKey(), b.instance)
+	return err
+}
+
+// Presence reads the users of every other instance, forgetting the
+// instances whose users expired.
+func (b *RedisBroker) Presence() ([]OnlineUser, error) {
+	reply, err := b.do("SMEMBERS", b.instancesKey())
+	if err != nil {
+		return nil, err
+	}
+	members, _ := reply.([]interface{})
+	var instances []string
+	args := []string{"MGET"}
+	for _, m := range members {
+		if id, ok := m.(string); ok && id != b.instance {
+			instances = append(instances, id)
+			args = append(args, b.presenceKey(id))
+		}
+	}
+	if len(instances) == 0 {
+		return nil, nil
+	}
+	if reply, err = b.do(args...); err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]interface{})
+
+	var users []OnlineUser
+	for i, instance := range instances {
+		var data string
+		if i < len(values) {
+			data, _ = values[i].(string)
+		}
+		if data == "" {
+			b.do("SREM", b.instancesKey(), instance)
+			continue
+		}
+		var list []OnlineUser
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			fmt.Println("[Redis] Error decoding presence:", err)
+			continue
+		}
+		users = append(users, list...)
+	}
+	return users, nil
+}
+
+// Close stops listening and removes this instance's users.
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.sub != nil {
+		b.sub.Close()
+	}
+	b.mu.Unlock()
+
+	b.do("DEL", b.presenceKey(b.instance))
+	b.do("SREM", b.instancesKey(), b.instance)
+	err := b.publish(brokerMessage{Kind: "presence"})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return err
+}
+
+func (b *RedisBroker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// do runs a command on the shared connection, dialing again once if the
+// connection had failed.
+func (b *RedisBroker) do(args ...string) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if b.conn == nil {
+			conn, err := b.dial()
+			if err != nil {
+				return nil, err
+			}
+			b.conn = conn
+		}
+		reply, err := b.conn.do(args...)
+		var redisErr redisError
+		if err == nil || errors.As(err, &redisErr) || attempt == 1 {
+			return reply, err
+		}
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+func (b *RedisBroker) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", b.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if b.password != "" {
+		if _, err := conn.do("AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if b.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(b.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisConn speaks the Redis protocol (RESP) over a connection. Replies are
+// strings, int64s, nil or []interface{} of those.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) send(args ...string) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.w.Flush()
+}
+
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
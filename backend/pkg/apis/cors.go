@@ -2,37 +2,64 @@ package api
 
 import (
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 )
 
-// WithCORS wraps handlers and sets CORS headers.
-// It echoes back the Origin header for a small allowlist so credentials (cookies)
-// can be sent from the frontend. Avoid using a wildcard when Credential=true.
-func WithCORS(handler http.HandlerFunc) http.HandlerFunc {
-	allowed := []string{
-		"http://localhost:3000",
-		"http://127.0.0.1:3000",
-		// When served inside Docker, the frontend container hostname may be different;
-		// the frontend uses BACKEND_URL=http://backend:8080, but browser requests will
-		// still originate from the host (localhost:3000). Keep the list small and safe.
+// defaultAllowedOrigins are the frontends allowed when ALLOWED_ORIGINS is not set.
+var defaultAllowedOrigins = []string{
+	"http://localhost:3000",
+	"http://127.0.0.1:3000",
+}
+
+// AllowedOrigins returns the origins of the frontends allowed to call the API
+// with credentials, from ALLOWED_ORIGINS (a comma separated list such as
+// "https://social.example.com,http://localhost:3000").
+var AllowedOrigins = sync.OnceValue(func() []string {
+	var origins []string
+	for _, o := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	if len(origins) == 0 {
+		return defaultAllowedOrigins
 	}
+	return origins
+})
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin != "" {
-			for _, a := range allowed {
-				if strings.EqualFold(a, origin) {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					break
-				}
-			}
+// IsAllowedOrigin reports whether origin is one of AllowedOrigins.
+func IsAllowedOrigin(origin string) bool {
+	for _, a := range AllowedOrigins() {
+		if strings.EqualFold(a, origin) {
+			return true
 		}
+	}
+	return false
+}
+
+// IsTrustedOrigin reports whether a request from origin may act on behalf of
+// the user: origin is an allowed frontend or the server itself.
+func IsTrustedOrigin(r *http.Request, origin string) bool {
+	if IsAllowedOrigin(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
 
-		// Fallback: if Access-Control-Allow-Origin wasn't set and the request is from
-		// localhost on port 3000 using an IP form (e.g., 0.0.0.0), allow it by echoing
-		// any origin that contains ":3000" — this is convenient for local testing.
-		if w.Header().Get("Access-Control-Allow-Origin") == "" && origin != "" && strings.Contains(origin, ":3000") {
+// WithCORS wraps handlers and sets CORS headers.
+// It echoes back the Origin header for the allowlist so credentials (cookies)
+// can be sent from the frontend. Avoid using a wildcard when Credential=true.
+// When served inside Docker, the frontend uses BACKEND_URL=http://backend:8080,
+// but browser requests still originate from the host, e.g. localhost:3000.
+func WithCORS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && IsAllowedOrigin(origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
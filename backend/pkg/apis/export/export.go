@@ -0,0 +1,119 @@
+// Package export builds personal data archives: a ZIP file with one JSON file
+// per kind of data the user has (see database.UserDataSections) and the
+// images they uploaded under images/.
+package export
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	u "socialnetwork/pkg/apis/user"
+	database "socialnetwork/pkg/db"
+)
+
+// Dir is where archives are stored, from EXPORT_DIR (default data/exports).
+func Dir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "exports")
+}
+
+// buildArchive writes the archive of userID for exportID into Dir and
+// returns its path.
+func buildArchive(db *sql.DB, userID, exportID int) (string, error) {
+	dir := Dir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	final := filepath.Join(dir, "export-"+strconv.Itoa(exportID)+".zip")
+	tmp, err := os.CreateTemp(dir, "export-*.zip.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	err = WriteArchive(db, userID, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return final, os.Rename(tmp.Name(), final)
+}
+
+// WriteArchive writes the ZIP archive of userID's data to w.
+func WriteArchive(db *sql.DB, userID int, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	images := map[string]bool{}
+
+	for _, section := range database.UserDataSections {
+		rows, err := database.QueryUserData(db, section.Query, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.Name, err)
+		}
+		for _, row := range rows {
+			for _, col := range []string{"avatar_url", "imgOrgif"} {
+				if img, ok := row[col].(string); ok && img != "" && img != database.DefaultAvatar {
+					images[img] = true
+				}
+			}
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: section.Name + ".json", Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			return err
+		}
+	}
+
+	for img := range images {
+		if err := addImage(zw, img); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// addImage copies an uploaded image into the archive under images/, e.g.
+// /img/posts/cat.png as images/posts/cat.png. Missing files are skipped.
+func addImage(zw *zip.Writer, urlPath string) error {
+	file, ok := u.UploadPath(urlPath)
+	if !ok {
+		return nil
+	}
+	src, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	name := "images/" + strings.TrimPrefix(path.Clean("/"+urlPath), "/img/")
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,259 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/mail"
+	"socialnetwork/pkg/apis/notification"
+	u "socialnetwork/pkg/apis/user"
+	database "socialnetwork/pkg/db"
+)
+
+const (
+	// ExportTTL is how long a finished archive can be downloaded.
+	ExportTTL = 7 * 24 * time.Hour
+	// staleAfter is when a pending export is given up on, e.g. because the
+	// server restarted while building it.
+	staleAfter = time.Hour
+	// cleanupInterval is how often expired archives are removed.
+	cleanupInterval = time.Hour
+)
+
+// builds limits how many archives are built at the same time.
+var builds = make(chan struct{}, 2)
+
+// exportResponse is an export as returned to its owner.
+type exportResponse struct {
+	*database.DataExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func newExportResponse(e *database.DataExport, now time.Time) exportResponse {
+	resp := exportResponse{DataExport: e}
+	if e.Status == "ready" && e.ExpiresAt != nil && now.Before(*e.ExpiresAt) {
+		resp.DownloadURL = "/account/export/download?id=" + strconv.Itoa(e.ID)
+	}
+	return resp
+}
+
+// RequestExport handles POST /account/export: it starts building an archive
+// of the user's data and notifies them when it can be downloaded.
+func RequestExport(db *sql.DB, hub *chat.Hub, mailer mail.Mailer, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	exportID, err := database.CreateDataExport(db, userID, now)
+	if errors.Is(err, database.ErrExportPending) {
+		http.Error(w, "Your data export is already being prepared.", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error creating data export:", err)
+		http.Error(w, "Failed to start data export", http.StatusInternalServerError)
+		return
+	}
+	fmt.Println("Data export", exportID, "requested by User ID:", userID)
+
+	go build(db, hub, mailer, userID, exportID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Your data export is being prepared. We will let you know when it is ready.",
+		"export":  newExportResponse(&database.DataExport{ID: exportID, Status: "pending", CreatedAt: now}, now),
+	})
+}
+
+// GetExport handles GET /account/export: the user's latest export, or null.
+func GetExport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var export interface{}
+	e, err := database.GetLatestDataExport(db, userID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		fmt.Println("Error getting data export:", err)
+		http.Error(w, "Failed to get data export", http.StatusInternalServerError)
+		return
+	default:
+		export = newExportResponse(e, time.Now())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"export":  export,
+	})
+}
+
+// DownloadExport handles GET /account/export/download?id=N. Only the owner
+// can download an archive, and only until it expires.
+func DownloadExport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+	exportID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid export ID", http.StatusBadRequest)
+		return
+	}
+
+	e, err := database.GetDataExport(db, exportID)
+	if err == sql.ErrNoRows || (err == nil && e.UserID != userID) {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error getting data export:", err)
+		http.Error(w, "Failed to get data export", http.StatusInternalServerError)
+		return
+	}
+	if e.Status != "ready" {
+		http.Error(w, "This export is not ready.", http.StatusConflict)
+		return
+	}
+	if e.ExpiresAt == nil || !time.Now().Before(*e.ExpiresAt) {
+		http.Error(w, "This download link has expired. Please request a new export.", http.StatusGone)
+		return
+	}
+
+	f, err := os.Open(e.FilePath)
+	if err != nil {
+		fmt.Println("Error opening data export:", err)
+		http.Error(w, "This download link has expired. Please request a new export.", http.StatusGone)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Println("Error opening data export:", err)
+		http.Error(w, "Failed to get data export", http.StatusInternalServerError)
+		return
+	}
+
+	username, _ := database.GetUsernameUsingID(db, userID)
+	name := fmt.Sprintf("socialnetwork-%s-%s.zip", username, e.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// build builds an export and tells its owner how it went.
+func build(db *sql.DB, hub *chat.Hub, mailer mail.Mailer, userID, exportID int) {
+	builds <- struct{}{}
+	defer func() { <-builds }()
+
+	file, err := buildArchive(db, userID, exportID)
+	now := time.Now()
+	if err != nil {
+		fmt.Println("Error building data export:", err)
+		if err := database.FailDataExport(db, exportID, now); err != nil {
+			fmt.Println("Error updating data export:", err)
+		}
+		notification.Notify(db, hub, userID, &chat.DataExportFailed{Notice: chat.Notice{
+			Content:   "We could not prepare your data export. Please try again.",
+			Timestamp: now,
+		}})
+		return
+	}
+
+	expiresAt := now.Add(ExportTTL)
+	if err := database.FinishDataExport(db, exportID, file, now, expiresAt); err != nil {
+		fmt.Println("Error updating data export:", err)
+		os.Remove(file)
+		return
+	}
+	fmt.Println("Data export", exportID, "ready for User ID:", userID)
+
+	expires := expiresAt.UTC().Format("2 January 2006 at 15:04 UTC")
+	notification.Notify(db, hub, userID, &chat.DataExportReady{Notice: chat.Notice{
+		Content:   "Your data export is ready. Download it from your profile before " + expires + ".",
+		Timestamp: now,
+	}})
+	if _, email, err := database.GetUserContact(db, userID); err != nil {
+		fmt.Println("Error getting user contact:", err)
+	} else if err := mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Your data export is ready",
+		Body: "The copy of your data you asked for is ready. Download it from your profile:\n\n" +
+			u.AppURL() + "/myProfile\n\nThe download is available until " + expires + ".",
+	}); err != nil {
+		fmt.Println("Error sending data export email:", err)
+	}
+}
+
+// RunCleanup removes expired archives and gives up on stale pending exports,
+// now and then every hour. It never returns.
+func RunCleanup(db *sql.DB) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		cleanup(db, time.Now())
+		<-ticker.C
+	}
+}
+
+func cleanup(db *sql.DB, now time.Time) {
+	exports, err := database.GetAllDataExports(db)
+	if err != nil {
+		fmt.Println("Error listing data exports:", err)
+		return
+	}
+	for _, e := range exports {
+		switch {
+		case e.Status == "pending" && now.Sub(e.CreatedAt) > staleAfter:
+			if err := database.FailDataExport(db, e.ID, now); err != nil {
+				fmt.Println("Error updating data export:", err)
+			}
+		case e.Status == "ready" && e.ExpiresAt != nil && !now.Before(*e.ExpiresAt),
+			e.Status == "failed" && now.Sub(e.CreatedAt) > ExportTTL:
+			RemoveFile(e.FilePath)
+			if err := database.DeleteDataExport(db, e.ID); err != nil {
+				fmt.Println("Error deleting data export:", err)
+			}
+		}
+	}
+}
+
+// RemoveFile deletes an archive file, if there is one.
+func RemoveFile(file string) {
+	if file == "" {
+		return
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error removing data export:", err)
+	}
+}
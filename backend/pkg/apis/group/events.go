@@ -0,0 +1,554 @@
+package group
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // event time zones must resolve even where the OS has no zoneinfo
+
+	"socialnetwork/pkg/apis/authz"
+	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/notification"
+	u "socialnetwork/pkg/apis/user"
+	database "socialnetwork/pkg/db"
+)
+
+// Layouts accepted for event times without an explicit offset; they are read
+// in the event's time zone. datetime-local inputs send the first one.
+var localEventLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+}
+
+func parseEventTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range localEventLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// toEventInput validates an event request and converts its times to UTC.
+func toEventInput(req EventRequest) (database.EventInput, error) {
+	in := database.EventInput{
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Timezone:    strings.TrimSpace(req.Timezone),
+		Location:    strings.TrimSpace(req.Location),
+		Capacity:    req.Capacity,
+	}
+	if in.Title == "" || in.Description == "" {
+		return in, errors.New("title and description are required")
+	}
+	if in.Timezone == "" {
+		in.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(in.Timezone)
+	if err != nil {
+		return in, errors.New("unknown timezone")
+	}
+
+	startsAt := strings.TrimSpace(req.StartsAt)
+	if startsAt == "" {
+		startsAt = strings.TrimSpace(req.EventDate)
+	}
+	if startsAt == "" {
+		return in, errors.New("starts_at is required")
+	}
+	if in.StartsAt, err = parseEventTime(startsAt, loc); err != nil {
+		return in, errors.New("invalid starts_at")
+	}
+	if endsAt := strings.TrimSpace(req.EndsAt); endsAt != "" {
+		t, err := parseEventTime(endsAt, loc)
+		if err != nil {
+			return in, errors.New("invalid ends_at")
+		}
+		if !t.After(in.StartsAt) {
+			return in, errors.New("ends_at must be after starts_at")
+		}
+		in.EndsAt = &t
+	}
+	if in.Capacity != nil && *in.Capacity <= 0 {
+		return in, errors.New("capacity must be positive")
+	}
+	return in, nil
+}
+
+// localizeEvent shows the start and end times in the event's own time zone.
+func localizeEvent(ev *database.Event) {
+	loc, err := time.LoadLocation(ev.Timezone)
+	if err != nil {
+		return
+	}
+	ev.StartsAt = ev.StartsAt.In(loc)
+	if ev.EndsAt != nil {
+		endsAt := ev.EndsAt.In(loc)
+		ev.EndsAt = &endsAt
+	}
+}
+
+// sharedEvent encodes ev for the frames sent to every member, without the
+// RSVP fields of the user who loaded it.
+func sharedEvent(ev *database.Event) json.RawMessage {
+	shared := *ev
+	shared.UserRSVP = ""
+	shared.WaitlistPosition = 0
+	eventJSON, _ := json.Marshal(shared)
+	return eventJSON
+}
+
+func usernameOf(db *sql.DB, userID int) string {
+	var username string
+	db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	return username
+}
+
+// pushEvent sends an event change to every accepted group member.
+func pushEvent(hub *chat.Hub, ev *database.Event, p chat.Payload) {
+	if hub == nil {
+		return
+	}
+	hub.SendToGroup(ev.GroupID, p)
+}
+
+// notifyPromoted tells members moved off the waitlist that they have a spot.
+func notifyPromoted(db *sql.DB, hub *chat.Hub, ev *database.Event, userIDs []int) {
+	for _, id := range userIDs {
+		notification.Notify(db, hub, id, &chat.WaitlistPromoted{
+			Notice: chat.Notice{
+				Content:   "A spot opened up, you are now going to " + ev.Title,
+				Timestamp: time.Now(),
+			},
+			GroupID:   ev.GroupID,
+			EventID:   ev.ID,
+			EventDate: ev.StartsAt.Format(time.RFC3339),
+			UserVote:  database.RSVPGoing,
+		})
+	}
+}
+
+// notifyCancelled sends the cancellation of ev to the group's members.
+// Everyone who planned to come keeps a stored notification; the other
+// members, the actor included, only get the frame.
+func notifyCancelled(db *sql.DB, hub *chat.Hub, actorID int, ev *database.Event) {
+	notif := &chat.GroupEventCancelled{
+		Notice: chat.Notice{
+			From:      actorID,
+			Username:  usernameOf(db, actorID),
+			Content:   ev.Title + " has been cancelled",
+			Timestamp: time.Now(),
+		},
+		GroupID:   ev.GroupID,
+		EventID:   ev.ID,
+		EventDate: ev.StartsAt.Format(time.RFC3339),
+		Event:     sharedEvent(ev),
+	}
+
+	memberIDs, err := getGroupMemberIDs(db, ev.GroupID)
+	if err != nil {
+		fmt.Println("Error fetching group members for event update:", err)
+		return
+	}
+	attending := map[int]bool{}
+	if attendees, err := database.GetEventAttendees(db, ev.ID); err == nil {
+		for _, a := range attendees {
+			if a.Status != database.RSVPNotGoing && a.UserID != actorID {
+				attending[a.UserID] = true
+			}
+		}
+	}
+	var attendeeIDs, otherIDs []int
+	for _, id := range memberIDs {
+		if attending[id] {
+			attendeeIDs = append(attendeeIDs, id)
+		} else {
+			otherIDs = append(otherIDs, id)
+		}
+	}
+
+	hub.SendToUsers(otherIDs, notif)
+	notification.NotifyUsers(db, hub, attendeeIDs, notif)
+}
+
+// loadGroupEvent resolves the {gid}/{eid} path parts and checks that the
+// event belongs to the group and that userID is an accepted member.
+// It writes the error response and returns nil on failure.
+func loadGroupEvent(db *sql.DB, w http.ResponseWriter, userID int, groupIDStr, eventIDStr string) *database.Event {
+	groupID, err := database.ParseID(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil
+	}
+	eventID, err := database.ParseID(eventIDStr)
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return nil
+	}
+
+	canSee, err := authz.CanSeeGroup(db, userID, groupID)
+	if err != nil || !canSee {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	ev, err := database.GetEvent(db, eventID, userID)
+	if err == sql.ErrNoRows || (err == nil && ev.GroupID != groupID) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		fmt.Println("Error loading event:", err)
+		http.Error(w, "Failed to load event", http.StatusInternalServerError)
+		return nil
+	}
+	localizeEvent(ev)
+	return ev
+}
+
+// canManageEvent reports whether userID may edit or cancel the event:
+// its creator or an admin of its group.
+func canManageEvent(db *sql.DB, ev *database.Event, userID int) bool {
+	if ev.CreatorID == userID {
+		return true
+	}
+	isAdmin, err := database.IsGroupAdmin(db, ev.GroupID, userID)
+	return err == nil && isAdmin
+}
+
+// CreateEvent handles POST /create-event
+func CreateEvent(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req EventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+	if req.GroupID <= 0 {
+		http.Error(w, "Missing group_id", http.StatusBadRequest)
+		return
+	}
+	in, err := toEventInput(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := database.IsGroupMember(db, req.GroupID, userID)
+	if err != nil || !isMember {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	eventID, err := database.CreateEvent(db, req.GroupID, userID, in)
+	if err != nil {
+		fmt.Println("Error creating event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	ev, err := database.GetEvent(db, eventID, userID)
+	if err != nil {
+		fmt.Println("Error loading event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	localizeEvent(ev)
+
+	// Store and push to every member except the creator
+	memberIDs, err := getGroupMemberIDs(db, req.GroupID)
+	if err == nil {
+		notification.NotifyUsers(db, hub, memberIDs, &chat.NewGroupEvent{
+			Notice: chat.Notice{
+				From:      userID,
+				Username:  ev.CreatorUsername,
+				Content:   ev.Title + ": " + ev.Description,
+				Timestamp: time.Now(),
+			},
+			GroupID:   req.GroupID,
+			EventID:   eventID,
+			EventDate: ev.StartsAt.Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"event_id": eventID,
+		"event":    ev,
+	})
+}
+
+// GetGroupEvents handles GET /groups/{gid}/events
+func GetGroupEvents(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := database.ParseID(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	canSee, err := authz.CanSeeGroup(db, userID, groupID)
+	if err != nil || !canSee {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	events, err := database.GetGroupEvents(db, groupID, userID)
+	if err != nil {
+		fmt.Println("Error fetching group events:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	for i := range events {
+		localizeEvent(&events[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GetGroupEvent handles GET /groups/{gid}/events/{eid}
+func GetGroupEvent(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDStr, eventIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ev := loadGroupEvent(db, w, userID, groupIDStr, eventIDStr)
+	if ev == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ev)
+}
+
+// UpdateEvent handles PUT /groups/{gid}/events/{eid}. The body replaces every
+// editable field, so an omitted capacity makes the event unlimited.
+func UpdateEvent(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request, groupIDStr, eventIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ev := loadGroupEvent(db, w, userID, groupIDStr, eventIDStr)
+	if ev == nil {
+		return
+	}
+	if !canManageEvent(db, ev, userID) {
+		http.Error(w, "Only the event creator or a group admin can edit this event", http.StatusForbidden)
+		return
+	}
+
+	var req EventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+	in, err := toEventInput(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	promoted, err := database.UpdateEvent(db, ev.ID, in)
+	if err == database.ErrEventCancelled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error updating event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	ev, err = database.GetEvent(db, ev.ID, userID)
+	if err != nil {
+		fmt.Println("Error loading event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	localizeEvent(ev)
+	pushEvent(hub, ev, chat.GroupEventUpdated{
+		GroupID:   ev.GroupID,
+		EventID:   ev.ID,
+		EventDate: ev.StartsAt.Format(time.RFC3339),
+		From:      userID,
+		Username:  usernameOf(db, userID),
+		Event:     sharedEvent(ev),
+		Timestamp: time.Now(),
+	})
+	notifyPromoted(db, hub, ev, promoted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"event":   ev,
+	})
+}
+
+// CancelEvent handles POST /groups/{gid}/events/{eid}/cancel
+func CancelEvent(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request, groupIDStr, eventIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ev := loadGroupEvent(db, w, userID, groupIDStr, eventIDStr)
+	if ev == nil {
+		return
+	}
+	if !canManageEvent(db, ev, userID) {
+		http.Error(w, "Only the event creator or a group admin can cancel this event", http.StatusForbidden)
+		return
+	}
+
+	if err := database.CancelEvent(db, ev.ID); err == database.ErrEventCancelled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		fmt.Println("Error cancelling event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	ev, err := database.GetEvent(db, ev.ID, userID)
+	if err != nil {
+		fmt.Println("Error loading event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	localizeEvent(ev)
+	if hub != nil {
+		notifyCancelled(db, hub, userID, ev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"event":   ev,
+	})
+}
+
+// RSVPEvent handles POST /groups/{gid}/events/{eid}/rsvp {status}.
+// Asking to go to a full event puts the member on the waitlist.
+func RSVPEvent(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request, groupIDStr, eventIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RSVPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+	if status != database.RSVPGoing && status != database.RSVPMaybe && status != database.RSVPNotGoing {
+		http.Error(w, "status must be going, maybe or not_going", http.StatusBadRequest)
+		return
+	}
+
+	ev := loadGroupEvent(db, w, userID, groupIDStr, eventIDStr)
+	if ev == nil {
+		return
+	}
+
+	stored, promoted, err := database.SetEventRSVP(db, ev.ID, userID, status)
+	if err == database.ErrEventCancelled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error saving RSVP:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	ev, err = database.GetEvent(db, ev.ID, userID)
+	if err != nil {
+		fmt.Println("Error loading event:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	localizeEvent(ev)
+	pushEvent(hub, ev, chat.GroupEventRSVPUpdate{
+		GroupID:   ev.GroupID,
+		EventID:   ev.ID,
+		EventDate: ev.StartsAt.Format(time.RFC3339),
+		From:      userID,
+		Username:  usernameOf(db, userID),
+		UserVote:  stored,
+		Event:     sharedEvent(ev),
+		Timestamp: time.Now(),
+	})
+	notifyPromoted(db, hub, ev, promoted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"status":  stored,
+		"event":   ev,
+	})
+}
+
+// GetEventAttendees handles GET /groups/{gid}/events/{eid}/attendees
+func GetEventAttendees(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDStr, eventIDStr string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ev := loadGroupEvent(db, w, userID, groupIDStr, eventIDStr)
+	if ev == nil {
+		return
+	}
+
+	attendees, err := database.GetEventAttendees(db, ev.ID)
+	if err != nil {
+		fmt.Println("Error fetching attendees:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	grouped := map[string][]database.EventAttendee{
+		database.RSVPGoing:      {},
+		database.RSVPMaybe:      {},
+		database.RSVPNotGoing:   {},
+		database.RSVPWaitlisted: {},
+	}
+	for _, a := range attendees {
+		grouped[a.Status] = append(grouped[a.Status], a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"event_id":  ev.ID,
+		"going":     grouped[database.RSVPGoing],
+		"maybe":     grouped[database.RSVPMaybe],
+		"not_going": grouped[database.RSVPNotGoing],
+		"waitlist":  grouped[database.RSVPWaitlisted],
+	})
+}
@@ -3,6 +3,7 @@ package group
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,9 +12,12 @@ import (
 	"strings"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/notification"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
+	"socialnetwork/pkg/pagination"
 )
 
 // CreateGroup handles group creation
@@ -67,25 +71,18 @@ func CreateGroup(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reque
 
 	// Broadcast new group creation notification to ALL online users
 	if hub != nil {
-		notification := chat.Frontend{
-			Type:      "new_group_created",
-			From:      userID,
-			Username:  username,
-			GroupID:   int(groupID),
-			Content:   groupData.Title,
-			Timestamp: time.Now(),
+		newGroupNotif := &chat.NewGroup{
+			Notice: chat.Notice{
+				From:      userID,
+				Username:  username,
+				Content:   groupData.Title,
+				Timestamp: time.Now(),
+			},
+			GroupID: int(groupID),
 		}
 
-		// Broadcast to ALL connected users so everyone sees the new group
-		hub.Mutex.RLock()
-		for _, client := range hub.Clients {
-			select {
-			case client.Send <- notification:
-			default:
-				// Skip if buffer full
-			}
-		}
-		hub.Mutex.RUnlock()
+		// Store for every user and push to ALL connected users so everyone sees the new group
+		notification.NotifyAllUsers(db, hub, newGroupNotif)
 	}
 
 	// Send success response
@@ -237,28 +234,21 @@ func InviteUserToGroup(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http
 		var inviterUsername string
 		_ = db.QueryRow("SELECT username FROM users WHERE id = ?", inviterID).Scan(&inviterUsername)
 
-		notif := chat.Frontend{
-			Type:      "group_invitation",
-			From:      inviterID,
-			To:        inviteData.UserID,
-			Username:  inviterUsername,
-			GroupID:   inviteData.GroupID,
-			Content:   fmt.Sprintf("%s invited you to join a group", inviterUsername),
-			Timestamp: time.Now(),
+		notif := &chat.GroupInvitation{
+			Notice: chat.Notice{
+				From:      inviterID,
+				Username:  inviterUsername,
+				Content:   fmt.Sprintf("%s invited you to join a group", inviterUsername),
+				Timestamp: time.Now(),
+			},
+			GroupID: inviteData.GroupID,
 		}
 		// Only attach InvitationID if we successfully retrieved it
 		if invitationID > 0 {
 			notif.InvitationID = invitationID
 		}
 
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[inviteData.UserID]; ok {
-			select {
-			case client.Send <- notif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		notification.Notify(db, hub, inviteData.UserID, notif)
 	}
 
 	response := map[string]interface{}{
@@ -330,51 +320,36 @@ func RespondToGroupInvitation(db *sql.DB, hub *chat.Hub, w http.ResponseWriter,
 		db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 
 		// Notify the user who responded
-		userNotif := chat.Frontend{
-			Type:         "invitation_response",
-			From:         userID,
-			To:           userID,
-			Username:     username,
+		userNotif := chat.InvitationResponse{
+			Notice: chat.Notice{
+				From:      userID,
+				Username:  username,
+				Content:   fmt.Sprintf("You %s the group invitation", responseData.Status),
+				Timestamp: time.Now(),
+			},
 			GroupID:      groupID,
-			Content:      fmt.Sprintf("You %s the group invitation", responseData.Status),
 			InvitationID: responseData.InvitationID,
-			Timestamp:    time.Now(),
 		}
 
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[userID]; ok {
-			select {
-			case client.Send <- userNotif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.SendToUser(userID, userNotif)
 
 		// Notify the inviter
-		inviterNotif := chat.Frontend{
-			Type:         "invitation_response",
-			From:         userID,
-			To:           inviterID,
-			Username:     username,
+		inviterNotif := &chat.InvitationResponse{
+			Notice: chat.Notice{
+				From:      userID,
+				Username:  username,
+				Content:   fmt.Sprintf("%s %s your group invitation", username, responseData.Status),
+				Timestamp: time.Now(),
+			},
 			GroupID:      groupID,
-			Content:      fmt.Sprintf("%s %s your group invitation", username, responseData.Status),
 			InvitationID: responseData.InvitationID,
-			Timestamp:    time.Now(),
 		}
 
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[inviterID]; ok {
-			select {
-			case client.Send <- inviterNotif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		notification.Notify(db, hub, inviterID, inviterNotif)
 
 		// If accepted, broadcast to all group members
 		if responseData.Status == "accepted" {
-			memberNotif := chat.Frontend{
-				Type:      "group_member_update",
+			memberNotif := chat.GroupMemberUpdate{
 				From:      userID,
 				Username:  username,
 				GroupID:   groupID,
@@ -383,14 +358,7 @@ func RespondToGroupInvitation(db *sql.DB, hub *chat.Hub, w http.ResponseWriter,
 			}
 
 			// Broadcast to ALL connected users
-			hub.Mutex.RLock()
-			for _, client := range hub.Clients {
-				select {
-				case client.Send <- memberNotif:
-				default:
-				}
-			}
-			hub.Mutex.RUnlock()
+			hub.BroadcastToAll(memberNotif)
 		}
 	}
 
@@ -562,8 +530,7 @@ func LeaveGroup(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reques
 		var username string
 		db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 
-		notification := chat.Frontend{
-			Type:      "group_member_left",
+		notification := chat.GroupMemberLeft{
 			From:      userID,
 			Username:  username,
 			GroupID:   leaveData.GroupID,
@@ -572,14 +539,7 @@ func LeaveGroup(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reques
 		}
 
 		// Broadcast to ALL connected users
-		hub.Mutex.RLock()
-		for _, client := range hub.Clients {
-			select {
-			case client.Send <- notification:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.BroadcastToAll(notification)
 	}
 
 	response := map[string]interface{}{
@@ -603,34 +563,23 @@ func sendJoinRequestNotification(db *sql.DB, hub *chat.Hub, userID int, groupID
 	db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", groupID).Scan(&creatorID)
 
 	// Notify the requesting user
-	userNotif := chat.Frontend{
-		Type:      "join_request_sent",
+	userNotif := chat.JoinRequestSent{
 		From:      userID,
-		To:        userID,
 		Username:  username,
 		GroupID:   groupID,
 		Content:   "Join request pending approval",
 		Timestamp: time.Now(),
 	}
 
-	hub.Mutex.RLock()
-	if client, ok := hub.Clients[userID]; ok {
-		select {
-		case client.Send <- userNotif:
-		default:
-		}
-	}
-	hub.Mutex.RUnlock()
-
 	// Notify the group admin/creator
-	adminNotif := chat.Frontend{
-		Type:      "group_join_request",
-		From:      userID,
-		To:        creatorID,
-		Username:  username,
-		GroupID:   groupID,
-		Content:   fmt.Sprintf("%s requested to join your group", username),
-		Timestamp: time.Now(),
+	adminNotif := &chat.GroupJoinRequest{
+		Notice: chat.Notice{
+			From:      userID,
+			Username:  username,
+			Content:   fmt.Sprintf("%s requested to join your group", username),
+			Timestamp: time.Now(),
+		},
+		GroupID: groupID,
 	}
 
 	// Try to include the join request ID so admin can accept/decline
@@ -641,14 +590,8 @@ func sendJoinRequestNotification(db *sql.DB, hub *chat.Hub, userID int, groupID
 		userNotif.RequestID = requestID
 	}
 
-	hub.Mutex.RLock()
-	if client, ok := hub.Clients[creatorID]; ok {
-		select {
-		case client.Send <- adminNotif:
-		default:
-		}
-	}
-	hub.Mutex.RUnlock()
+	hub.SendToUser(userID, userNotif)
+	notification.Notify(db, hub, creatorID, adminNotif)
 }
 
 // GetUserGroups returns groups where user is a member
@@ -716,20 +659,29 @@ func GetGroupPosts(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDSt
 		http.Error(w, "Invalid group ID", http.StatusBadRequest)
 		return
 	}
-	isMember, err := database.IsGroupMember(db, groupID, userID)
-	if err != nil || !isMember {
+	canSee, err := authz.CanSeeGroup(db, userID, groupID)
+	if err != nil || !canSee {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	posts, err := database.GetGroupPosts(db, groupID, userID)
+	page, err := pagination.Parse(r, 20, pagination.NewestFirst)
+	if err != nil {
+		pagination.WriteError(w, err)
+		return
+	}
+
+	posts, nextCursor, err := database.GetGroupPosts(db, groupID, userID, page)
 	if err != nil {
 		fmt.Println("GetGroupPosts error:", err)
 		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
 }
 
 func HandleGetGroupPostComments(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDStr, postIDStr string) {
@@ -755,8 +707,8 @@ func HandleGetGroupPostComments(db *sql.DB, w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	isMember, err := database.IsGroupMember(db, groupID, userID)
-	if err != nil || !isMember {
+	canSee, err := authz.CanSeeGroup(db, userID, groupID)
+	if err != nil || !canSee {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -794,18 +746,23 @@ func HandleGetGroupPostComments(db *sql.DB, w http.ResponseWriter, r *http.Reque
 		"type":       "group",
 	}
 
-	comments, err := database.GetGroupPostComments(db, postID)
-	if err == sql.ErrNoRows {
-		comments = []map[string]interface{}{}
-	} else if err != nil {
+	page, err := pagination.Parse(r, 20, pagination.OldestFirst)
+	if err != nil {
+		pagination.WriteError(w, err)
+		return
+	}
+
+	comments, nextCursor, err := database.GetGroupPostComments(db, postID, page)
+	if err != nil {
 		http.Error(w, "failed to load comments", http.StatusInternalServerError)
 		return
 	}
 
 	// Return both post and comments
 	response := map[string]interface{}{
-		"post":     post,
-		"comments": comments,
+		"post":        post,
+		"comments":    comments,
+		"next_cursor": nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -836,9 +793,7 @@ func ToggleGroupPostLike(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 		return
 	}
 
-	isMember, err := database.IsGroupMember(db, groupID, userID)
-	if err != nil || !isMember {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !checkGroupPost(db, w, userID, groupID, postID, "Forbidden") {
 		return
 	}
 
@@ -876,31 +831,16 @@ func ToggleGroupPostLike(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 		}
 		countsJSON, _ := json.Marshal(countsData)
 
-		likeNotification := chat.Frontend{
-			Type:      "group_post_like_update",
+		likeNotification := chat.GroupPostLikeUpdate{
 			From:      userID,
 			Username:  username,
 			GroupID:   groupID,
-			PostId:    postID,
+			PostID:    postID,
 			Content:   string(countsJSON),
 			Timestamp: time.Now(),
 		}
 
-		// Get group member IDs
-		memberIDs, err := getGroupMemberIDs(db, groupID)
-		if err == nil {
-			hub.Mutex.RLock()
-			for _, memberID := range memberIDs {
-				if client, ok := hub.Clients[memberID]; ok {
-					select {
-					case client.Send <- likeNotification:
-					default:
-						// Skip if buffer full
-					}
-				}
-			}
-			hub.Mutex.RUnlock()
-		}
+		hub.SendToGroup(groupID, likeNotification)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -938,9 +878,7 @@ func AddGroupPostComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 		return
 	}
 
-	isMember, err := database.IsGroupMember(db, groupID, userID)
-	if err != nil || !isMember {
-		http.Error(w, "You must be an accepted member to comment", http.StatusForbidden)
+	if !checkGroupPost(db, w, userID, groupID, groupPostID, "You must be an accepted member to comment") {
 		return
 	}
 
@@ -982,7 +920,8 @@ func AddGroupPostComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 	// Broadcast comment notification to all group members
 	if hub != nil {
 		// Fetch the full comment data for broadcast
-		comments, err := database.GetGroupPostComments(db, groupPostID)
+		// The new comment is the newest one on the post
+		comments, _, err := database.GetGroupPostComments(db, groupPostID, pagination.Page{Limit: 1, Order: pagination.NewestFirst})
 		var newComment map[string]interface{}
 		if err == nil {
 			for _, c := range comments {
@@ -993,32 +932,17 @@ func AddGroupPostComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 			}
 		}
 		commentJSON, _ := json.Marshal(newComment)
-		commentNotification := chat.Frontend{
-			Type:      "group_post_comment",
+		commentNotification := chat.GroupPostComment{
 			From:      userID,
 			Username:  username,
 			GroupID:   groupID,
-			PostId:    groupPostID,
-			CommentId: int(commentID),
+			PostID:    groupPostID,
+			CommentID: int(commentID),
 			Content:   string(commentJSON),
 			Timestamp: time.Now(),
 		}
 
-		// Get group member IDs
-		memberIDs, err := getGroupMemberIDs(db, groupID)
-		if err == nil {
-			hub.Mutex.RLock()
-			for _, memberID := range memberIDs {
-				if client, ok := hub.Clients[memberID]; ok {
-					select {
-					case client.Send <- commentNotification:
-					default:
-						// Skip if buffer full
-					}
-				}
-			}
-			hub.Mutex.RUnlock()
-		}
+		hub.SendToGroup(groupID, commentNotification)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1075,7 +999,7 @@ func DeleteGroupPost(db *sql.DB, w http.ResponseWriter, r *http.Request, groupID
 		return
 	}
 	if userID != ownerID && !isAdmin {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		authz.Forbidden(w, "Only the author or a group admin can delete this post")
 		return
 	}
 
@@ -1190,7 +1114,8 @@ func CreateGroupPost(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.R
 	// Broadcast new group post to all group members via WebSocket
 	if hub != nil {
 		// Fetch the full post data for broadcast
-		posts, err := database.GetGroupPosts(db, groupID, userID)
+		// The new post is the newest one in the group
+		posts, _, err := database.GetGroupPosts(db, groupID, userID, pagination.Page{Limit: 1})
 		var newPost map[string]interface{}
 		if err == nil {
 			for _, p := range posts {
@@ -1201,31 +1126,16 @@ func CreateGroupPost(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.R
 			}
 		}
 		postJSON, _ := json.Marshal(newPost)
-		postNotification := chat.Frontend{
-			Type:      "new_groupPost",
+		postNotification := chat.NewGroupPost{
 			From:      userID,
 			Username:  username,
 			GroupID:   groupID,
-			PostId:    postID,
+			PostID:    postID,
 			Content:   string(postJSON),
 			Timestamp: time.Now(),
 		}
 
-		// Get group member IDs
-		memberIDs, err := getGroupMemberIDs(db, groupID)
-		if err == nil {
-			hub.Mutex.RLock()
-			for _, memberID := range memberIDs {
-				if client, ok := hub.Clients[memberID]; ok {
-					select {
-					case client.Send <- postNotification:
-					default:
-						// Skip if buffer full
-					}
-				}
-			}
-			hub.Mutex.RUnlock()
-		}
+		hub.SendToGroup(groupID, postNotification)
 	}
 
 	resp := map[string]any{
@@ -1244,6 +1154,35 @@ func CreateGroupPost(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(resp)
 }
 
+// checkGroupPost reports whether userID may react to postID as a post of
+// groupID. If not, it writes the error response: the post must exist, belong
+// to that group and be visible to the user.
+func checkGroupPost(db *sql.DB, w http.ResponseWriter, userID, groupID, postID int, forbidden string) bool {
+	canSee, err := authz.CanSeeGroupPost(db, userID, postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return false
+	}
+	if !canSee {
+		authz.Forbidden(w, forbidden)
+		return false
+	}
+	postGroupID, _, err := database.GetGroupPostOwnerAndGroup(db, postID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return false
+	}
+	if postGroupID != groupID {
+		http.Error(w, "Post does not belong to this group", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
 // Helper function to get group member IDs
 func getGroupMemberIDs(db *sql.DB, groupID int) ([]int, error) {
 	rows, err := db.Query(`
@@ -1292,10 +1231,7 @@ func ToggleGroupPostDislike(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r
 		return
 	}
 
-	// must be accepted member
-	isMember, err := database.IsGroupMember(db, groupID, userID)
-	if err != nil || !isMember {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !checkGroupPost(db, w, userID, groupID, postID, "Forbidden") {
 		return
 	}
 
@@ -1333,31 +1269,16 @@ func ToggleGroupPostDislike(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r
 		}
 		countsJSON, _ := json.Marshal(countsData)
 
-		dislikeNotification := chat.Frontend{
-			Type:      "group_post_like_update",
+		dislikeNotification := chat.GroupPostLikeUpdate{
 			From:      userID,
 			Username:  username,
 			GroupID:   groupID,
-			PostId:    postID,
+			PostID:    postID,
 			Content:   string(countsJSON),
 			Timestamp: time.Now(),
 		}
 
-		// Get group member IDs
-		memberIDs, err := getGroupMemberIDs(db, groupID)
-		if err == nil {
-			hub.Mutex.RLock()
-			for _, memberID := range memberIDs {
-				if client, ok := hub.Clients[memberID]; ok {
-					select {
-					case client.Send <- dislikeNotification:
-					default:
-						// Skip if buffer full
-					}
-				}
-			}
-			hub.Mutex.RUnlock()
-		}
+		hub.SendToGroup(groupID, dislikeNotification)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
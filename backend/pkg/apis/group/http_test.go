@@ -0,0 +1,139 @@
+package group
+
+import (
+	"bytes"
+	"database/sql"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"socialnetwork/pkg/db/sqlite"
+)
+
+// newTestDB returns a migrated database with three groups, each with one
+// post. User 1 is logged in with the session "s1" and is an accepted member
+// of groups 1 and 3 only.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	migrations, err := filepath.Abs("../../db/migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlite.ConnectAndMigrate(filepath.Join(t.TempDir(), "test.db"), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, q := range []string{
+		`INSERT INTO users (id, username, firstname, lastname, age, gender, email, password) VALUES
+			(1, 'member', 'F', 'L', '20', 'other', 'm@example.com', 'x'),
+			(2, 'owner', 'F', 'L', '20', 'other', 'o@example.com', 'x')`,
+		`INSERT INTO groups (id, title, description, creator_id) VALUES
+			(1, 'open', 'd', 1), (2, 'closed', 'd', 2), (3, 'other', 'd', 2)`,
+		`INSERT INTO group_members (group_id, user_id, status) VALUES
+			(1, 1, 'accepted'), (2, 2, 'accepted'), (3, 1, 'accepted'), (3, 2, 'accepted')`,
+		`INSERT INTO group_posts (id, group_id, user_id, title, content, imgOrgif) VALUES
+			(1, 1, 1, 't', 'c', ''), (2, 2, 2, 't', 'c', ''), (3, 3, 2, 't', 'c', '')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO sessions (user_id, token, expires_at) VALUES (1, 's1', ?)`, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// crossGroupCases are posts user 1 addresses through group 1: their own
+// group's post, a post of a group they are not in, a post of another group
+// they are in, and a post that does not exist.
+var crossGroupCases = []struct {
+	post string
+	code int
+}{
+	{"1", http.StatusOK},
+	{"2", http.StatusForbidden},
+	{"3", http.StatusBadRequest},
+	{"9", http.StatusNotFound},
+}
+
+func count(t *testing.T, db *sql.DB, query, post string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, post).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestGroupPostReactionsStayInTheirGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		handle func(*sql.DB, http.ResponseWriter, *http.Request)
+		table  string
+	}{
+		{"like", func(db *sql.DB, w http.ResponseWriter, r *http.Request) { ToggleGroupPostLike(db, nil, w, r) }, "group_post_likes"},
+		{"dislike", func(db *sql.DB, w http.ResponseWriter, r *http.Request) { ToggleGroupPostDislike(db, nil, w, r) }, "group_post_dislikes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for _, c := range crossGroupCases {
+				req := httptest.NewRequest(http.MethodPost, "/groups/likes?groupId=1&postId="+c.post, nil)
+				req.AddCookie(&http.Cookie{Name: "session_token", Value: "s1"})
+				rec := httptest.NewRecorder()
+				tc.handle(db, rec, req)
+				if rec.Code != c.code {
+					t.Errorf("post %s: status %d, want %d", c.post, rec.Code, c.code)
+				}
+
+				want := 0
+				if c.code == http.StatusOK {
+					want = 1
+				}
+				if n := count(t, db, `SELECT COUNT(*) FROM `+tc.table+` WHERE group_post_id = ?`, c.post); n != want {
+					t.Errorf("post %s: %d rows, want %d", c.post, n, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupPostCommentsStayInTheirGroup(t *testing.T) {
+	db := newTestDB(t)
+	for _, c := range crossGroupCases {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("group_id", "1")
+		form.WriteField("group_post_id", c.post)
+		form.WriteField("content", "hello")
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/groups/comments", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: "s1"})
+		rec := httptest.NewRecorder()
+		AddGroupPostComment(db, nil, rec, req)
+
+		code := c.code
+		if code == http.StatusOK {
+			code = http.StatusCreated
+		}
+		if rec.Code != code {
+			t.Errorf("post %s: status %d, want %d", c.post, rec.Code, code)
+		}
+
+		want := 0
+		if code == http.StatusCreated {
+			want = 1
+		}
+		if n := count(t, db, `SELECT COUNT(*) FROM group_post_comments WHERE group_post_id = ?`, c.post); n != want {
+			t.Errorf("post %s: %d comments, want %d", c.post, n, want)
+		}
+	}
+}
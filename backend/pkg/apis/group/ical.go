@@ -0,0 +1,283 @@
+package group
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"socialnetwork/pkg/apis/authz"
+	u "socialnetwork/pkg/apis/user"
+	database "socialnetwork/pkg/db"
+)
+
+// iCalendar (RFC 5545) export of group events.
+
+const icsTimeLayout = "20060102T150405Z"
+
+// icsEscaper escapes TEXT property values (RFC 5545 section 3.3.11).
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// rsvpPartstat maps an RSVP status to the attendee's PARTSTAT. Waitlisted
+// members have not been given a place yet, so their answer is still open.
+var rsvpPartstat = map[string]string{
+	database.RSVPGoing:      "ACCEPTED",
+	database.RSVPMaybe:      "TENTATIVE",
+	database.RSVPNotGoing:   "DECLINED",
+	database.RSVPWaitlisted: "NEEDS-ACTION",
+}
+
+type icsWriter struct {
+	b strings.Builder
+}
+
+// line writes one content line, folded at 75 octets without splitting a
+// UTF-8 sequence, and terminated by CRLF.
+func (w *icsWriter) line(name, value string) {
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(s[:cut])
+		w.b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // the leading space counts towards the next line
+	}
+	w.b.WriteString(s)
+	w.b.WriteString("\r\n")
+}
+
+func (w *icsWriter) text(name, value string) {
+	w.line(name, icsEscaper.Replace(value))
+}
+
+// icsParam quotes a parameter value; DQUOTE itself is not allowed inside.
+func icsParam(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "'") + `"`
+}
+
+// writeCalendar renders events as a VCALENDAR. The viewer's own RSVP is
+// added to each event as an ATTENDEE so calendar clients show it.
+func writeCalendar(name string, events []database.Event, username, email string) string {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//socialnetwork//events//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", name)
+
+	now := time.Now().UTC()
+	for _, ev := range events {
+		stamp := ev.CreatedAt
+		if ev.UpdatedAt != nil {
+			stamp = *ev.UpdatedAt
+		}
+
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("event-%d@socialnetwork", ev.ID))
+		w.line("DTSTAMP", now.Format(icsTimeLayout))
+		w.line("CREATED", ev.CreatedAt.UTC().Format(icsTimeLayout))
+		w.line("LAST-MODIFIED", stamp.UTC().Format(icsTimeLayout))
+		w.line("DTSTART", ev.StartsAt.UTC().Format(icsTimeLayout))
+		if ev.EndsAt != nil {
+			w.line("DTEND", ev.EndsAt.UTC().Format(icsTimeLayout))
+		}
+		summary := ev.Title
+		if ev.GroupTitle != "" {
+			summary += " (" + ev.GroupTitle + ")"
+		}
+		w.text("SUMMARY", summary)
+
+		description := ev.Description
+		if ev.UserRSVP == database.RSVPWaitlisted {
+			description += fmt.Sprintf("\n\nYou are number %d on the waitlist.", ev.WaitlistPosition)
+		}
+		w.text("DESCRIPTION", description)
+		if ev.Location != "" {
+			w.text("LOCATION", ev.Location)
+		}
+		if ev.CreatorUsername != "" {
+			w.line("ORGANIZER;CN="+icsParam(ev.CreatorUsername), "urn:socialnetwork:user:"+fmt.Sprint(ev.CreatorID))
+		}
+		if ev.Cancelled {
+			w.line("STATUS", "CANCELLED")
+		} else {
+			w.line("STATUS", "CONFIRMED")
+		}
+		if partstat, ok := rsvpPartstat[ev.UserRSVP]; ok && email != "" {
+			w.line("ATTENDEE;CN="+icsParam(username)+";PARTSTAT="+partstat, "mailto:"+email)
+		}
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.b.String()
+}
+
+func writeICS(w http.ResponseWriter, filename, body string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write([]byte(body))
+}
+
+// GroupEventsICS handles GET /groups/{gid}/events.ics for a member of the group.
+func GroupEventsICS(db *sql.DB, w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := database.ParseID(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	canSee, err := authz.CanSeeGroup(db, userID, groupID)
+	if err != nil || !canSee {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	events, err := database.GetGroupEvents(db, groupID, userID)
+	if err != nil {
+		fmt.Println("Error getting group events:", err)
+		http.Error(w, "Failed to get events", http.StatusInternalServerError)
+		return
+	}
+	username, email, err := database.GetUserContact(db, userID)
+	if err != nil {
+		fmt.Println("Error getting user contact:", err)
+		http.Error(w, "Failed to get events", http.StatusInternalServerError)
+		return
+	}
+
+	name := "Group events"
+	if len(events) > 0 && events[0].GroupTitle != "" {
+		name = events[0].GroupTitle + " events"
+	}
+	writeICS(w, fmt.Sprintf("group-%d-events.ics", groupID), writeCalendar(name, events, username, email))
+}
+
+// CalendarFeed handles GET /calendar/{token}.ics, the subscribable feed of
+// every event in the token owner's groups. The token stands in for the
+// session cookie, which calendar clients do not send.
+func CalendarFeed(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/calendar/"), ".ics")
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID, err := database.GetUserIDByCalendarToken(db, token)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error looking up calendar token:", err)
+		http.Error(w, "Failed to get events", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := database.GetUserEvents(db, userID)
+	if err != nil {
+		fmt.Println("Error getting user events:", err)
+		http.Error(w, "Failed to get events", http.StatusInternalServerError)
+		return
+	}
+	username, email, err := database.GetUserContact(db, userID)
+	if err != nil {
+		fmt.Println("Error getting user contact:", err)
+		http.Error(w, "Failed to get events", http.StatusInternalServerError)
+		return
+	}
+	writeICS(w, "events.ics", writeCalendar("My group events", events, username, email))
+}
+
+// calendarFeedURL builds the absolute URL of a feed token for the response.
+func calendarFeedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/calendar/" + token + ".ics"
+}
+
+// CalendarFeedToken handles /calendar/feed. GET returns the user's feed URL,
+// issuing a token on first use; DELETE revokes it.
+func CalendarFeedToken(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		token, err := database.GetCalendarToken(db, userID)
+		if err == nil && token == "" {
+			token, err = database.CreateCalendarToken(db, userID)
+		}
+		if err != nil {
+			fmt.Println("Error getting calendar token:", err)
+			http.Error(w, "Failed to get calendar feed", http.StatusInternalServerError)
+			return
+		}
+		writeFeedToken(w, r, token)
+	case http.MethodDelete:
+		if err := database.DeleteCalendarToken(db, userID); err != nil {
+			fmt.Println("Error revoking calendar token:", err)
+			http.Error(w, "Failed to revoke calendar feed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ResetCalendarFeedToken handles POST /calendar/feed/reset: the old feed URL
+// stops working and a new one is returned.
+func ResetCalendarFeedToken(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	token, err := database.CreateCalendarToken(db, userID)
+	if err != nil {
+		fmt.Println("Error resetting calendar token:", err)
+		http.Error(w, "Failed to reset calendar feed", http.StatusInternalServerError)
+		return
+	}
+	writeFeedToken(w, r, token)
+}
+
+func writeFeedToken(w http.ResponseWriter, r *http.Request, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"token":    token,
+		"feed_url": calendarFeedURL(r, token),
+	})
+}
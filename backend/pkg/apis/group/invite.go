@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/notification"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
 )
@@ -226,24 +227,17 @@ func SendBulkInvitations(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 				}
 
 				if wasSuccessful {
-					notification := chat.Frontend{
-						Type:      "group_invitation",
-						From:      inviterID,
-						To:        userID,
-						Username:  inviterUsername,
-						GroupID:   inviteData.GroupID,
-						Content:   fmt.Sprintf("%s invited you to join a group", inviterUsername),
-						Timestamp: time.Now(),
+					notif := &chat.GroupInvitation{
+						Notice: chat.Notice{
+							From:      inviterID,
+							Username:  inviterUsername,
+							Content:   fmt.Sprintf("%s invited you to join a group", inviterUsername),
+							Timestamp: time.Now(),
+						},
+						GroupID: inviteData.GroupID,
 					}
 
-					hub.Mutex.RLock()
-					if client, ok := hub.Clients[userID]; ok {
-						select {
-						case client.Send <- notification:
-						default:
-						}
-					}
-					hub.Mutex.RUnlock()
+					notification.Notify(db, hub, userID, notif)
 				}
 			}
 		}
@@ -90,3 +90,21 @@ type CreateGroupCommentRequest struct {
 	GroupPostID int    `json:"group_post_id"`
 	Content     string `json:"content"`
 }
+
+// EventRequest is the body of event create (/create-event) and edit requests.
+// Times are RFC 3339, or local wall-clock times ("2006-01-02T15:04") in Timezone.
+type EventRequest struct {
+	GroupID     int    `json:"group_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	StartsAt    string `json:"starts_at"`
+	EndsAt      string `json:"ends_at"`
+	Timezone    string `json:"timezone"` // IANA name, defaults to UTC
+	Location    string `json:"location"`
+	Capacity    *int   `json:"capacity"`   // omit or null for unlimited
+	EventDate   string `json:"event_date"` // older clients send the start time here
+}
+
+type RSVPRequest struct {
+	Status string `json:"status"` // "going", "maybe" or "not_going"
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/notification"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
 )
@@ -74,14 +76,13 @@ func RespondToJoinRequest(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *h
 	// Get the user_id and group_id from the membership record before updating
 	var targetUserID, groupID int
 	err := db.QueryRow(`
-		SELECT gm.user_id, gm.group_id 
-		FROM group_members gm
-		JOIN groups g ON gm.group_id = g.id
-		WHERE gm.id = ? AND g.creator_id = ? AND gm.status = 'pending'
-	`, requestData.RequestID, adminUserID).Scan(&targetUserID, &groupID)
+		SELECT user_id, group_id
+		FROM group_members
+		WHERE id = ? AND status = 'pending'
+	`, requestData.RequestID).Scan(&targetUserID, &groupID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "Not authorized or request not found", http.StatusForbidden)
+			http.Error(w, "Join request not found", http.StatusNotFound)
 		} else {
 			fmt.Println("Error fetching request details:", err)
 			http.Error(w, "Failed to process request", http.StatusInternalServerError)
@@ -89,8 +90,12 @@ func RespondToJoinRequest(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *h
 		return
 	}
 
-	// Update the status
+	// Update the status; this checks again that the user is an admin of the group
 	err = database.UpdateGroupMemberStatus(db, requestData.RequestID, adminUserID, requestData.Status)
+	if err == sql.ErrNoRows {
+		authz.Forbidden(w, "Only group admins can answer join requests")
+		return
+	}
 	if err != nil {
 		fmt.Println("Error updating join request status:", err)
 		http.Error(w, "Failed to update join request", http.StatusInternalServerError)
@@ -103,45 +108,28 @@ func RespondToJoinRequest(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *h
 
 	// Broadcast notification to the user whose request was approved/declined
 	if hub != nil && targetUserID > 0 {
-		notification := chat.Frontend{
-			Type:      "group_request_response",
-			From:      adminUserID,
-			To:        targetUserID,
-			Username:  adminUsername,
-			GroupID:   groupID,
-			Content:   fmt.Sprintf("Your group join request has been %s", requestData.Status),
-			Timestamp: time.Now(),
+		notif := &chat.GroupRequestResponse{
+			Notice: chat.Notice{
+				From:      adminUserID,
+				Username:  adminUsername,
+				Content:   fmt.Sprintf("Your group join request has been %s", requestData.Status),
+				Timestamp: time.Now(),
+			},
+			GroupID: groupID,
 		}
 
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[targetUserID]; ok {
-			select {
-			case client.Send <- notification:
-			default:
-				// Skip if buffer full
-			}
-		}
-		hub.Mutex.RUnlock()
+		notification.Notify(db, hub, targetUserID, notif)
 
 		// Also notify the admin (refresh their pending list)
-		adminNotif := chat.Frontend{
-			Type:      "group_member_update",
+		adminNotif := chat.GroupMemberUpdate{
 			From:      targetUserID,
-			To:        adminUserID,
 			Username:  adminUsername,
 			GroupID:   groupID,
 			Content:   fmt.Sprintf("Join request %s", requestData.Status),
 			Timestamp: time.Now(),
 		}
 
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[adminUserID]; ok {
-			select {
-			case client.Send <- adminNotif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.SendToUser(adminUserID, adminNotif)
 	}
 
 	response := map[string]interface{}{
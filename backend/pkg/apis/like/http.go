@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	"socialnetwork/pkg/apis/chat"
 	u "socialnetwork/pkg/apis/user"
 )
@@ -43,6 +44,11 @@ func (c *LikesController) LikeDislikePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	visible, err := authz.CanSeePost(db, userID, *req.PostID)
+	if !canSee(w, visible, err) {
+		return
+	}
+
 	like, err := c.s.CheckPostInteractions(r.Context(), userID, *req.PostID)
 	if errors.Is(err, sql.ErrNoRows) {
 		if err = c.s.InteractWithPost(r.Context(), userID, *req.PostID, req.IsLike); err != nil {
@@ -78,13 +84,6 @@ func (c *LikesController) LikeDislikePost(w http.ResponseWriter, r *http.Request
 
 	// Broadcast like/dislike update via WebSocket to all connected users
 	if c.hub != nil {
-		likeNotification := chat.Frontend{
-			Type:      "new_postLike",
-			From:      userID,
-			PostId:    *req.PostID,
-			Timestamp: time.Now(),
-		}
-
 		// Add the updated counts as a JSON payload in Content
 		countsData := map[string]interface{}{
 			"post_id":        *req.PostID,
@@ -92,18 +91,15 @@ func (c *LikesController) LikeDislikePost(w http.ResponseWriter, r *http.Request
 			"dislikes_count": updatedCounts.Dislikes,
 		}
 		countsJSON, _ := json.Marshal(countsData)
-		likeNotification.Content = string(countsJSON)
-
-		// Broadcast to all clients
-		c.hub.Mutex.RLock()
-		for _, client := range c.hub.Clients {
-			select {
-			case client.Send <- likeNotification:
-			default:
-				// Skip if client buffer is full
-			}
+		likeNotification := chat.PostLikeUpdate{
+			PostID:    *req.PostID,
+			From:      userID,
+			Content:   string(countsJSON),
+			Timestamp: time.Now(),
 		}
-		c.hub.Mutex.RUnlock()
+
+		// Broadcast to everyone who can see the post
+		c.hub.SendToPostAudience(*req.PostID, likeNotification)
 	}
 
 	//  Send JSON response with updated counts
@@ -143,6 +139,16 @@ func (c *LikesController) InteractWithComment(w http.ResponseWriter, r *http.Req
 
 	fmt.Println(" User is logged in:", userID)
 
+	// The comment's post decides who may react and who hears about it
+	visible := false
+	postID, err := authz.CommentPostID(db, *req.CommentID)
+	if err == nil {
+		visible, err = authz.CanSeePost(db, userID, postID)
+	}
+	if !canSee(w, visible, err) {
+		return
+	}
+
 	// Check if interaction exists
 	like, err := c.s.CheckCommentInteractions(r.Context(), userID, *req.CommentID)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -187,13 +193,6 @@ func (c *LikesController) InteractWithComment(w http.ResponseWriter, r *http.Req
 
 	// Broadcast comment like update via WebSocket to all connected users
 	if c.hub != nil {
-		commentLikeNotification := chat.Frontend{
-			Type:      "new_commentLike",
-			From:      userID,
-			CommentId: *req.CommentID,
-			Timestamp: time.Now(),
-		}
-
 		// Add the updated counts as a JSON payload in Content
 		countsData := map[string]interface{}{
 			"comment_id":     *req.CommentID,
@@ -201,18 +200,15 @@ func (c *LikesController) InteractWithComment(w http.ResponseWriter, r *http.Req
 			"dislikes_count": updatedCounts.Dislikes,
 		}
 		countsJSON, _ := json.Marshal(countsData)
-		commentLikeNotification.Content = string(countsJSON)
-
-		// Broadcast to all clients
-		c.hub.Mutex.RLock()
-		for _, client := range c.hub.Clients {
-			select {
-			case client.Send <- commentLikeNotification:
-			default:
-				// Skip if client buffer is full
-			}
+		commentLikeNotification := chat.CommentLikeUpdate{
+			CommentID: *req.CommentID,
+			From:      userID,
+			Content:   string(countsJSON),
+			Timestamp: time.Now(),
 		}
-		c.hub.Mutex.RUnlock()
+
+		// Broadcast to everyone who can see the comment's post
+		c.hub.SendToPostAudience(postID, commentLikeNotification)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -223,21 +219,36 @@ func (c *LikesController) InteractWithComment(w http.ResponseWriter, r *http.Req
 	})
 }
 
-func (c *LikesController) GetInteractions(w http.ResponseWriter, r *http.Request) {
+func (c *LikesController) GetInteractions(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	var req GetInteractionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		slog.ErrorContext(r.Context(), "Error decoding request body", "err", err)
 		return
 	}
 
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
 	var resp GetInteractionsResponse
+	var visible bool
 	var err error
 	if req.PostID != nil {
+		visible, err = authz.CanSeePost(db, userID, *req.PostID)
+		if !canSee(w, visible, err) {
+			return
+		}
 		resp, err = c.s.GetPostsInteractions(r.Context(), *req.PostID)
 		if err != nil {
 			return
 		}
 	} else if req.CommentID != nil {
+		visible, err = authz.CanSeeComment(db, userID, *req.CommentID)
+		if !canSee(w, visible, err) {
+			return
+		}
 		resp, err = c.s.GetCommentsInteractions(r.Context(), *req.CommentID)
 		if err != nil {
 			return
@@ -256,3 +267,18 @@ func (c *LikesController) GetInteractions(w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// canSee writes the error response for a failed visibility check. Content
+// the user may not see is reported as missing.
+func canSee(w http.ResponseWriter, visible bool, err error) bool {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("Error checking visibility", "err", err)
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// Package mail sends the transactional emails of the site (password resets,
+// address verification). Handlers depend on the Mailer interface; the server
+// picks an implementation from the environment with FromEnv:
+//
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD  deliver through an SMTP server
+//	MAIL_FROM                                            sender address
+//	MAIL_DIR                                             without SMTP_HOST, write each message to a file here
+//
+// With neither SMTP_HOST nor MAIL_DIR set, messages are printed to the log.
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultFrom is the sender used when MAIL_FROM is not set.
+const DefaultFrom = "no-reply@socialnetwork.local"
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromEnv returns the Mailer configured by the environment.
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = DefaultFrom
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+	return &FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+}
+
+// SMTPMailer sends messages through an SMTP server. smtp.SendMail upgrades
+// to TLS when the server offers STARTTLS; PLAIN auth is only used if
+// Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// FileMailer is the development and test Mailer. It writes each message as
+// an .eml file in Dir, or prints it to stdout if Dir is empty.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+var fileSeq atomic.Int64
+
+func (m *FileMailer) Send(msg Message) error {
+	data := format(m.From, msg)
+	if m.Dir == "" {
+		fmt.Printf("📧 Mail to %s\n%s\n", msg.To, data)
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405"), fileSeq.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// headerSanitizer keeps user supplied values from adding header lines.
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders msg as an RFC 5322 message with CRLF line endings.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerSanitizer.Replace(from) + "\r\n")
+	b.WriteString("To: " + headerSanitizer.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerSanitizer.Replace(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
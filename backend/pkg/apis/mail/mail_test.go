@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: DefaultFrom}
+
+	msgs := []Message{
+		{To: "a@example.com", Subject: "Hello", Body: "line one\nline two"},
+		{To: "b@example.com\r\nBcc: evil@example.com", Subject: "Héllo", Body: "x"},
+	}
+	for _, msg := range msgs {
+		if err := m.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(msgs) {
+		t.Fatalf("wrote %d files, want %d", len(files), len(msgs))
+	}
+
+	var all string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all += string(data)
+	}
+	for _, want := range []string{
+		"To: a@example.com\r\n",
+		"Subject: Hello\r\n",
+		"\r\n\r\nline one\r\nline two",
+		"Subject: =?utf-8?q?H=C3=A9llo?=\r\n",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("messages do not contain %q", want)
+		}
+	}
+	if strings.Contains(all, "\r\nBcc:") {
+		t.Error("a header was injected through the recipient")
+	}
+}
@@ -0,0 +1,180 @@
+package notification
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"socialnetwork/pkg/apis/chat"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type notificationRequest struct {
+	NotificationID int `json:"notification_id"`
+}
+
+// The handlers below expect the caller to have validated the session and
+// resolved userID, since this package cannot import the user package.
+
+// GetNotifications handles GET /notifications?limit=&offset=&unread=1
+func GetNotifications(db *sql.DB, userID int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultPageSize
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset := 0
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "1" || r.URL.Query().Get("unread") == "true"
+
+	// Fetch one extra row to know whether another page exists
+	notifications, err := List(db, userID, limit+1, offset, unreadOnly)
+	if err != nil {
+		fmt.Println("Error fetching notifications:", err)
+		http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	hasMore := len(notifications) > limit
+	if hasMore {
+		notifications = notifications[:limit]
+	}
+
+	unread, err := CountUnread(db, userID)
+	if err != nil {
+		fmt.Println("Error counting notifications:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+		"unread_count":  unread,
+		"has_more":      hasMore,
+		"next_offset":   offset + len(notifications),
+	})
+}
+
+// GetUnreadCount handles GET /notifications/unread-count
+func GetUnreadCount(db *sql.DB, userID int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	unread, err := CountUnread(db, userID)
+	if err != nil {
+		fmt.Println("Error counting notifications:", err)
+		http.Error(w, "Failed to count notifications", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"unread_count": unread,
+	})
+}
+
+// MarkNotificationRead handles POST /notifications/read {notification_id}
+func MarkNotificationRead(db *sql.DB, hub *chat.Hub, userID int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req notificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NotificationID <= 0 {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := MarkRead(db, userID, req.NotificationID)
+	if err != nil {
+		fmt.Println("Error marking notification read:", err)
+		http.Error(w, "Failed to update notification", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	writeUnreadUpdate(db, hub, userID, w)
+}
+
+// MarkAllNotificationsRead handles POST /notifications/read-all
+func MarkAllNotificationsRead(db *sql.DB, hub *chat.Hub, userID int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := MarkAllRead(db, userID); err != nil {
+		fmt.Println("Error marking notifications read:", err)
+		http.Error(w, "Failed to update notifications", http.StatusInternalServerError)
+		return
+	}
+
+	writeUnreadUpdate(db, hub, userID, w)
+}
+
+// DeleteNotification handles POST or DELETE /notifications/delete {notification_id}
+func DeleteNotification(db *sql.DB, hub *chat.Hub, userID int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req notificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NotificationID <= 0 {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := Delete(db, userID, req.NotificationID)
+	if err != nil {
+		fmt.Println("Error deleting notification:", err)
+		http.Error(w, "Failed to delete notification", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	writeUnreadUpdate(db, hub, userID, w)
+}
+
+// writeUnreadUpdate responds with the new unread count and pushes it to the
+// user's connections so other open tabs/devices update their badge.
+func writeUnreadUpdate(db *sql.DB, hub *chat.Hub, userID int, w http.ResponseWriter) {
+	unread, err := CountUnread(db, userID)
+	if err != nil {
+		fmt.Println("Error counting notifications:", err)
+	}
+
+	if hub != nil {
+		hub.SendToUser(userID, chat.NotificationsUpdated{UnreadCount: unread})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"unread_count": unread,
+	})
+}
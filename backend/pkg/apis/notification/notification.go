@@ -0,0 +1,204 @@
+package notification
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"socialnetwork/pkg/apis/chat"
+)
+
+// Notification is a stored notification as returned to the frontend.
+// The JSON keys match the chat payloads so stored and live notifications look the same.
+type Notification struct {
+	NotificationID int       `json:"notification_id"`
+	Type           string    `json:"type"`
+	From           int       `json:"from"`
+	To             int       `json:"to"`
+	Username       string    `json:"username"`
+	Content        string    `json:"content"`
+	GroupID        int       `json:"group_id"`
+	PostId         int       `json:"post_id"`
+	EventID        int       `json:"event_id,omitempty"`
+	RequestID      int       `json:"request_id,omitempty"`
+	InvitationID   int       `json:"invitation_id,omitempty"`
+	EventDate      string    `json:"event_date,omitempty"`
+	IsRead         bool      `json:"is_read"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Save stores a notification for userID and returns its id. The columns
+// other than the Notice fields are taken from the payload's fields of the
+// same JSON name.
+func Save(db *sql.DB, userID int, notif chat.Notification) (int, error) {
+	var refs struct {
+		GroupID      int    `json:"group_id"`
+		PostID       int    `json:"post_id"`
+		EventID      int    `json:"event_id"`
+		RequestID    int    `json:"request_id"`
+		InvitationID int    `json:"invitation_id"`
+		EventDate    string `json:"event_date"`
+	}
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return 0, err
+	}
+
+	n := notif.NoticeFields()
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, content, group_id, post_id, event_id, request_id, invitation_id, event_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.Exec(query, userID, nullInt(n.From), notif.FrameType(), n.Content,
+		nullInt(refs.GroupID), nullInt(refs.PostID), nullInt(refs.EventID), nullInt(refs.RequestID),
+		nullInt(refs.InvitationID), nullString(refs.EventDate))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// Notify stores a notification for userID and pushes it over the hub if the user is online.
+// A failure to store is logged and the live notification is still sent.
+func Notify(db *sql.DB, hub *chat.Hub, userID int, notif chat.Notification) {
+	if userID <= 0 {
+		return
+	}
+
+	n := notif.NoticeFields()
+	n.NotificationID = 0
+	id, err := Save(db, userID, notif)
+	if err != nil {
+		fmt.Println("Error saving notification:", err)
+	} else {
+		n.NotificationID = id
+	}
+
+	if hub == nil {
+		return
+	}
+	hub.SendToUser(userID, notif)
+}
+
+// NotifyUsers calls Notify for every user in userIDs, skipping the actor.
+func NotifyUsers(db *sql.DB, hub *chat.Hub, userIDs []int, notif chat.Notification) {
+	for _, id := range userIDs {
+		if id == notif.NoticeFields().From {
+			continue
+		}
+		Notify(db, hub, id, notif)
+	}
+}
+
+// NotifyAllUsers stores a notification for every user except the actor and
+// pushes it to everyone online, including the actor.
+func NotifyAllUsers(db *sql.DB, hub *chat.Hub, notif chat.Notification) {
+	actor := notif.NoticeFields().From
+	rows, err := db.Query(`SELECT id FROM users WHERE id != ?`, actor)
+	if err != nil {
+		fmt.Println("Error fetching users for notification:", err)
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	NotifyUsers(db, hub, userIDs, notif)
+
+	// The actor is not stored a notification but still receives the live update
+	if hub != nil {
+		notif.NoticeFields().NotificationID = 0
+		hub.SendToUser(actor, notif)
+	}
+}
+
+// List returns a page of notifications for userID, newest first.
+func List(db *sql.DB, userID, limit, offset int, unreadOnly bool) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.type, COALESCE(n.actor_id, 0), COALESCE(u.username, ''), n.content,
+		       COALESCE(n.group_id, 0), COALESCE(n.post_id, 0), COALESCE(n.event_id, 0), COALESCE(n.request_id, 0),
+		       COALESCE(n.invitation_id, 0), COALESCE(n.event_date, ''), n.is_read, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ?`
+	if unreadOnly {
+		query += ` AND n.is_read = 0`
+	}
+	query += ` ORDER BY n.created_at DESC, n.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.NotificationID, &n.Type, &n.From, &n.Username, &n.Content,
+			&n.GroupID, &n.PostId, &n.EventID, &n.RequestID, &n.InvitationID, &n.EventDate, &n.IsRead, &n.Timestamp); err != nil {
+			return nil, err
+		}
+		n.To = userID
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnread returns how many unread notifications userID has.
+func CountUnread(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = 0`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one notification as read. It returns false if the notification
+// does not exist or does not belong to userID.
+func MarkRead(db *sql.DB, userID, notificationID int) (bool, error) {
+	res, err := db.Exec(`UPDATE notifications SET is_read = 1 WHERE id = ? AND user_id = ?`, notificationID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkAllRead marks every notification of userID as read.
+func MarkAllRead(db *sql.DB, userID int) error {
+	_, err := db.Exec(`UPDATE notifications SET is_read = 1 WHERE user_id = ? AND is_read = 0`, userID)
+	return err
+}
+
+// Delete removes one notification. It returns false if the notification
+// does not exist or does not belong to userID.
+func Delete(db *sql.DB, userID, notificationID int) (bool, error) {
+	res, err := db.Exec(`DELETE FROM notifications WHERE id = ? AND user_id = ?`, notificationID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func nullInt(v int) interface{} {
+	if v <= 0 {
+		return nil
+	}
+	return v
+}
+
+func nullString(v string) interface{} {
+	if v == "" {
+		return nil
+	}
+	return v
+}
@@ -5,11 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"socialnetwork/pkg/apis/authz"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
 )
 
 func GetPostbyCategory(db *sql.DB, w http.ResponseWriter, r *http.Request, category string) {
+	userID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
 	// Fetch the category ID based on the category name
 	categoryID, err := database.GetCategoryIDByName(db, category)
 	if err != nil {
@@ -17,8 +24,9 @@ func GetPostbyCategory(db *sql.DB, w http.ResponseWriter, r *http.Request, categ
 		categoryID, _ = database.InsertCategory(db, category)
 	}
 
-	// Fetch posts by category ID
-	posts, err := database.GetPostByCategoryID(db, categoryID)
+	// Fetch the posts of the category the user may see
+	visible, visibleArgs := authz.PostFilter("p", userID)
+	posts, err := database.GetPostByCategoryID(db, categoryID, visible, visibleArgs)
 	if err != nil {
 		fmt.Println(" Error retrieving posts from category:", err)
 		http.Error(w, "Failed to retrieve posts from category", http.StatusInternalServerError)
@@ -44,7 +52,9 @@ func GetPostbyIsLiked(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := database.GetPostIfLiked(db, userID)
+	// Only those the user can still see
+	visible, visibleArgs := authz.PostFilter("p", userID)
+	posts, err := database.GetPostIfLiked(db, userID, visible, visibleArgs)
 	if err != nil {
 		fmt.Println("Error checking if post is liked:", err)
 		http.Error(w, "Failed to check if post is liked", http.StatusInternalServerError)
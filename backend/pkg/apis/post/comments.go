@@ -13,9 +13,11 @@ import (
 	"strings"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	"socialnetwork/pkg/apis/chat"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
+	"socialnetwork/pkg/pagination"
 )
 
 type Comment struct {
@@ -48,7 +50,33 @@ func GetComments(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comments, err := GetCommentsByPostID(db, postID)
+	viewerID, loggedIn := u.ValidateSession(db, r)
+	if !loggedIn {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	canSee, err := authz.CanSeePost(db, viewerID, postID)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Println("Error checking post visibility:", err)
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Failed to retrieve comments"}`, http.StatusInternalServerError)
+		return
+	}
+	if !canSee {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Post not found"}`, http.StatusNotFound)
+		return
+	}
+
+	page, err := pagination.Parse(r, 20, pagination.OldestFirst)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error": "Invalid cursor"}`, http.StatusBadRequest)
+		return
+	}
+
+	comments, nextCursor, err := GetCommentsByPostID(db, postID, page)
 	if err != nil {
 		fmt.Println("Error retrieving comments:", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -57,7 +85,10 @@ func GetComments(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments":    comments,
+		"next_cursor": nextCursor,
+	})
 }
 
 // CreateComment handles POST /create-comment with multipart/form-data
@@ -87,6 +118,17 @@ func CreateComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	canSee, err := authz.CanSeePost(db, userID, postID)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Println("Error checking post visibility:", err)
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+	if !canSee {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
 	// 4) handle optional image upload
 	imgOrGif := ""
 	file, header, err := r.FormFile("imgOrgif")
@@ -138,26 +180,17 @@ func CreateComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Req
 	var username string
 	db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 
-	// Broadcast new comment notification via WebSocket
+	// Push the new comment to everyone who can see the post
 	if hub != nil {
-		commentNotification := chat.Frontend{
-			Type:      "new_comment",
+		commentNotification := chat.NewComment{
+			PostID:    postID,
 			From:      userID,
 			Username:  username,
-			PostId:    postID,
 			Content:   content,
 			Timestamp: time.Now(),
 		}
 
-		hub.Mutex.RLock()
-		for _, client := range hub.Clients {
-			select {
-			case client.Send <- commentNotification:
-			default:
-				// Skip if buffer full
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.SendToPostAudience(postID, commentNotification)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -168,9 +201,11 @@ func CreateComment(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Req
 	})
 }
 
-// GetCommentsByPostID fetches comments and maps NULL imgOrgif to nil
-func GetCommentsByPostID(db *sql.DB, postID int) ([]Comment, error) {
-	const query = `
+// GetCommentsByPostID fetches one page of comments, oldest first, and maps NULL imgOrgif to nil.
+// It also returns the cursor of the next page.
+func GetCommentsByPostID(db *sql.DB, postID int, page pagination.Page) ([]Comment, string, error) {
+	keyset, keysetArgs := page.Where("c.created_at", "c.id")
+	query := `
 SELECT
 	c.id,
 	c.user_id,
@@ -183,18 +218,21 @@ SELECT
 	c.created_at
 FROM comments c
 JOIN users u ON c.user_id = u.id
-WHERE c.post_id = ?
-ORDER BY c.created_at ASC
+WHERE c.post_id = ? AND ` + keyset + `
+ORDER BY ` + page.OrderBy("c.created_at", "c.id") + `
+LIMIT ?
 	`
 
-	rows, err := db.Query(query, postID)
+	args := append([]interface{}{postID}, keysetArgs...)
+	rows, err := db.Query(query, append(args, page.FetchLimit())...)
 	if err != nil {
 		fmt.Println("Database Query Error:", err)
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var comments []Comment
+	comments := []Comment{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var cmt Comment
 		if err := rows.Scan(
@@ -209,14 +247,16 @@ ORDER BY c.created_at ASC
 			&cmt.CreatedAt,
 		); err != nil {
 			fmt.Println("Row Scanning Error:", err)
-			return nil, err
+			return nil, "", err
 		}
 		cmt.Image = cmt.ImgOrGif // Set alias for frontend compatibility
 		comments = append(comments, cmt)
+		cursors = append(cursors, pagination.Cursor{CreatedAt: cmt.CreatedAt, ID: cmt.ID})
 	}
 	if err := rows.Err(); err != nil {
 		fmt.Println("Iteration Error:", err)
-		return nil, err
+		return nil, "", err
 	}
-	return comments, nil
+	comments, next := pagination.Result(page, comments, cursors)
+	return comments, next, nil
 }
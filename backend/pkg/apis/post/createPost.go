@@ -204,28 +204,15 @@ func CreatePost(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reques
 			postData["avatar_url"] = avatar.String
 		}
 
-		postNotification := chat.Frontend{
-			Type:      "new_post",
+		// Send to everyone who may see the post, with the post data encoded in Content as JSON
+		postJSON, _ := json.Marshal(postData)
+		hub.SendToPostAudience(int(postID), chat.NewPost{
+			PostID:    int(postID),
 			From:      userID,
 			Username:  username,
-			PostId:    int(postID),
-			Content:   content,
+			Content:   string(postJSON),
 			Timestamp: time.Now(),
-		}
-
-		// Send to all connected clients with the post data encoded in Content as JSON
-		postJSON, _ := json.Marshal(postData)
-		postNotification.Content = string(postJSON)
-
-		hub.Mutex.RLock()
-		for _, client := range hub.Clients {
-			select {
-			case client.Send <- postNotification:
-			default:
-				// Skip if client buffer is full
-			}
-		}
-		hub.Mutex.RUnlock()
+		})
 	}
 
 	// Send success response
@@ -3,12 +3,15 @@ package post
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"socialnetwork/pkg/apis/authz"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
+	"socialnetwork/pkg/pagination"
 )
 
 // GetPosts returns posts visible to the current user based on privacy settings
@@ -25,7 +28,14 @@ func GetPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Complex query that respects privacy settings
+	page, err := pagination.Parse(r, 20, pagination.NewestFirst)
+	if err != nil {
+		pagination.WriteError(w, err)
+		return
+	}
+	keyset, keysetArgs := page.Where("p.created_at", "p.id")
+	visible, visibleArgs := authz.PostFilter("p", userID)
+
 	query := `
 		SELECT 
 			p.id, u.username, u.firstname, u.lastname, u.avatar_url, p.user_id, p.title, p.content, 
@@ -54,37 +64,14 @@ func GetPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
             FROM comments 
             GROUP BY post_id
         ) comments ON p.id = comments.post_id
-        WHERE 
-            -- Public posts (everyone can see)
-            COALESCE(p.privacy_level, 0) = 0
-            OR
-            -- User's own posts (can always see own posts)
-            p.user_id = ?
-            OR
-            -- Almost private posts (only mutual followers can see - both must follow each other)
-            (COALESCE(p.privacy_level, 0) = 1 AND EXISTS (
-                SELECT 1 FROM userFollow 
-                WHERE follower_id = ? AND following_id = p.user_id
-            ) AND EXISTS (
-                SELECT 1 FROM userFollow 
-                WHERE follower_id = p.user_id AND following_id = ?
-            ))
-            OR
-            -- Private posts (only selected followers with mutual follow can see)
-            (COALESCE(p.privacy_level, 0) = 2 AND EXISTS (
-                SELECT 1 FROM post_permissions 
-                WHERE post_id = p.id AND user_id = ?
-            ) AND EXISTS (
-                SELECT 1 FROM userFollow 
-                WHERE follower_id = ? AND following_id = p.user_id
-            ) AND EXISTS (
-                SELECT 1 FROM userFollow 
-                WHERE follower_id = p.user_id AND following_id = ?
-            ))
-        ORDER BY p.created_at DESC
+        WHERE ` + visible + ` AND ` + keyset + `
+        ORDER BY ` + page.OrderBy("p.created_at", "p.id") + `
+        LIMIT ?
     `
 
-	rows, err := db.Query(query, userID, userID, userID, userID, userID, userID)
+	args := append(visibleArgs, keysetArgs...)
+	args = append(args, page.FetchLimit())
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		fmt.Println("Error retrieving posts:", err)
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
@@ -93,7 +80,8 @@ func GetPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	// Create a slice to hold posts
-	var posts []map[string]interface{}
+	posts := []map[string]interface{}{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var postID, privacyLevel, likesCount, dislikesCount, commentsCount, postUserID int
 		var username, firstname, lastname, avatarURL, title, content, imgOrgif string
@@ -143,11 +131,17 @@ func GetPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			"createdAt":      createdAt.Format("2006-01-02 15:04:05"),
 		}
 		posts = append(posts, post)
+		cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: postID})
 	}
 
+	posts, nextCursor := pagination.Result(page, posts, cursors)
+
 	// Return posts as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
 }
 
 func GetPublicPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -162,6 +156,9 @@ func GetPublicPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Public posts only, as seen by nobody in particular; this also leaves
+	// out accounts waiting for deletion
+	visible, visibleArgs := authz.PostFilter("p", 0)
 	query := `
         SELECT DISTINCT 
             p.id, u.username, p.title, p.content, 
@@ -190,12 +187,11 @@ func GetPublicPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
             FROM comments 
             GROUP BY post_id
         ) comments ON p.id = comments.post_id
-        WHERE 
-            COALESCE(p.privacy_level, 0) = 0  -- ONLY PUBLIC posts
+        WHERE ` + visible + `
         ORDER BY p.created_at DESC
     `
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, visibleArgs...)
 	if err != nil {
 		fmt.Println("Error retrieving public posts:", err)
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
@@ -248,16 +244,39 @@ func GetPublicPosts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 func GetProfilePosts(db *sql.DB, w http.ResponseWriter, r *http.Request, username string) {
 	// who is being viewed
 	var profileUserID int
-	if err := db.QueryRow(`SELECT id FROM users WHERE username=?`, username).Scan(&profileUserID); err != nil {
+	err := db.QueryRow(`SELECT id FROM users WHERE username=?`, username).Scan(&profileUserID)
+	if errors.Is(err, sql.ErrNoRows) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		fmt.Println("Error looking up profile user:", err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
 
 	// who is viewing (0 if not logged in)
 	viewerID, loggedIn := u.ValidateSession(db, r)
 	if !loggedIn {
 		viewerID = 0
 	}
+	// Unknown users and accounts waiting for deletion are not found
+	canView, err := authz.CanSeeProfile(db, viewerID, profileUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error checking profile visibility:", err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	if !canView {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]any{})
+		return
+	}
+	visible, visibleArgs := authz.PostFilter("p", viewerID)
 
 	rows, err := db.Query(`
         SELECT DISTINCT
@@ -282,30 +301,9 @@ func GetProfilePosts(db *sql.DB, w http.ResponseWriter, r *http.Request, usernam
           SELECT post_id, COUNT(*) AS count FROM comments
           GROUP BY post_id
         ) comments ON p.id = comments.post_id
-        WHERE p.user_id = ?
-          AND (
-               COALESCE(p.privacy_level,0) = 0                         -- public
-            OR (? > 0 AND ? = p.user_id)                               -- viewer is owner
-            OR (COALESCE(p.privacy_level,0) = 1 AND EXISTS (           -- followers-only (mutual follow required)
-                 SELECT 1 FROM userFollow f
-                 WHERE f.follower_id = ? AND f.following_id = p.user_id
-            ) AND EXISTS (
-                 SELECT 1 FROM userFollow f
-                 WHERE f.follower_id = p.user_id AND f.following_id = ?
-            ))
-            OR (COALESCE(p.privacy_level,0) = 2 AND EXISTS (           -- explicit permission with mutual follow
-                 SELECT 1 FROM post_permissions pp
-                 WHERE pp.post_id = p.id AND pp.user_id = ?
-            ) AND EXISTS (
-                 SELECT 1 FROM userFollow f
-                 WHERE f.follower_id = ? AND f.following_id = p.user_id
-            ) AND EXISTS (
-                 SELECT 1 FROM userFollow f
-                 WHERE f.follower_id = p.user_id AND f.following_id = ?
-            ))
-          )
+        WHERE p.user_id = ? AND `+visible+`
         ORDER BY p.created_at DESC
-    `, profileUserID, viewerID, viewerID, viewerID, viewerID, viewerID, viewerID, viewerID)
+    `, append([]interface{}{profileUserID}, visibleArgs...)...)
 	if err != nil {
 		fmt.Println("Error retrieving profile posts:", err)
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
@@ -341,3 +339,26 @@ func GetProfilePosts(db *sql.DB, w http.ResponseWriter, r *http.Request, usernam
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(posts)
 }
+
+// DeletePost handles DELETE /delete-post?post_id=. The route checks that the
+// caller is the author before this runs.
+func DeletePost(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	postID, err := database.ParseID(r.URL.Query().Get("post_id"))
+	if err != nil || postID <= 0 {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := database.DeletePost(db, postID); err != nil {
+		fmt.Println("Error deleting post:", err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -0,0 +1,151 @@
+// Package ratelimit slows down repeated attempts (failed logins, signups)
+// per key, typically an account or a client IP.
+//
+// The first Policy.Free attempts of a key are free. Every further one makes
+// the key wait Base, then twice as long, and so on up to MaxDelay. At
+// LockAfter attempts the key is locked out for Lockout. A key with no
+// attempt for Window is forgotten.
+//
+// Handlers use the Limiter interface; Memory keeps the counters in the
+// process, so they reset on restart and are not shared between instances.
+// A shared store can implement the same interface.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy configures a limiter.
+type Policy struct {
+	Free      int
+	Base      time.Duration
+	MaxDelay  time.Duration
+	LockAfter int // 0 never locks
+	Lockout   time.Duration
+	Window    time.Duration
+}
+
+// Result is the outcome of recording an attempt.
+type Result struct {
+	Wait   time.Duration // until the key may try again
+	Locked bool          // this attempt started a lockout
+}
+
+// Limiter tracks attempts per key.
+type Limiter interface {
+	// Check returns how long key has to wait before its next attempt, 0 if it
+	// may try now.
+	Check(key string) time.Duration
+	// Record counts an attempt of key.
+	Record(key string) Result
+	// Reset forgets key, e.g. after a successful login.
+	Reset(key string)
+}
+
+type entry struct {
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// Memory is an in-process Limiter.
+type Memory struct {
+	policy Policy
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// NewMemory returns an in-process Limiter with the given policy.
+func NewMemory(policy Policy) *Memory {
+	return &Memory{
+		policy:  policy,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// live returns the entry of key, dropping it if it went idle.
+func (m *Memory) live(key string, now time.Time) *entry {
+	e := m.entries[key]
+	if e != nil && m.stale(e, now) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (m *Memory) stale(e *entry, now time.Time) bool {
+	return now.Sub(e.last) > m.policy.Window && !now.Before(e.blockedUntil)
+}
+
+func (m *Memory) Check(key string) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if e := m.live(key, now); e != nil && now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now)
+	}
+	return 0
+}
+
+func (m *Memory) Record(key string) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	e := m.live(key, now)
+	if e == nil {
+		e = &entry{}
+		m.entries[key] = e
+	}
+	e.count++
+	e.last = now
+
+	var res Result
+	switch p := m.policy; {
+	case p.LockAfter > 0 && e.count >= p.LockAfter:
+		e.blockedUntil = now.Add(p.Lockout)
+		e.count = 0
+		res.Locked = true
+	case e.count > p.Free:
+		delay := p.Base
+		for i := p.Free + 1; i < e.count && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		if until := now.Add(delay); until.After(e.blockedUntil) {
+			e.blockedUntil = until
+		}
+	}
+	if now.Before(e.blockedUntil) {
+		res.Wait = e.blockedUntil.Sub(now)
+	}
+	return res
+}
+
+func (m *Memory) Reset(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+// sweep drops idle keys, at most once per window.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.policy.Window {
+		return
+	}
+	m.lastSweep = now
+	for key, e := range m.entries {
+		if m.stale(e, now) {
+			delete(m.entries, key)
+		}
+	}
+}
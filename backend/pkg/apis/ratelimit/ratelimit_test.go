@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(p Policy) (*Memory, *clock) {
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	m := NewMemory(p)
+	m.now = c.now
+	return m, c
+}
+
+var testPolicy = Policy{
+	Free:      2,
+	Base:      time.Second,
+	MaxDelay:  5 * time.Second,
+	LockAfter: 7,
+	Lockout:   time.Minute,
+	Window:    time.Hour,
+}
+
+func TestBackoffAndLockout(t *testing.T) {
+	m, _ := newTestLimiter(testPolicy)
+
+	tests := []struct {
+		wait   time.Duration
+		locked bool
+	}{
+		{0, false},
+		{0, false},
+		{time.Second, false},
+		{2 * time.Second, false},
+		{4 * time.Second, false},
+		{5 * time.Second, false}, // capped at MaxDelay
+		{time.Minute, true},
+	}
+	for i, tt := range tests {
+		res := m.Record("k")
+		if res.Wait != tt.wait || res.Locked != tt.locked {
+			t.Errorf("attempt %d: got %+v, want wait %v locked %v", i+1, res, tt.wait, tt.locked)
+		}
+		if got := m.Check("k"); got != tt.wait {
+			t.Errorf("attempt %d: Check = %v, want %v", i+1, got, tt.wait)
+		}
+	}
+
+	if got := m.Check("other"); got != 0 {
+		t.Errorf("unrelated key waits %v", got)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	m, c := newTestLimiter(testPolicy)
+	for i := 0; i < testPolicy.LockAfter; i++ {
+		m.Record("k")
+	}
+	c.advance(testPolicy.Lockout - time.Second)
+	if got := m.Check("k"); got != time.Second {
+		t.Errorf("Check during lockout = %v, want 1s", got)
+	}
+	c.advance(time.Second)
+	if got := m.Check("k"); got != 0 {
+		t.Errorf("Check after lockout = %v, want 0", got)
+	}
+	// The count started over with the lockout
+	if res := m.Record("k"); res.Wait != 0 {
+		t.Errorf("first attempt after lockout waits %v", res.Wait)
+	}
+}
+
+func TestIdleKeysAreForgotten(t *testing.T) {
+	m, c := newTestLimiter(testPolicy)
+	for i := 0; i < 4; i++ {
+		m.Record("k")
+	}
+	c.advance(testPolicy.Window + time.Second)
+	if res := m.Record("k"); res.Wait != 0 {
+		t.Errorf("attempt after an idle window waits %v", res.Wait)
+	}
+	if len(m.entries) != 1 {
+		t.Errorf("%d entries kept, want 1", len(m.entries))
+	}
+}
+
+func TestReset(t *testing.T) {
+	m, _ := newTestLimiter(testPolicy)
+	for i := 0; i < 4; i++ {
+		m.Record("k")
+	}
+	m.Reset("k")
+	if got := m.Check("k"); got != 0 {
+		t.Errorf("Check after Reset = %v, want 0", got)
+	}
+}
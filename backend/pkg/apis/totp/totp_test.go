@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 appendix B test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to the last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, _ := Code(rfcSecret, Step(now))
+	previous, _ := Code(rfcSecret, Step(now)-1)
+	stale, _ := Code(rfcSecret, Step(now)-2)
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"current step", current, true},
+		{"previous step", previous, true},
+		{"spaces are ignored", current[:3] + " " + current[3:], true},
+		{"two steps old", stale, false},
+		{"wrong length", current[:5], false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := Validate(rfcSecret, tt.code, now); got != tt.want {
+				t.Errorf("Validate(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+
+	if step, ok := Validate(rfcSecret, previous, now); !ok || step != Step(now)-1 {
+		t.Errorf("Validate returned step %d, want %d", step, Step(now)-1)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("SocialNet", "alice@example.com", "ABC")
+	for _, want := range []string{"otpauth://totp/SocialNet:alice@example.com?", "secret=ABC", "issuer=SocialNet", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI %q does not contain %q", uri, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"socialnetwork/pkg/apis/chat"
+	database "socialnetwork/pkg/db"
+)
+
+// Scopes of personal access tokens.
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopeChat       = "chat"
+	ScopeGroups     = "groups"
+)
+
+var tokenScopes = []string{ScopePostsRead, ScopePostsWrite, ScopeChat, ScopeGroups}
+
+const (
+	// accessTokenPrefix starts every personal access token, so leaked ones
+	// are easy to recognise.
+	accessTokenPrefix = "snt_"
+	maxAccessTokens   = 20
+	// maxAccessTokenDays is the longest lifetime a token can be given;
+	// tokens last 30 days unless asked otherwise.
+	maxAccessTokenDays     = 365
+	defaultAccessTokenDays = 30
+)
+
+// tokenRoutes maps the endpoints that accept a personal access token to the
+// scope they need. "" means any valid token. Anything not listed here, such
+// as account, session and token management, needs a logged in session.
+var tokenRoutes = map[string]string{
+	"/check-session": "",
+
+	"/get-posts":       ScopePostsRead,
+	"/get-myPosts":     ScopePostsRead,
+	"/comments":        ScopePostsRead,
+	"/getInteractions": ScopePostsRead,
+
+	"/create-post":        ScopePostsWrite,
+	"/create-comment":     ScopePostsWrite,
+	"/likeDislikePost":    ScopePostsWrite,
+	"/likeDislikeComment": ScopePostsWrite,
+	"/delete-post":        ScopePostsWrite,
+
+	"/ws":                    ScopeChat,
+	"/messages":              ScopeChat,
+	"/messages/edit":         ScopeChat,
+	"/messages/delete":       ScopeChat,
+	"/conversations":         ScopeChat,
+	"/get-chat-history":      ScopeChat,
+	"/get-users":             ScopeChat,
+	"/group-messages":        ScopeChat,
+	"/group-messages/edit":   ScopeChat,
+	"/group-messages/delete": ScopeChat,
+
+	"/create-group":              ScopeGroups,
+	"/get-groups":                ScopeGroups,
+	"/get-user-groups":           ScopeGroups,
+	"/invite-to-group":           ScopeGroups,
+	"/respond-group-invitation":  ScopeGroups,
+	"/request-join-group":        ScopeGroups,
+	"/leave-group":               ScopeGroups,
+	"/get-group-invitations":     ScopeGroups,
+	"/get-invitable-users":       ScopeGroups,
+	"/send-bulk-invitations":     ScopeGroups,
+	"/get-sent-invitations":      ScopeGroups,
+	"/get-received-invitations":  ScopeGroups,
+	"/cancel-invitation":         ScopeGroups,
+	"/get-pending-join-requests": ScopeGroups,
+	"/respond-join-request":      ScopeGroups,
+	"/create-event":              ScopeGroups,
+}
+
+// tokenRoutePrefixes are the endpoints of tokenRoutes that take a path
+// parameter.
+var tokenRoutePrefixes = []struct{ prefix, scope string }{
+	{"/get-otherPosts/", ScopePostsRead},
+	{"/category/", ScopePostsRead},
+	{"/editGet/", ScopePostsRead},
+	{"/editPost/", ScopePostsWrite},
+	{"/group-details/", ScopeGroups},
+	{"/groups/", ScopeGroups},
+}
+
+// TokenScope returns the scope a personal access token needs for r, and
+// false if tokens cannot be used there at all.
+func TokenScope(r *http.Request) (string, bool) {
+	if scope, ok := tokenRoutes[r.URL.Path]; ok {
+		return scope, true
+	}
+	for _, route := range tokenRoutePrefixes {
+		if strings.HasPrefix(r.URL.Path, route.prefix) {
+			return route.scope, true
+		}
+	}
+	return "", false
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// HasBearerToken reports whether r authenticates with a personal access
+// token rather than the session cookie.
+func HasBearerToken(r *http.Request) bool {
+	_, ok := bearerToken(r)
+	return ok
+}
+
+// AuthenticateToken returns the unexpired personal access token r carries,
+// or sql.ErrNoRows. Scopes are not checked.
+func AuthenticateToken(db *sql.DB, r *http.Request) (*database.APIToken, error) {
+	token, ok := bearerToken(r)
+	if !ok || !strings.HasPrefix(token, accessTokenPrefix) {
+		return nil, sql.ErrNoRows
+	}
+	t, err := database.GetAPITokenByHash(db, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !now.Before(t.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= sessionTouchInterval {
+		if err := database.TouchAPIToken(db, t.ID, now); err != nil {
+			fmt.Println("Error updating token activity:", err)
+		}
+	}
+	return t, nil
+}
+
+// validateAccessToken is ValidateSession for requests with a bearer token:
+// the token must be valid and have the scope the endpoint needs.
+func validateAccessToken(db *sql.DB, r *http.Request) (int, bool) {
+	scope, allowed := TokenScope(r)
+	if !allowed {
+		return 0, false
+	}
+	t, err := AuthenticateToken(db, r)
+	if err != nil {
+		return 0, false
+	}
+	if scope != "" && !t.HasScope(scope) {
+		return 0, false
+	}
+	return t.UserID, true
+}
+
+// SessionKey identifies what authenticated r, so its WebSocket connections
+// can be closed when it is revoked: the session token, or a key derived from
+// the personal access token.
+func SessionKey(db *sql.DB, r *http.Request) (string, bool) {
+	if HasBearerToken(r) {
+		t, err := AuthenticateToken(db, r)
+		if err != nil {
+			return "", false
+		}
+		return database.APITokenSessionKey(t.ID), true
+	}
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// GetAccessTokens lists the personal access tokens of the logged in user.
+func GetAccessTokens(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := database.GetAPITokens(db, userID)
+	if err != nil {
+		fmt.Println("Error fetching access tokens:", err)
+		http.Error(w, "Failed to fetch access tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tokens":  tokens,
+		"scopes":  tokenScopes,
+	})
+}
+
+// CreateAccessToken handles POST /tokens {"name", "scopes", "expires_in_days"}.
+// The token is only returned in this response.
+func CreateAccessToken(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 50 {
+		writeFailure(w, http.StatusBadRequest, "Token name must be 1 to 50 characters.")
+		return
+	}
+	scopes, ok := normalizeScopes(req.Scopes)
+	if !ok {
+		writeFailure(w, http.StatusBadRequest, "Choose one or more of the scopes: "+strings.Join(tokenScopes, ", ")+".")
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAccessTokenDays {
+		writeFailure(w, http.StatusBadRequest, fmt.Sprintf("Tokens can last 1 to %d days.", maxAccessTokenDays))
+		return
+	}
+
+	existing, err := database.GetAPITokens(db, userID)
+	if err != nil {
+		fmt.Println("Error fetching access tokens:", err)
+		http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxAccessTokens {
+		writeFailure(w, http.StatusConflict, fmt.Sprintf("You can have at most %d tokens. Revoke one first.", maxAccessTokens))
+		return
+	}
+
+	raw, _, err := newToken()
+	if err != nil {
+		fmt.Println("Error generating access token:", err)
+		http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+		return
+	}
+	token := accessTokenPrefix + raw
+	now := time.Now()
+	t := &database.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    token[:len(accessTokenPrefix)+4],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+	}
+	t.ID, err = database.CreateAPIToken(db, t, hashToken(token))
+	if err != nil {
+		fmt.Println("Error creating access token:", err)
+		http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+		return
+	}
+	fmt.Println("Access token", t.ID, "created for User ID:", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      "Copy your token now, it will not be shown again.",
+		"token":        token,
+		"access_token": t,
+	})
+}
+
+// normalizeScopes checks requested scopes and returns them in canonical
+// order without duplicates.
+func normalizeScopes(requested []string) ([]string, bool) {
+	want := map[string]bool{}
+	for _, s := range requested {
+		want[s] = true
+	}
+	var scopes []string
+	for _, scope := range tokenScopes {
+		if want[scope] {
+			scopes = append(scopes, scope)
+			delete(want, scope)
+		}
+	}
+	return scopes, len(scopes) > 0 && len(want) == 0
+}
+
+// RevokeAccessToken handles POST /tokens/revoke {"token_id"} and closes the
+// WebSocket connections opened with the token.
+func RevokeAccessToken(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		TokenID int `json:"token_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TokenID <= 0 {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := database.DeleteAPIToken(db, userID, req.TokenID)
+	if err != nil {
+		fmt.Println("Error revoking access token:", err)
+		http.Error(w, "Failed to revoke access token", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if hub != nil {
+		hub.CloseSession(database.APITokenSessionKey(req.TokenID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Token revoked",
+	})
+}
@@ -0,0 +1,196 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/mail"
+	database "socialnetwork/pkg/db"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AccountDeletionGrace is how long a deleted account can still be
+	// restored by logging in before it is purged.
+	AccountDeletionGrace = 14 * 24 * time.Hour
+	// accountPurgeInterval is how often due accounts are looked for.
+	accountPurgeInterval = time.Hour
+)
+
+// DeleteAccount handles POST /account/delete {"password"} (plus "code" or
+// "recovery_code" with two-factor authentication). The account is logged out
+// everywhere and hidden, then purged once AccountDeletionGrace has passed
+// unless its owner logs in again before that. Wrong passwords and codes
+// count towards the account's login throttle, as in DisableTwoFactor.
+func DeleteAccount(db *sql.DB, hub *chat.Hub, mailer mail.Mailer, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	account, ip := accountKey(userID), ClientIP(r)
+	if wait := throttle.loginWait(account, ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, err := checkPassword(db, userID, req.Password)
+	if err != nil {
+		fmt.Println("Error getting password:", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Wrong password")
+		return
+	}
+
+	enabled, err := database.IsTOTPEnabled(db, userID)
+	if err == nil && enabled {
+		ok, err = checkSecondFactor(db, userID, req.Code, req.RecoveryCode)
+	}
+	if err != nil {
+		fmt.Println("Error checking second factor:", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Invalid authentication code.")
+		return
+	}
+	throttle.Account.Reset(account)
+
+	accessTokens, err := database.GetAPITokens(db, userID)
+	if err != nil {
+		fmt.Println("Error fetching access tokens:", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	purgeAfter := now.Add(AccountDeletionGrace)
+	tokens, err := database.ScheduleAccountDeletion(db, userID, now, purgeAfter)
+	if err != nil {
+		fmt.Println("Error scheduling account deletion:", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if hub != nil {
+		for _, token := range tokens {
+			hub.CloseSession(token)
+		}
+		for _, t := range accessTokens {
+			hub.CloseSession(database.APITokenSessionKey(t.ID))
+		}
+	}
+	fmt.Println("Account deletion scheduled for User ID:", userID)
+
+	if _, email, err := database.GetUserContact(db, userID); err != nil {
+		fmt.Println("Error getting user contact:", err)
+	} else if err := mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Your account will be deleted",
+		Body: "Your account has been deactivated and will be deleted for good on " +
+			purgeAfter.UTC().Format("2 January 2006 at 15:04 UTC") + ", with your posts, comments, messages and photos.\n\n" +
+			"Changed your mind? Log in before then to keep your account.",
+	}); err != nil {
+		fmt.Println("Error sending account deletion email:", err)
+	}
+
+	ClearSessionCookie(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     "Your account has been deactivated and will be deleted in 14 days. Log in again before then to keep it.",
+		"purge_after": purgeAfter,
+	})
+}
+
+// checkPassword reports whether password is the password of userID.
+func checkPassword(db *sql.DB, userID int, password string) (bool, error) {
+	username, err := database.GetUsernameUsingID(db, userID)
+	if err != nil {
+		return false, err
+	}
+	hash, err := GetUserPassword(db, username)
+	if err != nil {
+		return false, err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+}
+
+// RunAccountPurge purges the accounts whose grace period is over, now and
+// then every hour. It never returns.
+func RunAccountPurge(db *sql.DB) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purgeDueAccounts(db)
+		<-ticker.C
+	}
+}
+
+func purgeDueAccounts(db *sql.DB) {
+	due, err := database.DueAccountDeletions(db, time.Now())
+	if err != nil {
+		fmt.Println("Error listing accounts to purge:", err)
+		return
+	}
+	for _, userID := range due {
+		exports, err := database.GetDataExports(db, userID)
+		if err != nil {
+			fmt.Println("Error listing data exports:", err)
+			continue
+		}
+		files, err := database.PurgeAccount(db, userID)
+		if err != nil {
+			fmt.Println("Error purging account:", userID, err)
+			continue
+		}
+		for _, file := range files {
+			removeUpload(file)
+		}
+		for _, e := range exports {
+			if e.FilePath == "" {
+				continue
+			}
+			if err := os.Remove(e.FilePath); err != nil && !os.IsNotExist(err) {
+				fmt.Println("Error removing data export:", err)
+			}
+		}
+		fmt.Printf("Purged account of User ID %d (%d files)\n", userID, len(files))
+	}
+}
+
+// removeUpload deletes an uploaded image given by its public URL path.
+func removeUpload(urlPath string) {
+	file, ok := UploadPath(urlPath)
+	if !ok {
+		return
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error removing upload:", err)
+	}
+}
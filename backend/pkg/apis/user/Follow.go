@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/notification"
 )
 
 // FollowUser handles follow requests
@@ -96,22 +97,15 @@ func FollowUser(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reques
 		if hub != nil {
 			var requesterUsername string
 			_ = db.QueryRow("SELECT username FROM users WHERE id = ?", followerID).Scan(&requesterUsername)
-			notif := chat.Frontend{
-				Type:      "follow_request",
-				From:      followerID,
-				To:        targetID,
-				Username:  requesterUsername,
-				Content:   fmt.Sprintf("%s wants to follow you", requesterUsername),
-				Timestamp: time.Now(),
+			notif := &chat.FollowRequest{
+				Notice: chat.Notice{
+					From:      followerID,
+					Username:  requesterUsername,
+					Content:   fmt.Sprintf("%s wants to follow you", requesterUsername),
+					Timestamp: time.Now(),
+				},
 			}
-			hub.Mutex.RLock()
-			if client, ok := hub.Clients[targetID]; ok {
-				select {
-				case client.Send <- notif:
-				default:
-				}
-			}
-			hub.Mutex.RUnlock()
+			notification.Notify(db, hub, targetID, notif)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -132,22 +126,15 @@ func FollowUser(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Reques
 		if hub != nil {
 			var followerUsername string
 			_ = db.QueryRow("SELECT username FROM users WHERE id = ?", followerID).Scan(&followerUsername)
-			notif := chat.Frontend{
-				Type:      "new_follower",
-				From:      followerID,
-				To:        targetID,
-				Username:  followerUsername,
-				Content:   fmt.Sprintf("%s started following you", followerUsername),
-				Timestamp: time.Now(),
-			}
-			hub.Mutex.RLock()
-			if client, ok := hub.Clients[targetID]; ok {
-				select {
-				case client.Send <- notif:
-				default:
-				}
+			notif := &chat.NewFollower{
+				Notice: chat.Notice{
+					From:      followerID,
+					Username:  followerUsername,
+					Content:   fmt.Sprintf("%s started following you", followerUsername),
+					Timestamp: time.Now(),
+				},
 			}
-			hub.Mutex.RUnlock()
+			notification.Notify(db, hub, targetID, notif)
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -203,40 +190,23 @@ func UnfollowUser(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Requ
 		_ = db.QueryRow("SELECT username FROM users WHERE id = ?", followerID).Scan(&followerUsername)
 
 		// Notify the target that someone unfollowed them
-		unfollowNotif := chat.Frontend{
-			Type:      "unfollow_update",
+		unfollowNotif := chat.Unfollowed{
 			From:      followerID,
-			To:        targetID,
 			Username:  followerUsername,
 			Content:   fmt.Sprintf("%s unfollowed you", followerUsername),
 			Timestamp: time.Now(),
 		}
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[targetID]; ok {
-			select {
-			case client.Send <- unfollowNotif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.SendToUser(targetID, unfollowNotif)
 
 		// Notify the actor (follower) that their follow state changed (useful for updating lists)
-		followUpdate := chat.Frontend{
-			Type:      "follow_update",
+		followUpdate := chat.FollowUpdate{
 			From:      followerID,
-			To:        followerID,
+			UserID:    targetID,
 			Username:  followerUsername,
 			Content:   fmt.Sprintf("You unfollowed user %d", targetID),
 			Timestamp: time.Now(),
 		}
-		hub.Mutex.RLock()
-		if client, ok := hub.Clients[followerID]; ok {
-			select {
-			case client.Send <- followUpdate:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.SendToUser(followerID, followUpdate)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -322,41 +292,27 @@ func HandleFollowRequest(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 			var targetUsername string
 			_ = db.QueryRow("SELECT username FROM users WHERE id = ?", targetID).Scan(&targetUsername)
 			// response to requester
-			respNotif := chat.Frontend{
-				Type:      "follow_request_response",
-				From:      targetID,
-				To:        req.RequesterID,
-				Username:  targetUsername,
-				Content:   fmt.Sprintf("%s accepted your follow request", targetUsername),
-				Timestamp: time.Now(),
-			}
-			hub.Mutex.RLock()
-			if client, ok := hub.Clients[req.RequesterID]; ok {
-				select {
-				case client.Send <- respNotif:
-				default:
-				}
+			respNotif := &chat.FollowRequestResponse{
+				Notice: chat.Notice{
+					From:      targetID,
+					Username:  targetUsername,
+					Content:   fmt.Sprintf("%s accepted your follow request", targetUsername),
+					Timestamp: time.Now(),
+				},
 			}
-			hub.Mutex.RUnlock()
+			notification.Notify(db, hub, req.RequesterID, respNotif)
 			// Also notify the target (owner) that they have a new follower
 			var followerUsername string
 			_ = db.QueryRow("SELECT username FROM users WHERE id = ?", req.RequesterID).Scan(&followerUsername)
-			followerNotif := chat.Frontend{
-				Type:      "new_follower",
-				From:      req.RequesterID,
-				To:        targetID,
-				Username:  followerUsername,
-				Content:   fmt.Sprintf("%s started following you", followerUsername),
-				Timestamp: time.Now(),
+			followerNotif := &chat.NewFollower{
+				Notice: chat.Notice{
+					From:      req.RequesterID,
+					Username:  followerUsername,
+					Content:   fmt.Sprintf("%s started following you", followerUsername),
+					Timestamp: time.Now(),
+				},
 			}
-			hub.Mutex.RLock()
-			if client, ok := hub.Clients[targetID]; ok {
-				select {
-				case client.Send <- followerNotif:
-				default:
-				}
-			}
-			hub.Mutex.RUnlock()
+			notification.Notify(db, hub, targetID, followerNotif)
 		}
 
 	} else if req.Action == "decline" {
@@ -374,22 +330,15 @@ func HandleFollowRequest(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *ht
 		if hub != nil {
 			var targetUsername string
 			_ = db.QueryRow("SELECT username FROM users WHERE id = ?", targetID).Scan(&targetUsername)
-			notif := chat.Frontend{
-				Type:      "follow_request_response",
-				From:      targetID,
-				To:        req.RequesterID,
-				Username:  targetUsername,
-				Content:   fmt.Sprintf("%s declined your follow request", targetUsername),
-				Timestamp: time.Now(),
-			}
-			hub.Mutex.RLock()
-			if client, ok := hub.Clients[req.RequesterID]; ok {
-				select {
-				case client.Send <- notif:
-				default:
-				}
+			notif := &chat.FollowRequestResponse{
+				Notice: chat.Notice{
+					From:      targetID,
+					Username:  targetUsername,
+					Content:   fmt.Sprintf("%s declined your follow request", targetUsername),
+					Timestamp: time.Now(),
+				},
 			}
-			hub.Mutex.RUnlock()
+			notification.Notify(db, hub, req.RequesterID, notif)
 		}
 	}
 
@@ -10,6 +10,16 @@ import (
 	database "socialnetwork/pkg/db"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// SessionIdleTimeout is how long a session stays valid without any activity.
+	SessionIdleTimeout = 24 * time.Hour
+	// SessionMaxLifetime caps how far activity can extend a session.
+	SessionMaxLifetime = 30 * 24 * time.Hour
+	// sessionTouchInterval limits how often last_seen is written back.
+	sessionTouchInterval = time.Minute
 )
 
 // Session structure
@@ -19,7 +29,11 @@ type Session struct {
 	ExpiresAt time.Time
 }
 
-func Login(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+// Login starts a session. Failed attempts are throttled per account and per
+// client address, and all of them get the same reply so it does not tell
+// whether the account exists. Under UnverifiedBlock, users who have not
+// confirmed their email are turned away.
+func Login(db *sql.DB, policy UnverifiedPolicy, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 
 		var credentials struct {
@@ -34,90 +48,119 @@ func Login(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		userID, account, err := loginAccount(db, credentials.UserOremail)
+		if err != nil {
+			fmt.Println(" Error getting user ID:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ip := ClientIP(r)
+		if wait := throttle.loginWait(account, ip); wait > 0 {
+			writeTooManyAttempts(w, wait)
+			return
+		}
+
 		// Validate login
 		valid, errorNum := ValidateLog(credentials.UserOremail, credentials.Password, db)
 		if !valid {
 			var errorMessage string
+			status := http.StatusUnauthorized
 			switch errorNum {
 			case 1:
 				errorMessage = "Username/Email and Password cannot be empty."
 			case 2:
-				errorMessage = "User not found."
+				// Take as long as checking a real password would
+				bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(credentials.Password))
+				fallthrough
 			case 3:
-				errorMessage = "Incorrect password."
-			case 4:
-				errorMessage = "Internal server error."
+				throttle.loginFailed(db, account, ip, userID)
+				errorMessage = loginFailedMessage
 			default:
-				errorMessage = "An unknown error occurred."
+				errorMessage = "Internal server error."
+				status = http.StatusInternalServerError
 			}
 
 			response := map[string]string{"message": errorMessage}
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
+			w.WriteHeader(status)
 			json.NewEncoder(w).Encode(response)
 			return
 		}
 
-		//  Get user ID
-		userID, err := database.GetUserID(db, credentials.UserOremail)
-		if err != nil {
-			fmt.Println(" Error getting user ID:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+		if policy == UnverifiedBlock {
+			verified, err := database.IsEmailVerified(db, userID)
+			if err != nil {
+				fmt.Println(" Error checking email verification:", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !verified {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"message":  "Please verify your email address before logging in.",
+					"verified": false,
+				})
+				return
+			}
 		}
 
-		//  Check if there is an active session
-		activeSessionID, err := database.GetActiveSessionbyUserID(db, userID)
+		// With two-factor authentication the password only earns a pending-auth token
+		enabled, err := database.IsTOTPEnabled(db, userID)
 		if err != nil {
-			fmt.Println(" Error checking active session:", err)
+			fmt.Println(" Error checking two-factor authentication:", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if enabled {
+			// The account's failures are only forgiven once the code is right too
+			startTwoFactorLogin(db, w, userID)
+			return
+		}
 
-		// Log active session details
-		fmt.Println(" Active Session ID:", activeSessionID)
+		throttle.Account.Reset(account)
+		startSession(db, w, r, userID)
+	}
+}
 
-		// If an active session exists, invalidate the old session
-		if activeSessionID != -1 {
-			err = database.DeleteSession(db, activeSessionID)
-			if err != nil {
-				fmt.Println(" Error deleting old session:", err)
-				http.Error(w, "Failed to invalidate previous session", http.StatusInternalServerError)
-				return
-			}
-			fmt.Println(" Old session invalidated.")
-		}
+// startSession logs userID in: it stores a new session, sets the cookie and
+// writes the login success response. A pending deletion of the account is
+// cancelled.
+func startSession(db *sql.DB, w http.ResponseWriter, r *http.Request, userID int) {
+	// Several sessions per user are allowed (one per device); only clean up expired ones
+	if err := database.DeleteExpiredSessions(db, userID); err != nil {
+		fmt.Println(" Error deleting expired sessions:", err)
+	}
 
-		//  Generate new session token and expiration
-		sessionToken := uuid.New().String()
-		expiresAt := time.Now().Add(24 * time.Hour)
+	//  Generate new session token and expiration
+	sessionToken := uuid.New().String()
+	expiresAt := time.Now().Add(SessionIdleTimeout)
 
-		//  Store new session in the database
-		err = database.InsertSession(db, userID, sessionToken, expiresAt)
-		if err != nil {
-			fmt.Println(" Error inserting new session:", err)
-			http.Error(w, "Failed to create session", http.StatusInternalServerError)
-			return
-		}
+	//  Store new session in the database
+	err := database.InsertSession(db, userID, sessionToken, expiresAt, r.UserAgent(), ClientIP(r))
+	if err != nil {
+		fmt.Println(" Error inserting new session:", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 
-		//  Set session token as a cookie
-		// For local development explicitly set Domain to localhost to avoid host mismatches
-		cookie := &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken,
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Path:     "/",
-			Domain:   "localhost",
-		}
-		http.SetCookie(w, cookie)
+	//  Set session token as a cookie
+	// The cookie lives as long as the session can be extended; the server enforces the idle timeout
+	SetSessionCookie(w, r, sessionToken, time.Now().Add(SessionMaxLifetime))
 
-		fmt.Println(" Login successful for User ID:", userID)
+	fmt.Println(" Login successful for User ID:", userID)
 
-		//  Send success response
-		response := map[string]string{"message": "Login successful."}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
+	// Logging in during the grace period keeps an account the user asked to delete
+	restored, err := database.CancelAccountDeletion(db, userID)
+	if err != nil {
+		fmt.Println(" Error cancelling account deletion:", err)
+	} else if restored {
+		fmt.Println(" Account deletion cancelled for User ID:", userID)
 	}
+
+	//  Send success response
+	response := map[string]interface{}{"message": "Login successful.", "account_restored": restored}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,157 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/mail"
+	database "socialnetwork/pkg/db"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetTTL is how long a reset link stays valid.
+const PasswordResetTTL = time.Hour
+
+// forgotPasswordReply is sent whether or not the email belongs to an account,
+// so the endpoint cannot be used to find registered addresses.
+const forgotPasswordReply = "If an account exists for that email, a password reset link has been sent to it."
+
+// ForgotPassword handles POST /forgot-password {"email"}. It emails a single
+// use reset link to the account with that address, if there is one. The
+// email is sent in the background, so the reply comes as fast whether the
+// account exists or not; an address asking too often gets 429, and an email
+// asked for too often gets no further link, with the usual reply.
+func ForgotPassword(db *sql.DB, mailer mail.Mailer, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !ValidateEmailFormat(email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	ip := ClientIP(r)
+	if wait := throttle.ResetIP.Check(ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	throttle.ResetIP.Record(ip)
+
+	if throttle.ResetEmail.Check(email) == 0 {
+		throttle.ResetEmail.Record(email)
+		go func() {
+			userID, err := database.GetUserIDByEmail(db, email)
+			if err == nil {
+				err = sendPasswordReset(db, mailer, userID, email)
+			}
+			if err != nil && err != sql.ErrNoRows {
+				fmt.Println("Error sending password reset:", err)
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": forgotPasswordReply,
+	})
+}
+
+func sendPasswordReset(db *sql.DB, mailer mail.Mailer, userID int, email string) error {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return err
+	}
+	if err := database.CreatePasswordReset(db, userID, tokenHash, time.Now().Add(PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	link := AppURL() + "/resetPassword?token=" + url.QueryEscape(token)
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your account.\n\n" +
+			"Open this link to choose a new password. It works once and expires in one hour:\n\n" +
+			link + "\n\n" +
+			"If it wasn't you, ignore this email; your password stays the same.",
+	})
+}
+
+// ResetPassword handles POST /reset-password {"token", "password"}. It spends
+// the token, sets the new password and logs the account out everywhere.
+func ResetPassword(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !CheckIfPassValid(req.Password) {
+		writeFailure(w, http.StatusBadRequest, "Invalid password format. Your password must be at least 10 characters long and contain uppercase, lowercase, numbers, and special characters.")
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, tokens, err := database.ResetPassword(db, hashToken(req.Token), string(hashed))
+	if err == sql.ErrNoRows {
+		writeFailure(w, http.StatusBadRequest, "This reset link is invalid or has expired.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error resetting password:", err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if hub != nil {
+		for _, token := range tokens {
+			hub.CloseSession(token)
+		}
+	}
+	fmt.Println("Password reset for User ID:", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Your password has been changed. Please log in again.",
+	})
+}
+
+// writeFailure writes a {"success": false, "message"} JSON response.
+func writeFailure(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": message,
+	})
+}
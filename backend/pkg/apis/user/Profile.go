@@ -14,6 +14,8 @@ import (
 	"time"
 
 	chat "socialnetwork/pkg/apis/chat"
+	"socialnetwork/pkg/apis/mail"
+	database "socialnetwork/pkg/db"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -125,7 +127,10 @@ func GetProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, usern
 	})
 }
 
-func UpdateProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, currentUsername string) {
+// UpdateProfileHandler updates the profile of currentUsername. Changing the
+// password logs out every other session of the account; a new email address
+// has to be verified again.
+func UpdateProfileHandler(db *sql.DB, hub *chat.Hub, mailer mail.Mailer, w http.ResponseWriter, r *http.Request, currentUsername string) {
 	// Handle both JSON and multipart form data
 	contentType := r.Header.Get("Content-Type")
 	fmt.Println("[UpdateProfile] Content-Type:", contentType)
@@ -162,6 +167,9 @@ func UpdateProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, cu
 		// Debug: log received multipart form keys and files
 		if r.MultipartForm != nil {
 			for k, v := range r.MultipartForm.Value {
+				if k == "password" || k == "newPassword" {
+					continue
+				}
 				fmt.Printf("[UpdateProfile] Form value %s: %v\n", k, v)
 			}
 			for k, files := range r.MultipartForm.File {
@@ -373,7 +381,6 @@ func UpdateProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, cu
 	newPassword := formValues["newPassword"]
 	passwordHash := existing.Password // default: unchanged
 
-	fmt.Println("New password: ", newPassword)
 	// 4a) if newPassword provided, verify oldPassword and re-hash
 	if strings.TrimSpace(newPassword) != "" {
 		if err := bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(oldPassword)); err != nil {
@@ -427,8 +434,6 @@ func UpdateProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, cu
 		"lname":     lname,
 		"email":     email,
 		"age":       age,
-		"password":  oldPassword,
-		"newPass":   newPassword,
 		"gender":    gender,
 		"bio":       bio,
 		"avatar":    avatarURL,
@@ -446,6 +451,34 @@ func UpdateProfileHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, cu
 		return
 	}
 
+	if email != existing.Email {
+		if userID, err := database.GetUserID(db, username); err == nil && userID > 0 {
+			if err := database.MarkEmailUnverified(db, userID); err != nil {
+				fmt.Println("Error resetting email verification:", err)
+			} else if err := SendVerificationEmail(db, mailer, userID, email); err != nil {
+				fmt.Println("Error sending verification email:", err)
+			}
+		}
+	}
+
+	if passwordHash != existing.Password {
+		var keep string
+		if cookie, err := r.Cookie("session_token"); err == nil {
+			keep = cookie.Value
+		}
+		if userID, err := database.GetUserID(db, username); err == nil && userID > 0 {
+			tokens, err := database.DeleteOtherSessions(db, userID, keep)
+			if err != nil {
+				fmt.Println("Error revoking sessions after password change:", err)
+			}
+			if hub != nil {
+				for _, token := range tokens {
+					hub.CloseSession(token)
+				}
+			}
+		}
+	}
+
 	// 6) respond (never include password/hash)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -824,21 +857,13 @@ func TogglePrivacy(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Req
 	if hub != nil {
 		var username string
 		_ = db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-		notif := chat.Frontend{
-			Type:      "privacy_update",
+		notif := chat.PrivacyUpdate{
 			From:      userID,
 			Username:  username,
 			IsPrivate: newPrivacy,
 			Timestamp: time.Now(),
 		}
-		hub.Mutex.RLock()
-		for _, client := range hub.Clients {
-			select {
-			case client.Send <- notif:
-			default:
-			}
-		}
-		hub.Mutex.RUnlock()
+		hub.BroadcastToAll(notif)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
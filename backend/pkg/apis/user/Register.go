@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"socialnetwork/pkg/apis/mail"
 	database "socialnetwork/pkg/db"
 	"strconv"
 	"strings"
@@ -37,13 +38,23 @@ var userData struct {
 	Password string `json:"password"`
 }
 
-// Register handles user registration
-func Register(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+// Register handles user registration: it creates an account and emails it a
+// verification link. Every attempt counts against the client address's signup
+// limit, so the endpoint cannot be used to mass-create accounts or probe for
+// taken names.
+func Register(db *sql.DB, mailer mail.Mailer, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	signupKey := ClientIP(r)
+	if wait := throttle.Signup.Check(signupKey); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	throttle.Signup.Record(signupKey)
+
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		http.Error(w, "could not parse form", http.StatusBadRequest)
 		return
@@ -151,17 +162,23 @@ func Register(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// IMPORTANT: ensure this argument order matches your InsertUser signature/columns
-	if _, err := database.InsertUser(
+	userID, err := database.InsertUser(
 		db,
 		username, nickname, email, fname, lname, age, gender, string(hashedPassword), bio, avatarURL, dateOfBirth,
-	); err != nil {
+	)
+	if err != nil {
 		log.Println("InsertUser error:", err) // <— watch this in your console
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// The account exists either way; the user can ask for another link
+	if err := SendVerificationEmail(db, mailer, int(userID), email); err != nil {
+		log.Println("verification email error:", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(RegistrationResponse{Success: true, Message: "User registered successfully."})
+	json.NewEncoder(w).Encode(RegistrationResponse{Success: true, Message: "User registered successfully. Check your email to verify your address."})
 }
 
 func checkIfUsernameExists(db *sql.DB, username string) bool {
@@ -297,18 +314,41 @@ func CheckIfPassValid(pass string) bool {
 	return hasUpper && hasLower && hasNumber && hasSpecial
 }
 
+// ValidateSession returns the user r is authenticated as: by the session
+// cookie, or by a personal access token with the scope the endpoint needs when
+// it has an "Authorization: Bearer" header.
 func ValidateSession(db *sql.DB, r *http.Request) (int, bool) {
+	if HasBearerToken(r) {
+		return validateAccessToken(db, r)
+	}
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
-		return 0, false // No session found
+		return 0, false
 	}
 
 	var userID int
 	var expiresAt time.Time
-	query := `SELECT user_id, expires_at FROM sessions WHERE token = ?`
-	err = db.QueryRow(query, cookie.Value).Scan(&userID, &expiresAt)
-	if err != nil || time.Now().After(expiresAt) {
-		return 0, false // Session expired or not found
+	var createdAt, lastSeen sql.NullTime
+	query := `SELECT user_id, expires_at, created_at, last_seen FROM sessions WHERE token = ?`
+	err = db.QueryRow(query, cookie.Value).Scan(&userID, &expiresAt, &createdAt, &lastSeen)
+	if err != nil {
+		return 0, false
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) {
+		return 0, false
+	}
+
+	// Sliding expiry: activity pushes the expiry forward, up to the max lifetime
+	if !lastSeen.Valid || now.Sub(lastSeen.Time) >= sessionTouchInterval {
+		newExpiry := now.Add(SessionIdleTimeout)
+		if createdAt.Valid && newExpiry.After(createdAt.Time.Add(SessionMaxLifetime)) {
+			newExpiry = createdAt.Time.Add(SessionMaxLifetime)
+		}
+		if err := database.TouchSession(db, cookie.Value, now, newExpiry); err != nil {
+			fmt.Println("Error updating session activity:", err)
+		}
 	}
 
 	return userID, true
@@ -0,0 +1,116 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"socialnetwork/pkg/apis/chat"
+	database "socialnetwork/pkg/db"
+)
+
+// GetSessions lists the active sessions (devices) of the logged in user
+func GetSessions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+	cookie, _ := r.Cookie("session_token")
+
+	sessions, err := database.GetSessionsByUserID(db, userID, cookie.Value)
+	if err != nil {
+		fmt.Println("Error fetching sessions:", err)
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession logs out one of the user's sessions and closes its WebSocket connections
+func RevokeSession(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		SessionID int `json:"session_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionID <= 0 {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	token, err := database.DeleteUserSession(db, userID, req.SessionID)
+	if err != nil {
+		fmt.Println("Error revoking session:", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if token == "" {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if hub != nil {
+		hub.CloseSession(token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions logs out every session of the user except the current one
+func RevokeOtherSessions(db *sql.DB, hub *chat.Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+	cookie, _ := r.Cookie("session_token")
+
+	tokens, err := database.DeleteOtherSessions(db, userID, cookie.Value)
+	if err != nil {
+		fmt.Println("Error revoking sessions:", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if hub != nil {
+		for _, token := range tokens {
+			hub.CloseSession(token)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": len(tokens),
+	})
+}
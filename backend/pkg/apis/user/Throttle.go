@@ -0,0 +1,206 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"socialnetwork/pkg/apis/ratelimit"
+	database "socialnetwork/pkg/db"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginFailedMessage is the only reply to a wrong login, whether the account
+// exists or not.
+const loginFailedMessage = "Invalid username/email or password."
+
+// Throttle holds the limiters guarding login, signup, and password reset and
+// verification emails.
+type Throttle struct {
+	// Account counts failed logins (passwords and authentication codes) per
+	// account; unknown usernames and emails are counted too.
+	Account ratelimit.Limiter
+	// IP counts failed logins per client address, across accounts.
+	IP ratelimit.Limiter
+	// Signup counts signup attempts per client address.
+	Signup ratelimit.Limiter
+	// ResetIP counts password reset requests per client address.
+	ResetIP ratelimit.Limiter
+	// ResetEmail counts password reset requests per email address, known
+	// or not.
+	ResetEmail ratelimit.Limiter
+	// VerifyIP counts anonymous verification email requests per client
+	// address.
+	VerifyIP ratelimit.Limiter
+	// VerifyEmail counts anonymous verification email requests per email
+	// address, known or not.
+	VerifyEmail ratelimit.Limiter
+}
+
+// NewThrottle returns a Throttle backed by in-process limiters:
+//   - an account has 5 free failures; each further one makes it wait 1s,
+//     2s, 4s... (up to 1 min) and the 10th locks it for 15 minutes;
+//   - an address has 20 free failures and the 50th locks it for an hour;
+//   - an address has 5 free signups; each further one makes it wait 1 min,
+//     2 min... (up to 1h) before the next;
+//   - an address has 10 free password reset requests; each further one
+//     makes it wait 1 min, 2 min... (up to 1h) before the next;
+//   - an email address has 3 free reset emails; each further one makes it
+//     wait 5 min, 10 min... (up to 1h) before the next;
+//   - verification email requests are limited like password reset ones.
+func NewThrottle() *Throttle {
+	return &Throttle{
+		Account: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 5, Base: time.Second, MaxDelay: time.Minute,
+			LockAfter: 10, Lockout: 15 * time.Minute, Window: time.Hour,
+		}),
+		IP: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 20, Base: time.Second, MaxDelay: time.Minute,
+			LockAfter: 50, Lockout: time.Hour, Window: time.Hour,
+		}),
+		Signup: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 5, Base: time.Minute, MaxDelay: time.Hour,
+			Window: 24 * time.Hour,
+		}),
+		ResetIP: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 10, Base: time.Minute, MaxDelay: time.Hour,
+			Window: 24 * time.Hour,
+		}),
+		ResetEmail: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 3, Base: 5 * time.Minute, MaxDelay: time.Hour,
+			Window: 24 * time.Hour,
+		}),
+		VerifyIP: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 10, Base: time.Minute, MaxDelay: time.Hour,
+			Window: 24 * time.Hour,
+		}),
+		VerifyEmail: ratelimit.NewMemory(ratelimit.Policy{
+			Free: 3, Base: 5 * time.Minute, MaxDelay: time.Hour,
+			Window: 24 * time.Hour,
+		}),
+	}
+}
+
+// loginWait returns how long a login of account from ip has to wait.
+func (t *Throttle) loginWait(account, ip string) time.Duration {
+	return max(t.Account.Check(account), t.IP.Check(ip))
+}
+
+// loginFailed counts a failed login of account from ip. Lockouts of an
+// existing account (userID > 0) are recorded for its owner.
+func (t *Throttle) loginFailed(db *sql.DB, account, ip string, userID int) {
+	now := time.Now()
+	for scope, res := range map[string]ratelimit.Result{
+		"account": t.Account.Record(account),
+		"ip":      t.IP.Record(ip),
+	} {
+		if !res.Locked {
+			continue
+		}
+		fmt.Printf("Login lockout (%s) for %q from %s\n", scope, account, ip)
+		if userID > 0 {
+			if err := database.InsertLoginLockout(db, userID, scope, ip, now, now.Add(res.Wait)); err != nil {
+				fmt.Println("Error recording login lockout:", err)
+			}
+		}
+	}
+}
+
+// loginAccount resolves a username or email to its user and the key its
+// failed logins are counted under. Both names of an account share a key;
+// unknown names get one of their own, so they are throttled the same way.
+func loginAccount(db *sql.DB, userOremail string) (int, string, error) {
+	userID, err := database.GetUserID(db, userOremail)
+	if err == nil && userID <= 0 {
+		userID, err = database.GetUserIDByEmail(db, strings.ToLower(userOremail))
+	}
+	if err == sql.ErrNoRows {
+		return 0, "name:" + strings.ToLower(userOremail), nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, accountKey(userID), nil
+}
+
+func accountKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// dummyPasswordHash is compared against when the account does not exist, so
+// a failed login takes as long either way.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// writeRetryAfter writes a 429 response telling the client to wait.
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     false,
+		"message":     message,
+		"retry_after": seconds,
+	})
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	writeRetryAfter(w, wait, fmt.Sprintf("Too many attempts. Please try again in %s.", roundWait(wait)))
+}
+
+// roundWait formats a wait for people: whole seconds, or whole minutes from
+// a minute up.
+func roundWait(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 60 {
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	minutes := (seconds + 59) / 60
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// GetLoginLockouts handles GET /security/lockouts: the recent lockouts of the
+// logged in user's account caused by failed logins.
+func GetLoginLockouts(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	lockouts, err := database.GetLoginLockouts(db, userID, 50)
+	if err != nil {
+		fmt.Println("Error fetching login lockouts:", err)
+		http.Error(w, "Failed to fetch login lockouts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"lockouts": lockouts,
+	})
+}
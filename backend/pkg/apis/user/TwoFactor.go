@@ -0,0 +1,443 @@
+package user
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"socialnetwork/pkg/apis/totp"
+	database "socialnetwork/pkg/db"
+)
+
+const (
+	// LoginChallengeTTL is how long a login may wait between the password and the code.
+	LoginChallengeTTL = 5 * time.Minute
+	// loginChallengeAttempts is how many codes may be tried per pending login.
+	loginChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes are issued at a time.
+	recoveryCodeCount = 10
+	totpIssuer        = "SocialNet"
+)
+
+// recoveryAlphabet avoids characters that are easy to misread.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCodes returns fresh recovery codes, formatted xxxxx-xxxxx, and
+// the hashes stored for them.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// newRecoveryCode returns one random recovery code. Random bytes from
+// recoveryLimit up are skipped, so every character is equally likely.
+func newRecoveryCode() (string, error) {
+	const recoveryLimit = 256 / len(recoveryAlphabet) * len(recoveryAlphabet)
+	var b strings.Builder
+	buf := make([]byte, 16)
+	for n := 0; n < 10; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if n == 10 {
+				break
+			}
+			if int(c) >= recoveryLimit {
+				continue
+			}
+			if n == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+			n++
+		}
+	}
+	return b.String(), nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed, ignoring case, spaces and dashes.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashToken(code)
+}
+
+// checkTOTP validates a code from the user's authenticator app and spends its
+// time step so it cannot be replayed.
+func checkTOTP(db *sql.DB, userID int, code string) (bool, error) {
+	secret, enabled, _, err := database.GetTOTP(db, userID)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return database.UseTOTPStep(db, userID, step)
+}
+
+// checkSecondFactor accepts either an authenticator code or an unused
+// recovery code.
+func checkSecondFactor(db *sql.DB, userID int, code, recoveryCode string) (bool, error) {
+	if strings.TrimSpace(code) != "" {
+		return checkTOTP(db, userID, code)
+	}
+	if strings.TrimSpace(recoveryCode) != "" {
+		return database.UseRecoveryCode(db, userID, hashRecoveryCode(recoveryCode))
+	}
+	return false, nil
+}
+
+// startTwoFactorLogin answers a correct password of a 2FA account with a
+// pending-auth token instead of a session.
+func startTwoFactorLogin(db *sql.DB, w http.ResponseWriter, userID int) {
+	token, tokenHash, err := newToken()
+	if err == nil {
+		err = database.CreateLoginChallenge(db, tokenHash, userID, time.Now().UTC().Add(LoginChallengeTTL))
+	}
+	if err != nil {
+		fmt.Println(" Error creating login challenge:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Two-factor authentication required.",
+		"two_factor_required": true,
+		"pending_token":       token,
+	})
+}
+
+// LoginTwoFactor handles POST /login/2fa {"pending_token", "code"} (or
+// "recovery_code"), the second step of a 2FA login.
+func LoginTwoFactor(db *sql.DB, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PendingToken string `json:"pending_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PendingToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := hashToken(req.PendingToken)
+	userID, err := database.CheckLoginChallenge(db, tokenHash, loginChallengeAttempts)
+	if err == sql.ErrNoRows {
+		writeFailure(w, http.StatusUnauthorized, "Your login has expired. Please sign in again.")
+		return
+	}
+	if err != nil {
+		fmt.Println(" Error checking login challenge:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	account, ip := accountKey(userID), ClientIP(r)
+	if wait := throttle.loginWait(account, ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, err := checkSecondFactor(db, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		fmt.Println(" Error checking second factor:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Invalid authentication code.")
+		return
+	}
+	throttle.Account.Reset(account)
+
+	if err := database.DeleteLoginChallenge(db, tokenHash); err != nil {
+		fmt.Println(" Error deleting login challenge:", err)
+	}
+	startSession(db, w, r, userID)
+}
+
+// TwoFactorStatus handles GET /2fa/status.
+func TwoFactorStatus(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := database.IsTOTPEnabled(db, userID)
+	var left int
+	if err == nil && enabled {
+		left, err = database.CountRecoveryCodes(db, userID)
+	}
+	if err != nil {
+		fmt.Println("Error getting two-factor status:", err)
+		http.Error(w, "Failed to get two-factor status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":             true,
+		"enabled":             enabled,
+		"recovery_codes_left": left,
+	})
+}
+
+// EnrollTwoFactor handles POST /2fa/enroll. It creates a new secret and
+// returns it with its otpauth URI; 2FA is only on once ConfirmTwoFactor
+// accepts a first code.
+func EnrollTwoFactor(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := database.IsTOTPEnabled(db, userID)
+	if err != nil {
+		fmt.Println("Error checking two-factor status:", err)
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		writeFailure(w, http.StatusConflict, "Two-factor authentication is already enabled.")
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err == nil {
+		err = database.SetPendingTOTP(db, userID, secret)
+	}
+	username, email, cerr := database.GetUserContact(db, userID)
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println("Error starting two-factor enrollment:", err)
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	account := email
+	if account == "" {
+		account = username
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, account, secret),
+	})
+}
+
+// ConfirmTwoFactor handles POST /2fa/confirm {"code"}. A valid code from the
+// enrolled app turns 2FA on; the response carries the recovery codes, which
+// are not shown again.
+func ConfirmTwoFactor(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, _, err := database.GetTOTP(db, userID)
+	if err == sql.ErrNoRows {
+		writeFailure(w, http.StatusBadRequest, "Start the enrollment first.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error getting two-factor secret:", err)
+		http.Error(w, "Failed to confirm two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		writeFailure(w, http.StatusConflict, "Two-factor authentication is already enabled.")
+		return
+	}
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		writeFailure(w, http.StatusBadRequest, "Invalid authentication code.")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = database.EnableTOTP(db, userID, step, hashes)
+	}
+	if err != nil {
+		fmt.Println("Error enabling two-factor authentication:", err)
+		http.Error(w, "Failed to confirm two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor handles POST /2fa/disable {"password", "code"} (or
+// "recovery_code"). Both factors are required, and failures count towards
+// the account's login throttle, so a stolen session cannot guess the code.
+func DisableTwoFactor(db *sql.DB, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	account, ip := accountKey(userID), ClientIP(r)
+	if wait := throttle.loginWait(account, ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, err := checkPassword(db, userID, req.Password)
+	if err != nil {
+		fmt.Println("Error getting password:", err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Wrong password")
+		return
+	}
+
+	ok, err = checkSecondFactor(db, userID, req.Code, req.RecoveryCode)
+	if err == nil && ok {
+		err = database.DisableTOTP(db, userID)
+	}
+	if err != nil {
+		fmt.Println("Error disabling two-factor authentication:", err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Invalid authentication code.")
+		return
+	}
+	throttle.Account.Reset(account)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// RegenerateRecoveryCodes handles POST /2fa/recovery-codes {"code"}. The old
+// recovery codes stop working and new ones are returned.
+func RegenerateRecoveryCodes(db *sql.DB, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Throttled like DisableTwoFactor: new codes are as good as the secret
+	account, ip := accountKey(userID), ClientIP(r)
+	if wait := throttle.loginWait(account, ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, err := checkTOTP(db, userID, req.Code)
+	if err != nil {
+		fmt.Println("Error checking authentication code:", err)
+		http.Error(w, "Failed to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		throttle.loginFailed(db, account, ip, userID)
+		writeFailure(w, http.StatusUnauthorized, "Invalid authentication code.")
+		return
+	}
+	throttle.Account.Reset(account)
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = database.ReplaceRecoveryCodes(db, userID, hashes)
+	}
+	if err != nil {
+		fmt.Println("Error regenerating recovery codes:", err)
+		http.Error(w, "Failed to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
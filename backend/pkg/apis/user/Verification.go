@@ -0,0 +1,227 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"socialnetwork/pkg/apis/mail"
+	database "socialnetwork/pkg/db"
+)
+
+const (
+	// EmailVerificationTTL is how long a verification link stays valid.
+	EmailVerificationTTL = 48 * time.Hour
+	// VerificationResendCooldown is the minimum time between two verification emails to a user.
+	VerificationResendCooldown = 2 * time.Minute
+)
+
+// UnverifiedPolicy is what users who have not confirmed their email address
+// may do. It is read from UNVERIFIED_POLICY.
+type UnverifiedPolicy string
+
+const (
+	// UnverifiedAllow puts no restriction on unverified users.
+	UnverifiedAllow UnverifiedPolicy = "allow"
+	// UnverifiedReadOnly lets unverified users log in and browse, but not
+	// post, comment, like, follow, chat or change anything else.
+	UnverifiedReadOnly UnverifiedPolicy = "read_only"
+	// UnverifiedBlock refuses to log unverified users in.
+	UnverifiedBlock UnverifiedPolicy = "block"
+)
+
+// UnverifiedPolicyFromEnv returns the configured policy, UnverifiedReadOnly
+// if UNVERIFIED_POLICY is unset or unknown.
+func UnverifiedPolicyFromEnv() UnverifiedPolicy {
+	switch p := UnverifiedPolicy(os.Getenv("UNVERIFIED_POLICY")); p {
+	case UnverifiedAllow, UnverifiedReadOnly, UnverifiedBlock:
+		return p
+	case "":
+	default:
+		fmt.Printf("Unknown UNVERIFIED_POLICY %q, using %q\n", p, UnverifiedReadOnly)
+	}
+	return UnverifiedReadOnly
+}
+
+// CanWrite reports whether userID may make changes under the policy.
+func (p UnverifiedPolicy) CanWrite(db *sql.DB, userID int) (bool, error) {
+	if p == UnverifiedAllow {
+		return true, nil
+	}
+	return database.IsEmailVerified(db, userID)
+}
+
+// SendVerificationEmail issues a new verification link for userID and mails
+// it to email. Any earlier link stops working.
+func SendVerificationEmail(db *sql.DB, mailer mail.Mailer, userID int, email string) error {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := database.SetEmailVerification(db, userID, tokenHash, now.Add(EmailVerificationTTL), now); err != nil {
+		return err
+	}
+
+	link := AppURL() + "/verifyEmail?token=" + url.QueryEscape(token)
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: "Welcome to SocialNet!\n\n" +
+			"Open this link to confirm your email address. It expires in 48 hours:\n\n" +
+			link + "\n\n" +
+			"If you did not create an account, ignore this email.",
+	})
+}
+
+// VerifyEmail handles POST /verify-email {"token"}.
+func VerifyEmail(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := database.VerifyEmail(db, hashToken(req.Token))
+	if err == sql.ErrNoRows {
+		writeFailure(w, http.StatusBadRequest, "This verification link is invalid or has expired.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error verifying email:", err)
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	fmt.Println("Email verified for User ID:", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Your email address is verified.",
+	})
+}
+
+// ResendVerification handles POST /resend-verification. A logged in user
+// gets a new link for their own account; otherwise the body names the
+// address {"email"} and the reply does not tell whether it is registered:
+// the email is sent in the background, and the address and email asked for
+// are throttled like password resets. Links are sent at most once per
+// VerificationResendCooldown.
+func ResendVerification(db *sql.DB, mailer mail.Mailer, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, loggedIn := ValidateSession(db, r)
+	if !loggedIn {
+		resendVerificationByEmail(db, mailer, throttle, w, r)
+		return
+	}
+
+	wait, err := resendVerification(db, mailer, userID)
+	if err == errAlreadyVerified {
+		writeVerificationReply(w, "Your email address is already verified.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error resending verification:", err)
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeRetryAfter(w, wait, "A verification email was sent recently. Please wait before asking for another.")
+		return
+	}
+	writeVerificationReply(w, "A new verification link has been sent to your email address.")
+}
+
+// resendVerificationByEmail answers a resend request from someone who is not
+// logged in.
+func resendVerificationByEmail(db *sql.DB, mailer mail.Mailer, throttle *Throttle, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !ValidateEmailFormat(email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	ip := ClientIP(r)
+	if wait := throttle.VerifyIP.Check(ip); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	throttle.VerifyIP.Record(ip)
+
+	if throttle.VerifyEmail.Check(email) == 0 {
+		throttle.VerifyEmail.Record(email)
+		go func() {
+			userID, err := database.GetUserIDByEmail(db, email)
+			if err == nil {
+				_, err = resendVerification(db, mailer, userID)
+			}
+			if err != nil && err != sql.ErrNoRows && err != errAlreadyVerified {
+				fmt.Println("Error resending verification:", err)
+			}
+		}()
+	}
+
+	writeVerificationReply(w, "If the address belongs to an unverified account, a new verification link has been sent to it.")
+}
+
+// errAlreadyVerified is returned by resendVerification for users whose
+// address is verified already.
+var errAlreadyVerified = errors.New("email already verified")
+
+// resendVerification mails a new link to an unverified user. It returns how
+// long to wait instead if the last link was sent less than the cooldown ago.
+func resendVerification(db *sql.DB, mailer mail.Mailer, userID int) (time.Duration, error) {
+	verified, err := database.IsEmailVerified(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	if verified {
+		return 0, errAlreadyVerified
+	}
+	sentAt, err := database.GetEmailVerificationSentAt(db, userID)
+	if err == nil {
+		if wait := VerificationResendCooldown - time.Since(sentAt); wait > 0 {
+			return wait, nil
+		}
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	_, email, err := database.GetUserContact(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	return 0, SendVerificationEmail(db, mailer, userID, email)
+}
+
+func writeVerificationReply(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
@@ -1,7 +1,17 @@
 package user
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -43,3 +53,96 @@ func ComputeAgeFromDOB(dob string) (int, string, error) {
 	normalized := t.Format("2006-01-02")
 	return years, normalized, nil
 }
+
+// ClientIP returns the IP address of the client that made the request. The
+// last X-Forwarded-For entry is used only when the request comes from one of
+// the TRUSTED_PROXIES (comma separated IPs, e.g. the Next.js server whose API
+// routes forward logins and signups); otherwise the header is ignored.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return host
+	}
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	if ip := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" && proxy == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadPath returns the file behind the public URL path of an uploaded
+// image, e.g. /img/posts/cat.png. It reports false for paths outside
+// public/img.
+func UploadPath(urlPath string) (string, bool) {
+	clean := path.Clean("/" + urlPath)
+	if !strings.HasPrefix(clean, "/img/") {
+		return "", false
+	}
+	publicDir := filepath.Join("..", "frontend-next", "public")
+	if staticDir := os.Getenv("STATIC_DIR"); staticDir != "" {
+		publicDir = filepath.Join(staticDir, "public")
+	}
+	return filepath.Join(publicDir, filepath.FromSlash(clean)), true
+}
+
+// SetSessionCookie sends the session cookie. It is HttpOnly and SameSite=Lax,
+// so other sites cannot send it along with their requests; it is Secure when
+// served over HTTPS or when COOKIE_SECURE=true (behind a TLS proxy). It is a
+// host-only cookie unless COOKIE_DOMAIN is set.
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    token,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || os.Getenv("COOKIE_SECURE") == "true",
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+	})
+}
+
+// ClearSessionCookie expires the session cookie.
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	SetSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
+}
+
+// AppURL is the base URL of the frontend, used for links in emails. It is
+// read from APP_URL.
+func AppURL() string {
+	if v := strings.TrimRight(os.Getenv("APP_URL"), "/"); v != "" {
+		return v
+	}
+	return "http://localhost:3000"
+}
+
+// newToken returns a random URL safe token and the hash stored for it.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
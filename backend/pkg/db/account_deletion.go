@@ -0,0 +1,284 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DefaultAvatar is the avatar of users who never uploaded one; it is shared
+// and never deleted.
+const DefaultAvatar = "/img/avatars/images.png"
+
+// ScheduleAccountDeletion marks userID for deletion at purgeAfter, logs it
+// out everywhere and revokes its access tokens. It returns the tokens of the
+// removed sessions.
+func ScheduleAccountDeletion(db *sql.DB, userID int, requestedAt, purgeAfter time.Time) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET deletion_requested_at = ?, purge_after = ? WHERE id = ?`,
+		requestedAt, purgeAfter, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	tokens, err := deleteSessions(tx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	return tokens, tx.Commit()
+}
+
+// CancelAccountDeletion clears the pending deletion of userID, if any, and
+// reports whether there was one.
+func CancelAccountDeletion(db *sql.DB, userID int) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE users SET deletion_requested_at = NULL, purge_after = NULL
+		WHERE id = ? AND purge_after IS NOT NULL`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DueAccountDeletions returns the users whose grace period ended by now.
+func DueAccountDeletions(db *sql.DB, now time.Time) ([]int, error) {
+	rows, err := db.Query(`SELECT id, purge_after FROM users WHERE purge_after IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []int
+	for rows.Next() {
+		var id int
+		var purgeAfter time.Time
+		if err := rows.Scan(&id, &purgeAfter); err != nil {
+			return nil, err
+		}
+		if !now.Before(purgeAfter) {
+			due = append(due, id)
+		}
+	}
+	return due, rows.Err()
+}
+
+// PurgeAccount erases userID and everything it owns: posts, comments,
+// reactions, chats, follows, memberships, RSVPs, data exports and account data. Groups it
+// created go to another member, admins first, or are dissolved if it was the
+// only one; its events in groups that stay pass to the group's new creator.
+// It returns the uploaded images (public URL paths) nothing refers to any
+// more; deleting the files is up to the caller.
+func PurgeAccount(db *sql.DB, userID int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	files, err := collectStrings(tx, `
+		SELECT avatar_url FROM users WHERE id = ?1
+		UNION SELECT imgOrgif FROM posts WHERE user_id = ?1
+		UNION SELECT imgOrgif FROM comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+		UNION SELECT imgOrgif FROM group_posts WHERE user_id = ?1
+		UNION SELECT imgOrgif FROM group_post_comments
+			WHERE user_id = ?1 OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := collectInts(tx, `SELECT id FROM groups WHERE creator_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupID := range groups {
+		var successor int
+		err := tx.QueryRow(`
+			SELECT user_id FROM group_members
+			WHERE group_id = ? AND user_id != ? AND status = 'accepted'
+			ORDER BY is_admin DESC, joined_at, id
+			LIMIT 1`, groupID, userID).Scan(&successor)
+		if err == sql.ErrNoRows {
+			groupFiles, err := dissolveGroup(tx, groupID)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, groupFiles...)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE groups SET creator_id = ? WHERE id = ?`, successor, groupID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE group_members SET is_admin = 1 WHERE group_id = ? AND user_id = ?`, groupID, successor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Free the seats the user held at events before dropping the RSVPs.
+	// Members moved off a waitlist here are not notified.
+	going, err := collectInts(tx, `SELECT event_id FROM event_rsvps WHERE user_id = ? AND status = 'going'`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM event_rsvps WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	for _, eventID := range going {
+		if _, err := promoteWaitlist(tx, eventID); err != nil {
+			return nil, err
+		}
+	}
+
+	queries := []string{
+		// Posts and everything on them, and the user's comments and reactions elsewhere
+		`DELETE FROM likes WHERE user_id = ?1
+			OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+			OR comment_id IN (SELECT id FROM comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1))`,
+		`DELETE FROM comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+		`DELETE FROM post_categories WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+		`DELETE FROM post_permissions WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+		`DELETE FROM posts WHERE user_id = ?1`,
+
+		// Group content
+		`DELETE FROM group_post_likes WHERE user_id = ?1 OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`,
+		`DELETE FROM group_post_dislikes WHERE user_id = ?1 OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`,
+		`DELETE FROM group_post_comments WHERE user_id = ?1 OR group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`,
+		`DELETE FROM group_post_categories WHERE group_post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`,
+		`DELETE FROM group_posts WHERE user_id = ?1`,
+		`DELETE FROM group_messages WHERE sender_id = ?1`,
+		`DELETE FROM group_invitations WHERE inviter_id = ?1 OR invitee_id = ?1`,
+		`DELETE FROM group_members WHERE user_id = ?1`,
+		`UPDATE events SET creator_id = (SELECT g.creator_id FROM groups g WHERE g.id = events.group_id) WHERE creator_id = ?1`,
+
+		// Relationships and conversations
+		`DELETE FROM userFollow WHERE follower_id = ?1 OR following_id = ?1`,
+		`DELETE FROM follow_requests WHERE requester_id = ?1 OR target_id = ?1`,
+		`DELETE FROM messages WHERE sender_id = ?1 OR receiver_id = ?1`,
+		`DELETE FROM notifications WHERE user_id = ?1 OR actor_id = ?1`,
+
+		// The account itself
+		`DELETE FROM sessions WHERE user_id = ?1`,
+		`DELETE FROM login_challenges WHERE user_id = ?1`,
+		`DELETE FROM login_lockouts WHERE user_id = ?1`,
+		`DELETE FROM password_resets WHERE user_id = ?1`,
+		`DELETE FROM email_verifications WHERE user_id = ?1`,
+		`DELETE FROM totp_recovery_codes WHERE user_id = ?1`,
+		`DELETE FROM user_totp WHERE user_id = ?1`,
+		`DELETE FROM calendar_tokens WHERE user_id = ?1`,
+		`DELETE FROM api_tokens WHERE user_id = ?1`,
+		`DELETE FROM data_exports WHERE user_id = ?1`,
+		`DELETE FROM users WHERE id = ?1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Uploads keep their original name in some folders, so another row may
+	// still point at the same file
+	var unused []string
+	for _, file := range files {
+		if file == "" || file == DefaultAvatar {
+			continue
+		}
+		var used bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM users WHERE avatar_url = ?1)
+			    OR EXISTS (SELECT 1 FROM posts WHERE imgOrgif = ?1)
+			    OR EXISTS (SELECT 1 FROM comments WHERE imgOrgif = ?1)
+			    OR EXISTS (SELECT 1 FROM group_posts WHERE imgOrgif = ?1)
+			    OR EXISTS (SELECT 1 FROM group_post_comments WHERE imgOrgif = ?1)`, file).Scan(&used)
+		if err != nil {
+			return nil, err
+		}
+		if !used {
+			unused = append(unused, file)
+		}
+	}
+	return unused, tx.Commit()
+}
+
+// dissolveGroup deletes a group with its posts, chat, events, members,
+// invitations and notifications. It returns the images of its posts and
+// comments.
+func dissolveGroup(tx *sql.Tx, groupID int) ([]string, error) {
+	files, err := collectStrings(tx, `
+		SELECT imgOrgif FROM group_posts WHERE group_id = ?1
+		UNION SELECT imgOrgif FROM group_post_comments
+			WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{
+		`DELETE FROM group_post_likes WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`,
+		`DELETE FROM group_post_dislikes WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`,
+		`DELETE FROM group_post_comments WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`,
+		`DELETE FROM group_post_categories WHERE group_post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)`,
+		`DELETE FROM group_posts WHERE group_id = ?1`,
+		`DELETE FROM group_messages WHERE group_id = ?1`,
+		`DELETE FROM event_rsvps WHERE event_id IN (SELECT id FROM events WHERE group_id = ?1)`,
+		`DELETE FROM events WHERE group_id = ?1`,
+		`DELETE FROM group_invitations WHERE group_id = ?1`,
+		`DELETE FROM group_members WHERE group_id = ?1`,
+		`DELETE FROM notifications WHERE group_id = ?1`,
+		`DELETE FROM groups WHERE id = ?1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, groupID); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func collectInts(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// collectStrings returns the non-empty, non-NULL values of a one column query.
+func collectStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		if v.Valid && v.String != "" {
+			values = append(values, v.String)
+		}
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiTokenSessionPrefix starts the session key of connections opened with an
+// access token (see APITokenSessionKey).
+const apiTokenSessionPrefix = "api-token:"
+
+// APITokenSessionKey is what WebSocket connections opened with an access
+// token are registered under in place of a session token.
+func APITokenSessionKey(tokenID int) string {
+	return apiTokenSessionPrefix + strconv.Itoa(tokenID)
+}
+
+// isAPITokenActive reports whether the token of a session key made by
+// APITokenSessionKey still exists and is unexpired.
+func isAPITokenActive(db *sql.DB, sessionKey string) (bool, error) {
+	tokenID, err := strconv.Atoi(strings.TrimPrefix(sessionKey, apiTokenSessionPrefix))
+	if err != nil {
+		return false, nil
+	}
+	var expiresAt time.Time
+	err = db.QueryRow(`SELECT expires_at FROM api_tokens WHERE id = ?`, tokenID).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(expiresAt), nil
+}
+
+// APIToken is a personal access token. The token itself is only shown once,
+// when it is created.
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIToken stores a token with the given hash and returns its id.
+func CreateAPIToken(db *sql.DB, t *APIToken, tokenHash string) (int, error) {
+	res, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Name, tokenHash, t.Prefix, strings.Join(t.Scopes, " "), t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const apiTokenColumns = `id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at`
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &t.ExpiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return &t, nil
+}
+
+// GetAPITokenByHash returns the token with the given hash, or sql.ErrNoRows.
+// Expiry is left to the caller.
+func GetAPITokenByHash(db *sql.DB, tokenHash string) (*APIToken, error) {
+	return scanAPIToken(db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = ?`, tokenHash))
+}
+
+// GetAPITokens returns the tokens of userID, newest first, expired ones
+// included.
+func GetAPITokens(db *sql.DB, userID int) ([]APIToken, error) {
+	rows, err := db.Query(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchAPIToken records that a token was just used.
+func TouchAPIToken(db *sql.DB, tokenID int, usedAt time.Time) error {
+	_, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, usedAt, tokenID)
+	return err
+}
+
+// DeleteAPIToken revokes a token of userID and reports whether it existed.
+func DeleteAPIToken(db *sql.DB, userID, tokenID int) (bool, error) {
+	res, err := db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// GetCalendarToken returns the calendar feed token of a user, or "" if none
+// has been issued.
+func GetCalendarToken(db *sql.DB, userID int) (string, error) {
+	var token string
+	err := db.QueryRow(`SELECT token FROM calendar_tokens WHERE user_id = ?`, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return token, err
+}
+
+// CreateCalendarToken issues a new calendar feed token for a user. Any previous
+// token stops working.
+func CreateCalendarToken(db *sql.DB, userID int) (string, error) {
+	token := uuid.New().String()
+	_, err := db.Exec(`
+		INSERT INTO calendar_tokens (user_id, token, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET token = excluded.token, created_at = excluded.created_at`,
+		userID, token)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DeleteCalendarToken revokes the calendar feed token of a user.
+func DeleteCalendarToken(db *sql.DB, userID int) error {
+	_, err := db.Exec(`DELETE FROM calendar_tokens WHERE user_id = ?`, userID)
+	return err
+}
+
+// GetUserIDByCalendarToken returns the owner of a calendar feed token, or
+// sql.ErrNoRows if the token is unknown.
+func GetUserIDByCalendarToken(db *sql.DB, token string) (int, error) {
+	var userID int
+	err := db.QueryRow(`SELECT user_id FROM calendar_tokens WHERE token = ?`, token).Scan(&userID)
+	return userID, err
+}
+
+// GetUserContact returns the username and email of a user.
+func GetUserContact(db *sql.DB, userID int) (string, string, error) {
+	var username, email string
+	err := db.QueryRow(`SELECT username, email FROM users WHERE id = ?`, userID).Scan(&username, &email)
+	return username, email, err
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrExportPending is returned when a user asks for a data export while the
+// previous one is still being built.
+var ErrExportPending = errors.New("a data export is already being prepared")
+
+// DataExport is a personal data archive requested by a user.
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateDataExport starts a pending export for userID and returns its id.
+func CreateDataExport(db *sql.DB, userID int, createdAt time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM data_exports WHERE user_id = ? AND status = 'pending')`, userID).Scan(&pending); err != nil {
+		return 0, err
+	}
+	if pending {
+		return 0, ErrExportPending
+	}
+
+	res, err := tx.Exec(`INSERT INTO data_exports (user_id, status, created_at) VALUES (?, 'pending', ?)`, userID, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// FinishDataExport marks an export as ready to download until expiresAt.
+func FinishDataExport(db *sql.DB, exportID int, filePath string, completedAt, expiresAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE data_exports SET status = 'ready', file_path = ?, completed_at = ?, expires_at = ?
+		WHERE id = ?`, filePath, completedAt, expiresAt, exportID)
+	return err
+}
+
+// FailDataExport marks an export as failed.
+func FailDataExport(db *sql.DB, exportID int, completedAt time.Time) error {
+	_, err := db.Exec(`UPDATE data_exports SET status = 'failed', completed_at = ? WHERE id = ?`, completedAt, exportID)
+	return err
+}
+
+const dataExportColumns = `id, user_id, status, file_path, created_at, completed_at, expires_at`
+
+func scanDataExport(row interface{ Scan(...interface{}) error }) (*DataExport, error) {
+	var e DataExport
+	var completedAt, expiresAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.CreatedAt, &completedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, nil
+}
+
+// GetDataExport returns an export by id.
+func GetDataExport(db *sql.DB, exportID int) (*DataExport, error) {
+	return scanDataExport(db.QueryRow(`SELECT `+dataExportColumns+` FROM data_exports WHERE id = ?`, exportID))
+}
+
+// GetLatestDataExport returns the most recent export of userID, or
+// sql.ErrNoRows if there is none.
+func GetLatestDataExport(db *sql.DB, userID int) (*DataExport, error) {
+	return scanDataExport(db.QueryRow(`
+		SELECT `+dataExportColumns+` FROM data_exports
+		WHERE user_id = ? ORDER BY id DESC LIMIT 1`, userID))
+}
+
+// GetDataExports returns every export of userID, newest first.
+func GetDataExports(db *sql.DB, userID int) ([]DataExport, error) {
+	return queryDataExports(db, `SELECT `+dataExportColumns+` FROM data_exports WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+// GetAllDataExports returns every export, for cleanup.
+func GetAllDataExports(db *sql.DB) ([]DataExport, error) {
+	return queryDataExports(db, `SELECT `+dataExportColumns+` FROM data_exports`)
+}
+
+func queryDataExports(db *sql.DB, query string, args ...interface{}) ([]DataExport, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []DataExport
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// DeleteDataExport removes an export record.
+func DeleteDataExport(db *sql.DB, exportID int) error {
+	_, err := db.Exec(`DELETE FROM data_exports WHERE id = ?`, exportID)
+	return err
+}
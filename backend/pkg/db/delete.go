@@ -7,22 +7,34 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-func DeleteUser(db *sql.DB, username string) error {
-	query := `DELETE FROM users WHERE username = ?`
-	_, err := db.Exec(query, username)
-	return err
-}
-
 func DeleteCategory(db *sql.DB, name string) error {
 	query := `DELETE FROM categories WHERE name = ?`
 	_, err := db.Exec(query, name)
 	return err
 }
 
+// DeletePost removes a post together with its comments, likes, categories
+// and audience.
 func DeletePost(db *sql.DB, postID int) error {
-	query := `DELETE FROM posts WHERE id = ?`
-	_, err := db.Exec(query, postID)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM likes WHERE post_id = ?1 OR comment_id IN (SELECT id FROM comments WHERE post_id = ?1)`,
+		`DELETE FROM comments WHERE post_id = ?`,
+		`DELETE FROM post_categories WHERE post_id = ?`,
+		`DELETE FROM post_permissions WHERE post_id = ?`,
+		`DELETE FROM posts WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, postID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func DeletePostCategory(db *sql.DB, postID, categoryID int) error {
@@ -52,3 +64,12 @@ func DeleteSession(db *sql.DB, sessionID int) error {
 	}
 	return err
 }
+
+func DeleteSessionByToken(db *sql.DB, token string) error {
+	query := `DELETE FROM sessions WHERE token = ?`
+	_, err := db.Exec(query, token)
+	if err != nil {
+		fmt.Println(" Error deleting session:", err)
+	}
+	return err
+}
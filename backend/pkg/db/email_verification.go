@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IsEmailVerified reports whether userID has confirmed their email address.
+func IsEmailVerified(db *sql.DB, userID int) (bool, error) {
+	var verifiedAt sql.NullTime
+	err := db.QueryRow(`SELECT verified_at FROM users WHERE id = ?`, userID).Scan(&verifiedAt)
+	return verifiedAt.Valid, err
+}
+
+// GetEmailVerificationSentAt returns when the last verification link of
+// userID was sent, or sql.ErrNoRows if none is pending.
+func GetEmailVerificationSentAt(db *sql.DB, userID int) (time.Time, error) {
+	var sentAt time.Time
+	err := db.QueryRow(`SELECT sent_at FROM email_verifications WHERE user_id = ?`, userID).Scan(&sentAt)
+	return sentAt, err
+}
+
+// SetEmailVerification stores a new verification token hash for userID,
+// replacing the previous link.
+func SetEmailVerification(db *sql.DB, userID int, tokenHash string, expiresAt, sentAt time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO email_verifications (user_id, token_hash, expires_at, sent_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET token_hash = excluded.token_hash, expires_at = excluded.expires_at, sent_at = excluded.sent_at`,
+		userID, tokenHash, expiresAt, sentAt)
+	return err
+}
+
+// MarkEmailUnverified clears verified_at, for when the address changes.
+func MarkEmailUnverified(db *sql.DB, userID int) error {
+	_, err := db.Exec(`UPDATE users SET verified_at = NULL WHERE id = ?`, userID)
+	return err
+}
+
+// VerifyEmail spends the verification token with the given hash and marks
+// its user verified. It returns the user, or sql.ErrNoRows if the token is
+// unknown or expired.
+func VerifyEmail(db *sql.DB, tokenHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT user_id, expires_at FROM email_verifications WHERE token_hash = ?`, tokenHash).Scan(&userID, &expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if now.After(expiresAt) {
+		return 0, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET verified_at = ? WHERE id = ? AND verified_at IS NULL`, now, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM email_verifications WHERE user_id = ?`, userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,368 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RSVP statuses. RSVPWaitlisted is only ever set by the server, when a
+// member asks to go to an event that is full.
+const (
+	RSVPGoing      = "going"
+	RSVPMaybe      = "maybe"
+	RSVPNotGoing   = "not_going"
+	RSVPWaitlisted = "waitlisted"
+)
+
+// ErrEventCancelled is returned when responding to or editing a cancelled event.
+var ErrEventCancelled = errors.New("event has been cancelled")
+
+// eventTimeLayout matches CURRENT_TIMESTAMP so event times sort as text.
+const eventTimeLayout = "2006-01-02 15:04:05"
+
+// Event is a group event with its RSVP counts. UserRSVP and WaitlistPosition
+// describe the viewer's own response.
+type Event struct {
+	ID               int        `json:"id"`
+	GroupID          int        `json:"group_id"`
+	GroupTitle       string     `json:"group_title"`
+	CreatorID        int        `json:"creator_id"`
+	CreatorUsername  string     `json:"creator_username"`
+	Title            string     `json:"title"`
+	Description      string     `json:"description"`
+	StartsAt         time.Time  `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	Timezone         string     `json:"timezone"`
+	Location         string     `json:"location"`
+	Capacity         *int       `json:"capacity"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	Cancelled        bool       `json:"cancelled"`
+	GoingCount       int        `json:"going_count"`
+	MaybeCount       int        `json:"maybe_count"`
+	NotGoingCount    int        `json:"not_going_count"`
+	WaitlistCount    int        `json:"waitlist_count"`
+	SpotsLeft        *int       `json:"spots_left"`
+	UserRSVP         string     `json:"user_rsvp,omitempty"`
+	WaitlistPosition int        `json:"waitlist_position,omitempty"`
+}
+
+// EventInput holds the editable fields of an event. Times must be in UTC.
+type EventInput struct {
+	Title       string
+	Description string
+	StartsAt    time.Time
+	EndsAt      *time.Time
+	Timezone    string
+	Location    string
+	Capacity    *int
+}
+
+// EventAttendee is one member's response to an event.
+type EventAttendee struct {
+	UserID           int       `json:"user_id"`
+	Username         string    `json:"username"`
+	Firstname        string    `json:"firstname"`
+	Lastname         string    `json:"lastname"`
+	AvatarURL        string    `json:"avatar_url"`
+	Status           string    `json:"status"`
+	WaitlistPosition int       `json:"waitlist_position,omitempty"`
+	RespondedAt      time.Time `json:"responded_at"`
+}
+
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(eventTimeLayout)
+}
+
+func nullableInt(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// CreateEvent stores a new event and returns its id.
+func CreateEvent(db *sql.DB, groupID, creatorID int, in EventInput) (int, error) {
+	res, err := db.Exec(`
+		INSERT INTO events (group_id, creator_id, title, description, starts_at, ends_at, timezone, location, capacity, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		groupID, creatorID, in.Title, in.Description, in.StartsAt.UTC().Format(eventTimeLayout),
+		nullableTime(in.EndsAt), in.Timezone, in.Location, nullableInt(in.Capacity))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// UpdateEvent replaces the editable fields of an event. If the capacity grew,
+// members are moved off the waitlist; their ids are returned.
+func UpdateEvent(db *sql.DB, eventID int, in EventInput) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var cancelled sql.NullTime
+	if err := tx.QueryRow(`SELECT cancelled_at FROM events WHERE id = ?`, eventID).Scan(&cancelled); err != nil {
+		return nil, err
+	}
+	if cancelled.Valid {
+		return nil, ErrEventCancelled
+	}
+
+	_, err = tx.Exec(`
+		UPDATE events
+		SET title = ?, description = ?, starts_at = ?, ends_at = ?, timezone = ?, location = ?, capacity = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		in.Title, in.Description, in.StartsAt.UTC().Format(eventTimeLayout), nullableTime(in.EndsAt),
+		in.Timezone, in.Location, nullableInt(in.Capacity), eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	promoted, err := promoteWaitlist(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return promoted, tx.Commit()
+}
+
+// CancelEvent marks an event as cancelled. Existing RSVPs are kept.
+func CancelEvent(db *sql.DB, eventID int) error {
+	res, err := db.Exec(`UPDATE events SET cancelled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND cancelled_at IS NULL`, eventID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEventCancelled
+	}
+	return nil
+}
+
+const eventSelect = `
+	SELECT e.id, e.group_id, COALESCE(g.title, ''), e.creator_id, COALESCE(u.username, ''), e.title, e.description,
+	       e.starts_at, e.ends_at, e.timezone, e.location, e.capacity, e.created_at, e.updated_at, e.cancelled_at,
+	       (SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id AND r.status = 'going'),
+	       (SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id AND r.status = 'maybe'),
+	       (SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id AND r.status = 'not_going'),
+	       (SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id AND r.status = 'waitlisted'),
+	       COALESCE(mine.status, ''), COALESCE(mine.waitlist_position, 0)
+	FROM events e
+	LEFT JOIN groups g ON g.id = e.group_id
+	LEFT JOIN users u ON u.id = e.creator_id
+	LEFT JOIN event_rsvps mine ON mine.event_id = e.id AND mine.user_id = ?`
+
+func scanEvent(row interface{ Scan(...interface{}) error }) (*Event, error) {
+	var ev Event
+	var endsAt, updatedAt, cancelledAt sql.NullTime
+	var capacity sql.NullInt64
+	err := row.Scan(&ev.ID, &ev.GroupID, &ev.GroupTitle, &ev.CreatorID, &ev.CreatorUsername, &ev.Title, &ev.Description,
+		&ev.StartsAt, &endsAt, &ev.Timezone, &ev.Location, &capacity, &ev.CreatedAt, &updatedAt, &cancelledAt,
+		&ev.GoingCount, &ev.MaybeCount, &ev.NotGoingCount, &ev.WaitlistCount,
+		&ev.UserRSVP, &ev.WaitlistPosition)
+	if err != nil {
+		return nil, err
+	}
+	if endsAt.Valid {
+		ev.EndsAt = &endsAt.Time
+	}
+	if updatedAt.Valid {
+		ev.UpdatedAt = &updatedAt.Time
+	}
+	if cancelledAt.Valid {
+		ev.CancelledAt = &cancelledAt.Time
+		ev.Cancelled = true
+	}
+	if capacity.Valid {
+		c := int(capacity.Int64)
+		left := c - ev.GoingCount
+		if left < 0 {
+			left = 0
+		}
+		ev.Capacity = &c
+		ev.SpotsLeft = &left
+	}
+	return &ev, nil
+}
+
+// GetEvent returns one event as seen by viewerID.
+func GetEvent(db *sql.DB, eventID, viewerID int) (*Event, error) {
+	return scanEvent(db.QueryRow(eventSelect+` WHERE e.id = ?`, viewerID, eventID))
+}
+
+// GetGroupEvents returns the events of a group as seen by viewerID, latest start first.
+func GetGroupEvents(db *sql.DB, groupID, viewerID int) ([]Event, error) {
+	return queryEvents(db, eventSelect+` WHERE e.group_id = ? ORDER BY e.starts_at DESC, e.id DESC`, viewerID, groupID)
+}
+
+// GetUserEvents returns the events of every group userID is an accepted member of.
+func GetUserEvents(db *sql.DB, userID int) ([]Event, error) {
+	return queryEvents(db, eventSelect+`
+		JOIN group_members gm ON gm.group_id = e.group_id AND gm.user_id = ? AND gm.status = 'accepted'
+		ORDER BY e.starts_at DESC, e.id DESC`, userID, userID)
+}
+
+func queryEvents(db *sql.DB, query string, args ...interface{}) ([]Event, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		ev, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *ev)
+	}
+	return events, rows.Err()
+}
+
+// SetEventRSVP records userID's response to an event and returns the status
+// that was stored: asking for "going" on a full event puts the user on the
+// waitlist instead. When a going member backs out, the first waitlisted
+// members are moved in; their ids are returned as promoted.
+func SetEventRSVP(db *sql.DB, eventID, userID int, status string) (stored string, promoted []int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	var capacity sql.NullInt64
+	var cancelled sql.NullTime
+	if err := tx.QueryRow(`SELECT capacity, cancelled_at FROM events WHERE id = ?`, eventID).Scan(&capacity, &cancelled); err != nil {
+		return "", nil, err
+	}
+	if cancelled.Valid {
+		return "", nil, ErrEventCancelled
+	}
+
+	var current string
+	err = tx.QueryRow(`SELECT status FROM event_rsvps WHERE event_id = ? AND user_id = ?`, eventID, userID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+
+	stored = status
+	if status == RSVPGoing && current != RSVPGoing && capacity.Valid {
+		var going int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM event_rsvps WHERE event_id = ? AND status = 'going'`, eventID).Scan(&going); err != nil {
+			return "", nil, err
+		}
+		if going >= int(capacity.Int64) {
+			stored = RSVPWaitlisted
+		}
+	}
+
+	switch {
+	case stored == RSVPWaitlisted && current == RSVPWaitlisted:
+		// Keep the existing place in the queue
+	case stored == RSVPWaitlisted:
+		_, err = tx.Exec(`
+			INSERT INTO event_rsvps (event_id, user_id, status, waitlist_position, created_at, updated_at)
+			VALUES (?, ?, 'waitlisted',
+			        (SELECT COALESCE(MAX(waitlist_position), 0) + 1 FROM event_rsvps WHERE event_id = ?),
+			        CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT(event_id, user_id) DO UPDATE SET
+				status = excluded.status, waitlist_position = excluded.waitlist_position, updated_at = CURRENT_TIMESTAMP`,
+			eventID, userID, eventID)
+	default:
+		_, err = tx.Exec(`
+			INSERT INTO event_rsvps (event_id, user_id, status, created_at, updated_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			ON CONFLICT(event_id, user_id) DO UPDATE SET
+				status = excluded.status, waitlist_position = NULL, updated_at = CURRENT_TIMESTAMP`,
+			eventID, userID, stored)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if current == RSVPGoing && stored != RSVPGoing {
+		promoted, err = promoteWaitlist(tx, eventID)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return stored, promoted, tx.Commit()
+}
+
+// promoteWaitlist moves waitlisted members to going, in queue order, while
+// the event has free spots.
+func promoteWaitlist(tx *sql.Tx, eventID int) ([]int, error) {
+	var capacity sql.NullInt64
+	if err := tx.QueryRow(`SELECT capacity FROM events WHERE id = ?`, eventID).Scan(&capacity); err != nil {
+		return nil, err
+	}
+
+	var promoted []int
+	for {
+		if capacity.Valid {
+			var going int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM event_rsvps WHERE event_id = ? AND status = 'going'`, eventID).Scan(&going); err != nil {
+				return nil, err
+			}
+			if going >= int(capacity.Int64) {
+				return promoted, nil
+			}
+		}
+
+		var userID int
+		err := tx.QueryRow(`
+			SELECT user_id FROM event_rsvps
+			WHERE event_id = ? AND status = 'waitlisted'
+			ORDER BY waitlist_position, id
+			LIMIT 1`, eventID).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return promoted, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE event_rsvps SET status = 'going', waitlist_position = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE event_id = ? AND user_id = ?`, eventID, userID); err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, userID)
+	}
+}
+
+// GetEventAttendees lists every response to an event, going members first
+// and the waitlist in queue order.
+func GetEventAttendees(db *sql.DB, eventID int) ([]EventAttendee, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.firstname, u.lastname, COALESCE(u.avatar_url, ''),
+		       r.status, COALESCE(r.waitlist_position, 0), r.updated_at
+		FROM event_rsvps r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.event_id = ?
+		ORDER BY CASE r.status WHEN 'going' THEN 0 WHEN 'maybe' THEN 1 WHEN 'waitlisted' THEN 2 ELSE 3 END,
+		         r.waitlist_position, r.updated_at, r.id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []EventAttendee{}
+	for rows.Next() {
+		var a EventAttendee
+		if err := rows.Scan(&a.UserID, &a.Username, &a.Firstname, &a.Lastname, &a.AvatarURL,
+			&a.Status, &a.WaitlistPosition, &a.RespondedAt); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, a)
+	}
+	return attendees, rows.Err()
+}
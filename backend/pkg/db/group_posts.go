@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"socialnetwork/pkg/pagination"
 )
 
 func getOrCreateCategoryIDTx(tx *sql.Tx, name string) (int, error) {
@@ -21,7 +23,10 @@ func getOrCreateCategoryIDTx(tx *sql.Tx, name string) (int, error) {
 	return id, err
 }
 
-func GetGroupPosts(db *sql.DB, groupID, viewerID int) ([]map[string]interface{}, error) {
+// GetGroupPosts returns one page of a group's posts, newest first, and the cursor of the next page
+func GetGroupPosts(db *sql.DB, groupID, viewerID int, page pagination.Page) ([]map[string]interface{}, string, error) {
+	keyset, keysetArgs := page.Where("gp.created_at", "gp.id")
+	args := append([]interface{}{viewerID, viewerID, groupID, viewerID}, keysetArgs...)
 	rows, err := db.Query(`
 				 SELECT gp.id, gp.group_id, gp.user_id, gp.title, gp.content, gp.created_at,
 								gp.imgOrgif,
@@ -45,14 +50,17 @@ func GetGroupPosts(db *sql.DB, groupID, viewerID int) ([]map[string]interface{},
 									 AND m.user_id  = ?
 									 AND m.status   = 'accepted'
 					 )
-				 ORDER BY gp.created_at DESC
-			`, viewerID, viewerID, groupID, viewerID)
+					 AND `+keyset+`
+				 ORDER BY `+page.OrderBy("gp.created_at", "gp.id")+`
+				 LIMIT ?
+			`, append(args, page.FetchLimit())...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var out []map[string]interface{}
+	out := []map[string]interface{}{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var (
 			id, gid, uid                                             int
@@ -69,7 +77,7 @@ func GetGroupPosts(db *sql.DB, groupID, viewerID int) ([]map[string]interface{},
 			&username, &firstname, &lastname, &avatarURL,
 			&likeCount, &dislikeCount, &commentCount, &isLikedInt, &isDislikedInt,
 		); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		// categories
@@ -79,7 +87,7 @@ func GetGroupPosts(db *sql.DB, groupID, viewerID int) ([]map[string]interface{},
             JOIN categories c ON c.id = gpc.category_id
             WHERE gpc.group_post_id = ?`, id)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		var cats []string
 		for crows.Next() {
@@ -109,24 +117,31 @@ func GetGroupPosts(db *sql.DB, groupID, viewerID int) ([]map[string]interface{},
 			"is_liked":      isLikedInt == 1,
 			"is_disliked":   isDislikedInt == 1,
 		})
+		cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: id})
 	}
-	return out, rows.Err()
+	out, next := pagination.Result(page, out, cursors)
+	return out, next, rows.Err()
 }
 
-func GetGroupPostComments(db *sql.DB, groupPostID int) ([]map[string]interface{}, error) {
+// GetGroupPostComments returns one page of a group post's comments, oldest first, and the cursor of the next page
+func GetGroupPostComments(db *sql.DB, groupPostID int, page pagination.Page) ([]map[string]interface{}, string, error) {
+	keyset, keysetArgs := page.Where("c.created_at", "c.id")
+	args := append([]interface{}{groupPostID}, keysetArgs...)
 	rows, err := db.Query(`
 			SELECT c.id, c.group_post_id, c.user_id, c.content, c.created_at, c.imgOrgif, u.username, u.firstname, u.lastname, u.avatar_url
 			FROM group_post_comments c
 			JOIN users u ON u.id = c.user_id
-			WHERE c.group_post_id = ?
-			ORDER BY c.created_at ASC
-		`, groupPostID)
+			WHERE c.group_post_id = ? AND `+keyset+`
+			ORDER BY `+page.OrderBy("c.created_at", "c.id")+`
+			LIMIT ?
+		`, append(args, page.FetchLimit())...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var out []map[string]interface{}
+	out := []map[string]interface{}{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var (
 			id, gid, uid                                      int
@@ -135,7 +150,7 @@ func GetGroupPostComments(db *sql.DB, groupPostID int) ([]map[string]interface{}
 			imgOrgif                                          sql.NullString
 		)
 		if err := rows.Scan(&id, &gid, &uid, &content, &createdAt, &imgOrgif, &username, &firstname, &lastname, &avatarURL); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		out = append(out, map[string]interface{}{
 			"id":            id,
@@ -151,8 +166,10 @@ func GetGroupPostComments(db *sql.DB, groupPostID int) ([]map[string]interface{}
 			"lastname":      lastname,
 			"avatar_url":    avatarURL,
 		})
+		cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: id})
 	}
-	return out, rows.Err()
+	out, next := pagination.Result(page, out, cursors)
+	return out, next, rows.Err()
 }
 
 func InsertGroupPostComment(db *sql.DB, groupPostID, userID int, content, imgOrgif string) (int64, time.Time, error) {
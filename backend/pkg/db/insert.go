@@ -94,9 +94,10 @@ func InsertLike(db *sql.DB, userID, postID, commentID int, isLike bool) error {
 	return err
 }
 
-func InsertSession(db *sql.DB, userID int, token string, expiresAt time.Time) error {
-	query := `INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, ?)`
-	_, err := db.Exec(query, userID, token, expiresAt)
+func InsertSession(db *sql.DB, userID int, token string, expiresAt time.Time, userAgent, ipAddress string) error {
+	query := `INSERT INTO sessions (user_id, token, expires_at, user_agent, ip_address, created_at, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	now := time.Now()
+	_, err := db.Exec(query, userID, token, expiresAt, userAgent, ipAddress, now, now)
 	if err != nil {
 		fmt.Println(" SQL Error inserting session:", err)
 	}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginLockout is a temporary lockout caused by failed logins against an account.
+type LoginLockout struct {
+	ID          int       `json:"id"`
+	Scope       string    `json:"scope"`
+	IPAddress   string    `json:"ip_address"`
+	LockedUntil time.Time `json:"locked_until"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// InsertLoginLockout records a lockout of userID's logins.
+func InsertLoginLockout(db *sql.DB, userID int, scope, ipAddress string, createdAt, lockedUntil time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO login_lockouts (user_id, scope, ip_address, locked_until, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, scope, ipAddress, lockedUntil, createdAt)
+	return err
+}
+
+// GetLoginLockouts returns the latest lockouts of userID, newest first.
+func GetLoginLockouts(db *sql.DB, userID, limit int) ([]LoginLockout, error) {
+	rows, err := db.Query(`
+		SELECT id, scope, ip_address, locked_until, created_at
+		FROM login_lockouts
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []LoginLockout{}
+	for rows.Next() {
+		var l LoginLockout
+		if err := rows.Scan(&l.ID, &l.Scope, &l.IPAddress, &l.LockedUntil, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MarkConversationRead marks every unread message sent by otherID to readerID as read
+// and returns how many messages were updated.
+func MarkConversationRead(db *sql.DB, readerID, otherID int, readAt time.Time) (int64, error) {
+	query := `UPDATE messages SET read_at = ? WHERE sender_id = ? AND receiver_id = ? AND read_at IS NULL`
+	res, err := db.Exec(query, readAt, otherID, readerID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountUnreadMessages returns the number of unread private messages received by userID.
+func CountUnreadMessages(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM messages WHERE receiver_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// GetConversations returns one entry per user that userID has exchanged private
+// messages with, with the last message as a preview and the number of unread
+// messages received from that user. Most recent conversations come first.
+//
+// Conversations are paginated by the id of their last message: pass the
+// "last_message_id" of the final entry of a page as beforeID to get the next
+// page, or 0 for the first page. Each entry is flagged with "can_message"
+// according to CheckFollowRelationship.
+func GetConversations(db *sql.DB, userID, beforeID, limit int) ([]map[string]interface{}, error) {
+	query := `
+		WITH convo AS (
+			SELECT id, sender_id, receiver_id, content, created_at,
+			       CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END AS other_id
+			FROM messages
+			WHERE sender_id = ? OR receiver_id = ?
+		),
+		last AS (
+			SELECT other_id, MAX(id) AS last_id FROM convo GROUP BY other_id
+		)
+		SELECT c.other_id, u.username, COALESCE(u.avatar_url, ''),
+		       c.id, c.sender_id, s.username, c.content, c.created_at,
+		       (SELECT COUNT(*) FROM messages m
+		        WHERE m.sender_id = c.other_id AND m.receiver_id = ? AND m.read_at IS NULL) AS unread_count
+		FROM last l
+		JOIN convo c ON c.id = l.last_id
+		JOIN users u ON u.id = c.other_id
+		JOIN users s ON s.id = c.sender_id
+		WHERE (? = 0 OR c.id < ?)
+		ORDER BY c.id DESC
+		LIMIT ?`
+
+	rows, err := db.Query(query, userID, userID, userID, userID, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []map[string]interface{}{}
+	for rows.Next() {
+		var otherID, messageID, senderID, unread int
+		var username, avatar, senderUsername, content string
+		var createdAt time.Time
+
+		if err := rows.Scan(&otherID, &username, &avatar, &messageID, &senderID, &senderUsername, &content, &createdAt, &unread); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		conversations = append(conversations, map[string]interface{}{
+			"user_id":              otherID,
+			"username":             username,
+			"avatar_url":           avatar,
+			"last_message_id":      messageID,
+			"last_message":         content,
+			"last_sender_id":       senderID,
+			"last_sender_username": senderUsername,
+			"last_message_at":      createdAt.Format(time.RFC3339),
+			"unread_count":         unread,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	// Flag conversations that can no longer be continued
+	for _, c := range conversations {
+		canMessage, err := CheckFollowRelationship(db, userID, c["user_id"].(int))
+		if err != nil {
+			return nil, err
+		}
+		c["can_message"] = canMessage
+	}
+
+	return conversations, nil
+}
+
+// ChatMessageInfo is the stored state of a private or group chat message,
+// used to authorize edits and deletions.
+type ChatMessageInfo struct {
+	ID         int
+	SenderID   int
+	ReceiverID int // private messages only
+	GroupID    int // group messages only
+	CreatedAt  time.Time
+	Deleted    bool
+}
+
+// GetMessageInfo returns the stored state of a private message.
+func GetMessageInfo(db *sql.DB, messageID int) (*ChatMessageInfo, error) {
+	info := &ChatMessageInfo{ID: messageID}
+	var deletedAt sql.NullTime
+	query := `SELECT sender_id, receiver_id, created_at, deleted_at FROM messages WHERE id = ?`
+	err := db.QueryRow(query, messageID).Scan(&info.SenderID, &info.ReceiverID, &info.CreatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	info.Deleted = deletedAt.Valid
+	return info, nil
+}
+
+// GetGroupMessageInfo returns the stored state of a group chat message.
+func GetGroupMessageInfo(db *sql.DB, messageID int) (*ChatMessageInfo, error) {
+	info := &ChatMessageInfo{ID: messageID}
+	var deletedAt sql.NullTime
+	query := `SELECT sender_id, group_id, created_at, deleted_at FROM group_messages WHERE id = ?`
+	err := db.QueryRow(query, messageID).Scan(&info.SenderID, &info.GroupID, &info.CreatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	info.Deleted = deletedAt.Valid
+	return info, nil
+}
+
+// EditMessage replaces the content of a private message that has not been deleted.
+func EditMessage(db *sql.DB, messageID int, content string, editedAt time.Time) error {
+	query := `UPDATE messages SET content = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL`
+	_, err := db.Exec(query, content, editedAt, messageID)
+	return err
+}
+
+// DeleteMessage soft deletes a private message: the row stays as a tombstone
+// with its content cleared.
+func DeleteMessage(db *sql.DB, messageID int, deletedAt time.Time) error {
+	query := `UPDATE messages SET content = '', deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+	_, err := db.Exec(query, deletedAt, messageID)
+	return err
+}
+
+// EditGroupMessage replaces the content of a group message that has not been deleted.
+func EditGroupMessage(db *sql.DB, messageID int, content string, editedAt time.Time) error {
+	query := `UPDATE group_messages SET content = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL`
+	_, err := db.Exec(query, content, editedAt, messageID)
+	return err
+}
+
+// DeleteGroupMessage soft deletes a group message: the row stays as a tombstone
+// with its content cleared.
+func DeleteGroupMessage(db *sql.DB, messageID int, deletedAt time.Time) error {
+	query := `UPDATE group_messages SET content = '', deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+	_, err := db.Exec(query, deletedAt, messageID)
+	return err
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_sessions_user_id;
+ALTER TABLE sessions DROP COLUMN last_seen;
+ALTER TABLE sessions DROP COLUMN created_at;
+ALTER TABLE sessions DROP COLUMN ip_address;
+ALTER TABLE sessions DROP COLUMN user_agent;
@@ -0,0 +1,6 @@
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+ALTER TABLE sessions ADD COLUMN last_seen DATETIME;
+UPDATE sessions SET created_at = CURRENT_TIMESTAMP, last_seen = CURRENT_TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_receiver_unread;
+ALTER TABLE messages DROP COLUMN read_at;
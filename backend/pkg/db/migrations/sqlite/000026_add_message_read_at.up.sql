@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN read_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_messages_receiver_unread ON messages(receiver_id, sender_id, read_at);
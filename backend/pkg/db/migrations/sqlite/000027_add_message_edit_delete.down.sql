@@ -0,0 +1,4 @@
+ALTER TABLE group_messages DROP COLUMN deleted_at;
+ALTER TABLE group_messages DROP COLUMN edited_at;
+ALTER TABLE messages DROP COLUMN deleted_at;
+ALTER TABLE messages DROP COLUMN edited_at;
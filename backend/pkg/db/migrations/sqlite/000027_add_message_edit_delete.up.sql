@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN edited_at DATETIME;
+ALTER TABLE messages ADD COLUMN deleted_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN edited_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN deleted_at DATETIME;
@@ -0,0 +1,17 @@
+-- These tables used to be created at startup; IF NOT EXISTS keeps existing databases intact.
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    creator_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    event_date DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS event_votes (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    choice TEXT NOT NULL CHECK (choice IN ('yes', 'no')),
+    UNIQUE(event_id, user_id)
+);
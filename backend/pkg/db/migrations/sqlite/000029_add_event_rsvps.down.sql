@@ -0,0 +1,26 @@
+ALTER TABLE events ADD COLUMN event_date DATETIME;
+UPDATE events SET event_date = starts_at;
+
+CREATE TABLE IF NOT EXISTS event_votes (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    choice TEXT NOT NULL CHECK (choice IN ('yes', 'no')),
+    UNIQUE(event_id, user_id)
+);
+
+INSERT OR IGNORE INTO event_votes (event_id, user_id, choice)
+SELECT event_id, user_id, CASE status WHEN 'going' THEN 'yes' ELSE 'no' END
+FROM event_rsvps
+WHERE status IN ('going', 'not_going');
+
+DROP INDEX IF EXISTS idx_events_group_starts;
+DROP INDEX IF EXISTS idx_event_rsvps_event_status;
+DROP TABLE IF EXISTS event_rsvps;
+
+ALTER TABLE events DROP COLUMN cancelled_at;
+ALTER TABLE events DROP COLUMN updated_at;
+ALTER TABLE events DROP COLUMN capacity;
+ALTER TABLE events DROP COLUMN location;
+ALTER TABLE events DROP COLUMN timezone;
+ALTER TABLE events DROP COLUMN ends_at;
+ALTER TABLE events DROP COLUMN starts_at;
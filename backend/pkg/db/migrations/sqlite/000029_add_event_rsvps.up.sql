@@ -0,0 +1,33 @@
+-- Times are stored in UTC; timezone is the IANA zone the event was planned in.
+ALTER TABLE events ADD COLUMN starts_at DATETIME;
+ALTER TABLE events ADD COLUMN ends_at DATETIME;
+ALTER TABLE events ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE events ADD COLUMN location TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN capacity INTEGER; -- NULL means unlimited
+ALTER TABLE events ADD COLUMN updated_at DATETIME;
+ALTER TABLE events ADD COLUMN cancelled_at DATETIME;
+
+UPDATE events SET starts_at = COALESCE(strftime('%Y-%m-%d %H:%M:%S', event_date), created_at);
+
+CREATE TABLE IF NOT EXISTS event_rsvps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('going', 'maybe', 'not_going', 'waitlisted')),
+    waitlist_position INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE(event_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_rsvps_event_status ON event_rsvps(event_id, status);
+CREATE INDEX IF NOT EXISTS idx_events_group_starts ON events(group_id, starts_at);
+
+INSERT OR IGNORE INTO event_rsvps (event_id, user_id, status)
+SELECT event_id, user_id, CASE choice WHEN 'yes' THEN 'going' ELSE 'not_going' END
+FROM event_votes;
+
+DROP TABLE event_votes;
+ALTER TABLE events DROP COLUMN event_date;
@@ -0,0 +1,7 @@
+-- One secret per user for the subscribable calendar feed; resetting it replaces the row.
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+    user_id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
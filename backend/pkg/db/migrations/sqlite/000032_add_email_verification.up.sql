@@ -0,0 +1,13 @@
+-- Accounts created before verification existed count as verified.
+ALTER TABLE users ADD COLUMN verified_at DATETIME;
+UPDATE users SET verified_at = CURRENT_TIMESTAMP;
+
+-- The pending verification link of a user. Only the SHA-256 of the token is
+-- stored; sent_at throttles resends.
+CREATE TABLE IF NOT EXISTS email_verifications (
+    user_id INTEGER PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    sent_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS login_challenges;
+DROP INDEX IF EXISTS idx_totp_recovery_codes_user;
+DROP TABLE IF EXISTS totp_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
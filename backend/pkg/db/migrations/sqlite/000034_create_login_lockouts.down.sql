@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_login_lockouts_user;
+DROP TABLE IF EXISTS login_lockouts;
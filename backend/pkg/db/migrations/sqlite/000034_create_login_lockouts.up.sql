@@ -0,0 +1,14 @@
+-- Temporary lockouts caused by repeated failed logins against an account, so
+-- its owner can see them. scope is "account" when the account itself was
+-- locked, "ip" when the address the attempts came from was.
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    scope TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    locked_until DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_lockouts_user ON login_lockouts(user_id, created_at);
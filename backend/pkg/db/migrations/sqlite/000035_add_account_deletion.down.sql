@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_purge_after;
+ALTER TABLE users DROP COLUMN purge_after;
+ALTER TABLE users DROP COLUMN deletion_requested_at;
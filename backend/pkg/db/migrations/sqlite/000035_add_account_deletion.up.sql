@@ -0,0 +1,7 @@
+-- Accounts their owner asked to delete. Until purge_after the account is
+-- deactivated and hidden, and logging in again cancels the deletion; after
+-- it the account and its data are purged.
+ALTER TABLE users ADD COLUMN deletion_requested_at DATETIME;
+ALTER TABLE users ADD COLUMN purge_after DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after);
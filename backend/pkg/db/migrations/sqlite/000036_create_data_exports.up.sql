@@ -0,0 +1,15 @@
+-- Personal data archives requested by users. status is 'pending' while the
+-- archive is being built, then 'ready' (file_path set, downloadable until
+-- expires_at) or 'failed'.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    file_path TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    completed_at DATETIME,
+    expires_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id);
@@ -0,0 +1,18 @@
+-- Personal access tokens for scripts and integrations, sent as
+-- "Authorization: Bearer <token>". Only the SHA-256 of the token is kept;
+-- prefix is its first characters so users can tell tokens apart. scopes is a
+-- space separated list (posts:read posts:write chat groups).
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    prefix TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
@@ -0,0 +1,5 @@
+UPDATE notifications
+SET post_id = event_id
+WHERE event_id IS NOT NULL;
+
+ALTER TABLE notifications DROP COLUMN event_id;
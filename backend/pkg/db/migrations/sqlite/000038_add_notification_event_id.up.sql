@@ -0,0 +1,6 @@
+-- Group event notifications kept the event id in post_id; it gets its own column.
+ALTER TABLE notifications ADD COLUMN event_id INTEGER;
+
+UPDATE notifications
+SET event_id = post_id, post_id = NULL
+WHERE type IN ('new_groupEvent', 'group_event_cancelled', 'event_waitlist_promoted');
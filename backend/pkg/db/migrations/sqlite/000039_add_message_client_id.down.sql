@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_group_messages_sender_client_id;
+DROP INDEX IF EXISTS idx_messages_sender_client_id;
+ALTER TABLE group_messages DROP COLUMN client_id;
+ALTER TABLE messages DROP COLUMN client_id;
@@ -0,0 +1,6 @@
+-- Chat sends carry an id chosen by the client, so a send retried after a
+-- dropped connection is stored once.
+ALTER TABLE messages ADD COLUMN client_id TEXT;
+ALTER TABLE group_messages ADD COLUMN client_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_id ON messages(sender_id, client_id) WHERE client_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_messages_sender_client_id ON group_messages(sender_id, client_id) WHERE client_id IS NOT NULL;
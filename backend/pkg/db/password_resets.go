@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetUserIDByEmail returns the id of the user with the given (lower case) email.
+func GetUserIDByEmail(db *sql.DB, email string) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&id)
+	return id, err
+}
+
+// CreatePasswordReset stores a reset token hash for userID. Earlier unused
+// tokens of the user are dropped, so only the latest email works.
+func CreatePasswordReset(db *sql.DB, userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword spends the reset token with the given hash, sets the user's
+// password hash and deletes all of their sessions, in one transaction. It
+// returns the user and the deleted session tokens, or sql.ErrNoRows if the
+// token is unknown, already used or expired.
+func ResetPassword(db *sql.DB, tokenHash, passwordHash string) (int, []string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = tx.QueryRow(`SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = ?`, tokenHash).
+		Scan(&id, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		return 0, nil, err
+	}
+	now := time.Now()
+	if usedAt.Valid || now.After(expiresAt) {
+		return 0, nil, sql.ErrNoRows
+	}
+
+	res, err := tx.Exec(`UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL`, now, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return 0, nil, sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return 0, nil, err
+	}
+	// Any other outstanding link for the account is void once the password changed.
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return 0, nil, err
+	}
+
+	tokens, err := deleteSessions(tx, userID, "")
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return userID, tokens, nil
+}
@@ -3,8 +3,12 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"socialnetwork/pkg/pagination"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -104,6 +108,23 @@ func GetActiveSessionbyUserID(db *sql.DB, userID int) (int, error) {
 	return id, nil // Active session exists
 }
 
+// IsSessionActive reports whether a session with the given token exists and has not expired.
+func IsSessionActive(db *sql.DB, token string) (bool, error) {
+	if strings.HasPrefix(token, apiTokenSessionPrefix) {
+		return isAPITokenActive(db, token)
+	}
+	query := `SELECT expires_at FROM sessions WHERE token = ?`
+	var expiresAt time.Time
+	err := db.QueryRow(query, token).Scan(&expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return time.Now().Before(expiresAt), nil
+}
+
 func GetCategoriesByPostID(db *sql.DB, postID int) ([]string, error) {
 	query := `SELECT categories.name FROM categories 
               JOIN post_categories ON categories.id = post_categories.category_id 
@@ -177,22 +198,27 @@ func GetPostByPostID(db *sql.DB, postID int) ([]map[string]interface{}, error) {
 	return posts, nil
 }
 
-func GetPostsByUserID(db *sql.DB, userID int) ([]map[string]interface{}, error) {
+// GetPostsByUserID returns one page of the user's posts and the cursor of the next page
+func GetPostsByUserID(db *sql.DB, userID int, page pagination.Page) ([]map[string]interface{}, string, error) {
+	keyset, keysetArgs := page.Where("p.created_at", "p.id")
 	query := `
 	SELECT p.id, u.username, u.firstname, u.lastname, u.avatar_url, p.title, p.content, p.imgOrgif, p.created_at 
 	FROM posts p
 	JOIN users u ON p.user_id = u.id 
-	WHERE u.id = ? 
-	ORDER BY p.created_at DESC`
+	WHERE u.id = ? AND ` + keyset + `
+	ORDER BY ` + page.OrderBy("p.created_at", "p.id") + `
+	LIMIT ?`
 
-	rows, err := db.Query(query, userID)
+	args := append([]interface{}{userID}, keysetArgs...)
+	rows, err := db.Query(query, append(args, page.FetchLimit())...)
 	if err != nil {
 		fmt.Println(" Error retrieving user posts:", err)
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var posts []map[string]interface{}
+	posts := []map[string]interface{}{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var postID int
 		var username, firstname, lastname, avatarURL, title, content, imgOrgif string
@@ -201,13 +227,13 @@ func GetPostsByUserID(db *sql.DB, userID int) ([]map[string]interface{}, error)
 		err := rows.Scan(&postID, &username, &firstname, &lastname, &avatarURL, &title, &content, &imgOrgif, &createdAt)
 		if err != nil {
 			fmt.Println(" Error scanning user post:", err)
-			return nil, err
+			return nil, "", err
 		}
 
 		categories, err := GetCategoriesByPostID(db, postID)
 		if err != nil {
 			fmt.Println(" Error retrieving categories:", err)
-			return nil, err
+			return nil, "", err
 		}
 
 		post := map[string]interface{}{
@@ -223,20 +249,24 @@ func GetPostsByUserID(db *sql.DB, userID int) ([]map[string]interface{}, error)
 			"createdAt":  createdAt.Format("2006-01-02 15:04:05"),
 		}
 		posts = append(posts, post)
+		cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: postID})
 	}
-	return posts, nil
+	posts, next := pagination.Result(page, posts, cursors)
+	return posts, next, rows.Err()
 }
 
-func GetPostByCategoryID(db *sql.DB, catID int) ([]map[string]interface{}, error) {
+// GetPostByCategoryID returns the posts of a category that match visible, an
+// SQL condition on posts aliased p such as authz.PostFilter returns
+func GetPostByCategoryID(db *sql.DB, catID int, visible string, visibleArgs []interface{}) ([]map[string]interface{}, error) {
 	query := `
-	SELECT p.id, u.username, p.title, p.content,p.imgOrgif, p.created_at 
+	SELECT p.id, u.username, u.firstname, u.lastname, u.avatar_url, p.title, p.content, p.imgOrgif, p.created_at 
 	FROM posts p
 	JOIN post_categories pc ON pc.post_id = p.id
 	JOIN categories c ON c.id = pc.category_id
 	JOIN users u ON u.id = p.user_id
-	WHERE c.id = ?`
+	WHERE c.id = ? AND ` + visible
 
-	rows, err := db.Query(query, catID)
+	rows, err := db.Query(query, append([]interface{}{catID}, visibleArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("error querying posts: %w", err)
 	}
@@ -291,15 +321,17 @@ func GetCategoryIDByName(db *sql.DB, category string) (int, error) {
 	return categoryID, nil
 }
 
-func GetPostIfLiked(db *sql.DB, userID int) ([]map[string]interface{}, error) {
+// GetPostIfLiked returns the posts userID liked that match visible, an SQL
+// condition on posts aliased p such as authz.PostFilter returns
+func GetPostIfLiked(db *sql.DB, userID int, visible string, visibleArgs []interface{}) ([]map[string]interface{}, error) {
 	query := `
-	SELECT p.id, u.username, p.title, p.content,p.imgOrgif, p.created_at 
+	SELECT p.id, u.username, u.firstname, u.lastname, u.avatar_url, p.title, p.content, p.imgOrgif, p.created_at 
 	FROM posts p
 	JOIN users u ON u.id = p.user_id
-	JOIN likes l ON l.post_id = p.id AND l.is_like = 1
-	WHERE l.user_id = ?;`
+	JOIN likes l ON l.post_id = p.id AND l.is_like = 1 AND l.comment_id IS NULL
+	WHERE l.user_id = ? AND ` + visible
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, append([]interface{}{userID}, visibleArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("error querying posts: %w", err)
 	}
@@ -431,94 +463,66 @@ func CheckFollowRelationship(db *sql.DB, userA, userB int) (bool, error) {
 	return hasRelationship, nil
 }
 
-func CheckUserCanSeePost(db *sql.DB, postID, viewerID int) (bool, error) {
-	query := `
-        SELECT p.privacy_level, p.user_id
-        FROM posts p
-        WHERE p.id = ?
-    `
-
-	var privacyLevel, authorID int
-	err := db.QueryRow(query, postID).Scan(&privacyLevel, &authorID)
-	if err != nil {
-		return false, fmt.Errorf("failed to get post privacy: %w", err)
-	}
-
-	// If it's the author's own post
-	if authorID == viewerID {
-		return true, nil
-	}
-
-	// If it's public
-	if privacyLevel == 0 {
-		return true, nil
-	}
-
-	if privacyLevel == 1 {
-		var count int
-		err := db.QueryRow(`
-            SELECT COUNT(*) FROM userFollow 
-            WHERE follower_id = ? AND following_id = ?
-        `, viewerID, authorID).Scan(&count)
-		if err != nil {
-			return false, err
-		}
-		return count > 0, nil
-	}
-
-	if privacyLevel == 2 {
-		var count int
-		err := db.QueryRow(`
-            SELECT COUNT(*) FROM post_permissions 
-            WHERE post_id = ? AND user_id = ?
-        `, postID, viewerID).Scan(&count)
-		if err != nil {
-			return false, err
-		}
-		return count > 0, nil
-	}
-
-	return false, nil
-}
-
-// GetChatHistory retrieves messages between two users
-func GetChatHistory(db *sql.DB, userID1, userID2 int) ([]map[string]interface{}, error) {
+// GetChatHistory retrieves one page of messages between two users and the cursor of the next page.
+// Pages walk back from the latest message but each page is returned oldest first, as the chat displays it.
+func GetChatHistory(db *sql.DB, userID1, userID2 int, page pagination.Page) ([]map[string]interface{}, string, error) {
+	keyset, keysetArgs := page.WhereID("m.id")
 	query := `
-		SELECT m.id, m.sender_id, m.receiver_id, m.content, m.created_at,
-		       u.username as sender_username
+		SELECT m.id, m.sender_id, m.receiver_id, m.content, m.created_at, m.read_at,
+		       m.edited_at, m.deleted_at, u.username as sender_username
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
-		WHERE (m.sender_id = ? AND m.receiver_id = ?) 
-		   OR (m.sender_id = ? AND m.receiver_id = ?)
-		ORDER BY m.created_at ASC
+		WHERE ((m.sender_id = ? AND m.receiver_id = ?) 
+		   OR (m.sender_id = ? AND m.receiver_id = ?))
+		  AND ` + keyset + `
+		ORDER BY ` + page.OrderBy("", "m.id") + `
+		LIMIT ?
 	`
 
-	rows, err := db.Query(query, userID1, userID2, userID2, userID1)
+	args := append([]interface{}{userID1, userID2, userID2, userID1}, keysetArgs...)
+	rows, err := db.Query(query, append(args, page.FetchLimit())...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var messages []map[string]interface{}
+	messages := []map[string]interface{}{}
+	var cursors []pagination.Cursor
 	for rows.Next() {
 		var id, senderID, receiverID int
 		var content, senderUsername string
 		var createdAt time.Time
+		var readAt, editedAt, deletedAt sql.NullTime
 
-		err := rows.Scan(&id, &senderID, &receiverID, &content, &createdAt, &senderUsername)
+		err := rows.Scan(&id, &senderID, &receiverID, &content, &createdAt, &readAt, &editedAt, &deletedAt, &senderUsername)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
-		messages = append(messages, map[string]interface{}{
-			"id":        id,
-			"from":      senderID,
-			"to":        receiverID,
-			"content":   content,
-			"username":  senderUsername,
-			"timestamp": createdAt.Format(time.RFC3339),
-		})
+		message := map[string]interface{}{
+			"id":         id,
+			"message_id": id,
+			"from":       senderID,
+			"to":         receiverID,
+			"content":    content,
+			"username":   senderUsername,
+			"timestamp":  createdAt.Format(time.RFC3339),
+			"deleted":    deletedAt.Valid,
+		}
+		if readAt.Valid {
+			message["read_at"] = readAt.Time.Format(time.RFC3339)
+		}
+		if editedAt.Valid {
+			message["edited_at"] = editedAt.Time.Format(time.RFC3339)
+		}
+		messages = append(messages, message)
+		cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: id})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
 	}
 
-	return messages, nil
+	messages, next := pagination.Result(page, messages, cursors)
+	slices.Reverse(messages)
+	return messages, next, nil
 }
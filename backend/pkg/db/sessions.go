@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetSessionsByUserID returns the unexpired sessions of a user, most recently
+// used first. The session matching currentToken is flagged as "current".
+func GetSessionsByUserID(db *sql.DB, userID int, currentToken string) ([]map[string]interface{}, error) {
+	query := `
+		SELECT id, token, user_agent, ip_address, created_at, last_seen, expires_at
+		FROM sessions
+		WHERE user_id = ?
+		ORDER BY last_seen DESC, id DESC`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var token, userAgent, ipAddress string
+		var createdAt, lastSeen sql.NullTime
+		var expiresAt time.Time
+
+		if err := rows.Scan(&id, &token, &userAgent, &ipAddress, &createdAt, &lastSeen, &expiresAt); err != nil {
+			return nil, err
+		}
+		if now.After(expiresAt) {
+			continue
+		}
+
+		sessions = append(sessions, map[string]interface{}{
+			"id":         id,
+			"user_agent": userAgent,
+			"ip_address": ipAddress,
+			"created_at": createdAt.Time,
+			"last_seen":  lastSeen.Time,
+			"expires_at": expiresAt,
+			"current":    token == currentToken,
+		})
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session and moves its expiry.
+func TouchSession(db *sql.DB, token string, lastSeen, expiresAt time.Time) error {
+	query := `UPDATE sessions SET last_seen = ?, expires_at = ? WHERE token = ?`
+	_, err := db.Exec(query, lastSeen, expiresAt, token)
+	return err
+}
+
+// DeleteUserSession deletes one session owned by userID and returns its token,
+// or an empty token if no such session exists.
+func DeleteUserSession(db *sql.DB, userID, sessionID int) (string, error) {
+	var token string
+	err := db.QueryRow(`SELECT token FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DeleteOtherSessions deletes every session of userID except keepToken and
+// returns the tokens that were removed.
+func DeleteOtherSessions(db *sql.DB, userID int, keepToken string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tokens, err := deleteSessions(tx, userID, keepToken)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, tx.Commit()
+}
+
+// deleteSessions deletes the sessions of userID other than keepToken (all of
+// them if keepToken is empty) and returns their tokens.
+func deleteSessions(tx *sql.Tx, userID int, keepToken string) ([]string, error) {
+	rows, err := tx.Query(`SELECT token FROM sessions WHERE user_id = ? AND token != ?`, userID, keepToken)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND token != ?`, userID, keepToken); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteExpiredSessions removes the expired sessions of a user.
+func DeleteExpiredSessions(db *sql.DB, userID int) error {
+	rows, err := db.Query(`SELECT id, expires_at FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var expired []int
+	for rows.Next() {
+		var id int
+		var expiresAt time.Time
+		if err := rows.Scan(&id, &expiresAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if now.After(expiresAt) {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range expired {
+		if _, err := db.Exec(`DELETE FROM sessions WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetTOTP returns the TOTP secret of userID, whether enrollment was
+// confirmed, and the last accepted time step. It returns sql.ErrNoRows if the
+// user never started enrollment.
+func GetTOTP(db *sql.DB, userID int) (string, bool, int64, error) {
+	var secret string
+	var enabledAt sql.NullTime
+	var lastStep int64
+	err := db.QueryRow(`SELECT secret, enabled_at, last_step FROM user_totp WHERE user_id = ?`, userID).
+		Scan(&secret, &enabledAt, &lastStep)
+	return secret, enabledAt.Valid, lastStep, err
+}
+
+// IsTOTPEnabled reports whether userID has confirmed two-factor authentication.
+func IsTOTPEnabled(db *sql.DB, userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL)`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetPendingTOTP starts (or restarts) enrollment with a new secret. It does
+// nothing if two-factor authentication is already enabled.
+func SetPendingTOTP(db *sql.DB, userID int, secret string) error {
+	_, err := db.Exec(`
+		INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.enabled_at IS NULL`, userID, secret)
+	return err
+}
+
+// EnableTOTP confirms enrollment at the step of the first valid code and
+// stores the user's recovery code hashes.
+func EnableTOTP(db *sql.DB, userID int, step int64, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE user_totp SET enabled_at = ?, last_step = ? WHERE user_id = ? AND enabled_at IS NULL`,
+		time.Now(), step, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return sql.ErrNoRows
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records step as used. It returns false if that step or a later
+// one was already accepted, so every code works once.
+func UseTOTPStep(db *sql.DB, userID int, step int64) (bool, error) {
+	res, err := db.Exec(`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND enabled_at IS NOT NULL AND last_step < ?`,
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DisableTOTP removes two-factor authentication and the recovery codes of userID.
+func DisableTOTP(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of userID and stores new ones.
+func ReplaceRecoveryCodes(db *sql.DB, userID int, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode spends an unused recovery code of userID. It returns false
+// if there is no such code.
+func UseRecoveryCode(db *sql.DB, userID int, codeHash string) (bool, error) {
+	res, err := db.Exec(`UPDATE totp_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes userID has left.
+func CountRecoveryCodes(db *sql.DB, userID int) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM totp_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// CreateLoginChallenge stores the pending-auth token of a login waiting for
+// its second factor.
+func CreateLoginChallenge(db *sql.DB, tokenHash string, userID int, expiresAt time.Time) error {
+	if _, err := db.Exec(`DELETE FROM login_challenges WHERE expires_at < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO login_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		tokenHash, userID, expiresAt)
+	return err
+}
+
+// CheckLoginChallenge counts an attempt against a pending-auth token and
+// returns its user. It returns sql.ErrNoRows if the token is unknown, expired
+// or out of attempts; such tokens are deleted.
+func CheckLoginChallenge(db *sql.DB, tokenHash string, maxAttempts int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID, attempts int
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT user_id, expires_at, attempts FROM login_challenges WHERE token_hash = ?`, tokenHash).
+		Scan(&userID, &expiresAt, &attempts)
+	if err != nil {
+		return 0, err
+	}
+	if time.Now().After(expiresAt) || attempts >= maxAttempts {
+		if _, err := tx.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, tokenHash); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?`, tokenHash); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// DeleteLoginChallenge removes a pending-auth token once it has been used.
+func DeleteLoginChallenge(db *sql.DB, tokenHash string) error {
+	_, err := db.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, tokenHash)
+	return err
+}
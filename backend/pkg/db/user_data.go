@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserDataSection is one part of a user's personal data: Name is the file it
+// is exported as (without extension), Query selects its rows with the user id
+// as ?1.
+type UserDataSection struct {
+	Name  string
+	Query string
+}
+
+// UserDataSections lists everything a data export contains. Image columns are
+// named avatar_url or imgOrgif so the exporter can pick up the files.
+var UserDataSections = []UserDataSection{
+	{"profile", `
+		SELECT id, username, nickname, firstname, lastname, email, age, gender, date_of_birth, bio,
+		       avatar_url, isPrivate AS is_private, created_at, verified_at
+		FROM users WHERE id = ?1`},
+	{"posts", `
+		SELECT p.id, p.title, p.content, p.imgOrgif, p.created_at,
+		       CASE COALESCE(p.privacy_level, 0) WHEN 0 THEN 'public' WHEN 1 THEN 'almost_private' ELSE 'private' END AS privacy,
+		       (SELECT GROUP_CONCAT(c.name, ', ') FROM post_categories pc JOIN categories c ON c.id = pc.category_id WHERE pc.post_id = p.id) AS categories,
+		       (SELECT GROUP_CONCAT(u.username, ', ') FROM post_permissions pp JOIN users u ON u.id = pp.user_id WHERE pp.post_id = p.id) AS visible_to
+		FROM posts p WHERE p.user_id = ?1 ORDER BY p.id`},
+	{"comments", `
+		SELECT id, post_id, content, imgOrgif, created_at
+		FROM comments WHERE user_id = ?1 ORDER BY id`},
+	{"likes", `
+		SELECT post_id, comment_id, CASE WHEN is_like THEN 'like' ELSE 'dislike' END AS reaction, created_at
+		FROM likes WHERE user_id = ?1 ORDER BY id`},
+	{"followers", `
+		SELECT u.id, u.username FROM userFollow f JOIN users u ON u.id = f.follower_id
+		WHERE f.following_id = ?1 ORDER BY u.username`},
+	{"following", `
+		SELECT u.id, u.username FROM userFollow f JOIN users u ON u.id = f.following_id
+		WHERE f.follower_id = ?1 ORDER BY u.username`},
+	{"follow_requests", `
+		SELECT CASE WHEN fr.requester_id = ?1 THEN 'sent' ELSE 'received' END AS direction,
+		       u.username, fr.status, fr.created_at, fr.updated_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = CASE WHEN fr.requester_id = ?1 THEN fr.target_id ELSE fr.requester_id END
+		WHERE fr.requester_id = ?1 OR fr.target_id = ?1 ORDER BY fr.id`},
+	{"messages", `
+		SELECT m.id, CASE WHEN m.sender_id = ?1 THEN 'sent' ELSE 'received' END AS direction,
+		       u.username AS with_user, m.content, m.created_at, m.read_at, m.edited_at, m.deleted_at
+		FROM messages m
+		JOIN users u ON u.id = CASE WHEN m.sender_id = ?1 THEN m.receiver_id ELSE m.sender_id END
+		WHERE m.sender_id = ?1 OR m.receiver_id = ?1 ORDER BY m.id`},
+	{"groups", `
+		SELECT g.id, g.title, g.description, gm.status, gm.is_admin, g.creator_id = ?1 AS is_creator, gm.joined_at
+		FROM group_members gm JOIN groups g ON g.id = gm.group_id
+		WHERE gm.user_id = ?1 ORDER BY g.id`},
+	{"group_posts", `
+		SELECT gp.id, gp.group_id, g.title AS group_title, gp.title, gp.content, gp.imgOrgif, gp.created_at
+		FROM group_posts gp JOIN groups g ON g.id = gp.group_id
+		WHERE gp.user_id = ?1 ORDER BY gp.id`},
+	{"group_post_comments", `
+		SELECT id, group_post_id, content, imgOrgif, created_at
+		FROM group_post_comments WHERE user_id = ?1 ORDER BY id`},
+	{"group_post_reactions", `
+		SELECT group_post_id, 'like' AS reaction, created_at FROM group_post_likes WHERE user_id = ?1
+		UNION ALL
+		SELECT group_post_id, 'dislike', created_at FROM group_post_dislikes WHERE user_id = ?1`},
+	{"group_messages", `
+		SELECT gm.id, gm.group_id, g.title AS group_title, gm.content, gm.created_at, gm.edited_at, gm.deleted_at
+		FROM group_messages gm JOIN groups g ON g.id = gm.group_id
+		WHERE gm.sender_id = ?1 ORDER BY gm.id`},
+	{"event_rsvps", `
+		SELECT e.id AS event_id, e.group_id, e.title, e.starts_at, r.status, r.waitlist_position, r.created_at, r.updated_at
+		FROM event_rsvps r JOIN events e ON e.id = r.event_id
+		WHERE r.user_id = ?1 ORDER BY r.id`},
+}
+
+// QueryUserData runs a section query for userID and returns its rows keyed
+// by column name.
+func QueryUserData(db *sql.DB, query string, userID int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			switch v := values[i].(type) {
+			case []byte:
+				row[col] = string(v)
+			case time.Time:
+				row[col] = v.UTC()
+			default:
+				row[col] = v
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
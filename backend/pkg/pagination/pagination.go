@@ -0,0 +1,184 @@
+// Package pagination implements the opaque keyset cursors used by the list endpoints.
+//
+// A list request takes ?limit=&before=<cursor> or ?limit=&after=<cursor>.
+// before returns items older than the cursor, after returns items newer than it.
+// Responses carry a next_cursor, empty on the last page, which continues in
+// the same direction: send it back as before= if the page was fetched towards
+// older items (the default for newest first lists) and as after= otherwise.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MaxLimit caps the limit query parameter of every paginated endpoint.
+const MaxLimit = 100
+
+// sqliteTimeLayout matches the text stored by CURRENT_TIMESTAMP.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrBothDirections = errors.New("before and after cannot be used together")
+)
+
+// Order is the order in which a list is displayed and paged by default.
+type Order int
+
+const (
+	NewestFirst Order = iota
+	OldestFirst
+)
+
+// Cursor identifies one row of a list ordered by (created_at, id).
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+type encodedCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"id"`
+}
+
+// Encode returns the opaque form of the cursor that is handed to clients.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(encodedCursor{CreatedAt: c.CreatedAt.UTC(), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor produced by Encode.
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c encodedCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: c.CreatedAt, ID: c.ID}, nil
+}
+
+// Page is the parsed before/after/limit part of a list request.
+type Page struct {
+	Before *Cursor
+	After  *Cursor
+	Limit  int
+	Order  Order
+}
+
+// Parse reads limit, before and after from the query string. A missing or
+// invalid limit falls back to defaultLimit and is capped at MaxLimit.
+func Parse(r *http.Request, defaultLimit int, order Order) (Page, error) {
+	q := r.URL.Query()
+	page := Page{Limit: defaultLimit, Order: order}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		page.Limit = l
+	}
+	if page.Limit > MaxLimit {
+		page.Limit = MaxLimit
+	}
+
+	before, after := q.Get("before"), q.Get("after")
+	if before != "" && after != "" {
+		return page, ErrBothDirections
+	}
+	var err error
+	if before != "" {
+		page.Before, err = Decode(before)
+	} else if after != "" {
+		page.After, err = Decode(after)
+	}
+	return page, err
+}
+
+// descending reports whether the page is fetched from newer to older rows.
+func (p Page) descending() bool {
+	if p.Before != nil {
+		return true
+	}
+	if p.After != nil {
+		return false
+	}
+	return p.Order == NewestFirst
+}
+
+// Where returns an SQL condition selecting the rows past the cursor, for
+// tables whose created_at column holds CURRENT_TIMESTAMP text. It returns
+// "1 = 1" when the page has no cursor.
+func (p Page) Where(createdCol, idCol string) (string, []interface{}) {
+	c, op := p.cursor()
+	if c == nil {
+		return "1 = 1", nil
+	}
+	createdAt := c.CreatedAt.UTC().Format(sqliteTimeLayout)
+	return "(" + createdCol + " " + op + " ? OR (" + createdCol + " = ? AND " + idCol + " " + op + " ?))",
+		[]interface{}{createdAt, createdAt, c.ID}
+}
+
+// WhereID is Where for the chat tables. Their created_at values are Go time
+// strings in mixed zones that do not compare as text, so rows are keyed on
+// the AUTOINCREMENT id alone, which follows insertion order.
+func (p Page) WhereID(idCol string) (string, []interface{}) {
+	c, op := p.cursor()
+	if c == nil {
+		return "1 = 1", nil
+	}
+	return idCol + " " + op + " ?", []interface{}{c.ID}
+}
+
+func (p Page) cursor() (*Cursor, string) {
+	if p.Before != nil {
+		return p.Before, "<"
+	}
+	if p.After != nil {
+		return p.After, ">"
+	}
+	return nil, ""
+}
+
+// OrderBy returns the ORDER BY expression walking away from the cursor.
+// Pass an empty createdCol to order by id alone, as WhereID does.
+func (p Page) OrderBy(createdCol, idCol string) string {
+	dir := " ASC"
+	if p.descending() {
+		dir = " DESC"
+	}
+	if createdCol == "" {
+		return idCol + dir
+	}
+	return createdCol + dir + ", " + idCol + dir
+}
+
+// FetchLimit is the LIMIT to query with. The extra row tells whether
+// another page exists.
+func (p Page) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// Result drops the look-ahead row from items fetched with OrderBy and
+// FetchLimit, puts them in the page's display order and returns the
+// next_cursor ("" on the last page). cursors[i] must be the cursor of items[i].
+func Result[T any](p Page, items []T, cursors []Cursor) ([]T, string) {
+	next := ""
+	if p.Limit > 0 && len(items) > p.Limit {
+		items = items[:p.Limit]
+		next = cursors[p.Limit-1].Encode()
+	}
+	if p.descending() != (p.Order == NewestFirst) {
+		slices.Reverse(items)
+	}
+	return items, next
+}
+
+// WriteError responds 400 to a request with a malformed cursor.
+func WriteError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
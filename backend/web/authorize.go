@@ -0,0 +1,79 @@
+package web
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"socialnetwork/pkg/apis/authz"
+	u "socialnetwork/pkg/apis/user"
+)
+
+// errBadTarget is returned by checks that cannot find the target id in the request.
+var errBadTarget = errors.New("missing or invalid id")
+
+// authCheck reports whether actorID may perform the request.
+type authCheck func(actorID int, r *http.Request) (bool, error)
+
+// authorize is the authorization layer in front of mutating endpoints. It
+// resolves the acting user from the session and runs check before calling
+// next, so handlers never act on ids taken from the request on their own.
+// A denied request gets authz.Forbidden with message.
+func authorize(db *sql.DB, message string, check authCheck, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := check(actorID, r)
+		switch {
+		case errors.Is(err, errBadTarget):
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Not found", http.StatusNotFound)
+		case err != nil:
+			fmt.Println("Error checking permissions:", err)
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		case !allowed:
+			authz.Forbidden(w, message)
+		default:
+			next(w, r)
+		}
+	}
+}
+
+// bodyID reads an integer field of a JSON request body. The body is put back
+// so the handler can decode it again.
+func bodyID(r *http.Request, field string) (int, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return 0, errBadTarget
+	}
+	var id int
+	if err := json.Unmarshal(body[field], &id); err != nil || id <= 0 {
+		return 0, errBadTarget
+	}
+	return id, nil
+}
+
+// pathID parses an id taken from the URL path or query string.
+func pathID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, errBadTarget
+	}
+	return id, nil
+}
@@ -4,20 +4,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	cor "socialnetwork/pkg/apis"
+	"socialnetwork/pkg/apis/authz"
 	"socialnetwork/pkg/apis/chat"
 	e "socialnetwork/pkg/apis/error"
+	"socialnetwork/pkg/apis/export"
 	g "socialnetwork/pkg/apis/group"
 	"socialnetwork/pkg/apis/like"
 	likerepo "socialnetwork/pkg/apis/like/repo"
+	"socialnetwork/pkg/apis/mail"
+	"socialnetwork/pkg/apis/notification"
 	p "socialnetwork/pkg/apis/post"
 	u "socialnetwork/pkg/apis/user"
 	database "socialnetwork/pkg/db"
+	"socialnetwork/pkg/pagination"
 )
 
 type Page struct {
@@ -30,9 +36,28 @@ func isAuthenticated(db *sql.DB, r *http.Request) bool {
 }
 
 func ConnectWeb(db *sql.DB) {
+	mailer := mail.FromEnv()
+	policy := u.UnverifiedPolicyFromEnv()
+	throttle := u.NewThrottle()
+
 	// Initialize WebSocket hub first so it can be used by other handlers
 	chatHub := chat.NewHub(db)
+	chatHub.CanWrite = func(userID int) bool {
+		allowed, err := policy.CanWrite(db, userID)
+		if err != nil {
+			fmt.Println("Error checking email verification:", err)
+		}
+		return allowed
+	}
+	chatHub.SlowConsumers = chat.SlowConsumerPolicyFromEnv()
+	broker, err := chat.BrokerFromEnv()
+	if err != nil {
+		log.Fatal("Error configuring the WebSocket broker: ", err)
+	}
+	chatHub.Broker = broker
 	go chatHub.Run()
+	go u.RunAccountPurge(db)
+	go export.RunCleanup(db)
 
 	// // Optionally clear all tables if needed
 	// if err := clearAllTables(db); err != nil {
@@ -40,51 +65,9 @@ func ConnectWeb(db *sql.DB) {
 	// 	return
 	// }
 
-	http.HandleFunc("/api/follow", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		// 1) Authentication
-		userID, ok := u.ValidateSession(db, r)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		// 2) Parse targetId from query
-		q := r.URL.Query().Get("targetId")
-		targetID, err := strconv.Atoi(q)
-		if err != nil || targetID <= 0 {
-			http.Error(w, "Invalid targetId", http.StatusBadRequest)
-			return
-		}
+	http.HandleFunc("/api/follow", cor.WithCORS(followAPI(db)))
 
-		// 3) Perform follow or unfollow
-		switch r.Method {
-		case http.MethodPost:
-			_, err = db.Exec(
-				`INSERT OR IGNORE INTO userFollow(follower_id, following_id) VALUES (?, ?)`,
-				userID, targetID,
-			)
-		case http.MethodDelete:
-			_, err = db.Exec(
-				`DELETE FROM userFollow WHERE follower_id = ? AND following_id = ?`,
-				userID, targetID,
-			)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
-	}))
-
-	if err := ensureEventPollTables(db, chatHub); err != nil {
-		fmt.Println("Error creating event tables:", err)
-	}
+	registerProfileRoutes(db, chatHub, mailer)
 
 	http.HandleFunc("/api/follow/counts", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := u.ValidateSession(db, r)
@@ -158,27 +141,7 @@ func ConnectWeb(db *sql.DB) {
 				return
 			}
 
-			switch r.Method {
-			case http.MethodPost:
-				_, err = db.Exec(
-					`INSERT OR IGNORE INTO userFollow(follower_id, following_id) VALUES (?, ?)`,
-					userID, targetID,
-				)
-			case http.MethodDelete:
-				_, err = db.Exec(
-					`DELETE FROM userFollow WHERE follower_id = ? AND following_id = ?`,
-					userID, targetID,
-				)
-			default:
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				return
-			}
-			if err != nil {
-				http.Error(w, "Database error", http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]bool{"success": true})
+			setFollow(db, w, r, userID, targetID)
 			return
 		}
 
@@ -188,13 +151,54 @@ func ConnectWeb(db *sql.DB) {
 
 	http.HandleFunc("/signup", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
-			u.Register(db, w, r) // Call the user registration function
+			u.Register(db, mailer, throttle, w, r) // Call the user registration function
 			return
 		}
 	}))
 
 	http.HandleFunc("/login", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		u.Login(db, w, r) // Call the Login function from Register.go
+		u.Login(db, policy, throttle, w, r) // Call the Login function from Register.go
+	}))
+
+	http.HandleFunc("/login/2fa", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.LoginTwoFactor(db, throttle, w, r)
+	}))
+
+	// Two-factor authentication settings of the logged in user
+	http.HandleFunc("/2fa/status", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.TwoFactorStatus(db, w, r)
+	}))
+
+	http.HandleFunc("/2fa/enroll", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.EnrollTwoFactor(db, w, r)
+	}))
+
+	http.HandleFunc("/2fa/confirm", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.ConfirmTwoFactor(db, w, r)
+	}))
+
+	http.HandleFunc("/2fa/disable", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.DisableTwoFactor(db, throttle, w, r)
+	}))
+
+	http.HandleFunc("/2fa/recovery-codes", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.RegenerateRecoveryCodes(db, throttle, w, r)
+	}))
+
+	http.HandleFunc("/verify-email", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.VerifyEmail(db, w, r)
+	}))
+
+	http.HandleFunc("/resend-verification", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.ResendVerification(db, mailer, throttle, w, r)
+	}))
+
+	http.HandleFunc("/forgot-password", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.ForgotPassword(db, mailer, throttle, w, r)
+	}))
+
+	http.HandleFunc("/reset-password", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.ResetPassword(db, chatHub, w, r)
 	}))
 
 	http.HandleFunc("/get-posts", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -210,7 +214,13 @@ func ConnectWeb(db *sql.DB) {
 		fmt.Println("User ID:", userID)
 		fmt.Println("Logged In:", loggedIn)
 
-		posts, err := database.GetPostsByUserID(db, userID)
+		page, err := pagination.Parse(r, 20, pagination.NewestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
+
+		posts, nextCursor, err := database.GetPostsByUserID(db, userID, page)
 		if err != nil {
 			e.ErrorHandler(w, r, 500)
 			fmt.Println("Error fetching posts for user ID:", userID, "Error:", err)
@@ -219,8 +229,9 @@ func ConnectWeb(db *sql.DB) {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"posts":   posts,
+			"success":     true,
+			"posts":       posts,
+			"next_cursor": nextCursor,
 		})
 	}))
 
@@ -234,13 +245,32 @@ func ConnectWeb(db *sql.DB) {
 		username := strings.TrimPrefix(r.URL.Path, "/get-otherPosts/")
 		fmt.Println("Username:", username)
 
+		page, err := pagination.Parse(r, 20, pagination.NewestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
+
 		uid, err := database.GetUserID(db, username)
-		if err != nil || uid == 0 {
+		if err != nil || uid <= 0 {
 			e.ErrorHandler(w, r, 404)
 			fmt.Println("Error fetching user ID for username:", username)
 			return
 		}
 
+		// Determine whether the viewer can see the full profile; accounts
+		// waiting for deletion are gone as far as others are concerned
+		canView, err := authz.CanSeeProfile(db, viewerID, uid)
+		if err == sql.ErrNoRows {
+			e.ErrorHandler(w, r, 404)
+			return
+		}
+		if err != nil {
+			e.ErrorHandler(w, r, 500)
+			fmt.Println("Error checking profile visibility for username:", username, "Error:", err)
+			return
+		}
+
 		// Fetch profile privacy and basic profile fields first
 		var existingBio sql.NullString
 		var (
@@ -274,19 +304,6 @@ func ConnectWeb(db *sql.DB) {
 			bio = ""
 		}
 
-		// Determine whether the viewer can see the full profile
-		canView := false
-		if !isPrivate || viewerID == uid {
-			canView = true
-		} else {
-			// Check if viewer follows the target user
-			var cnt int
-			err = db.QueryRow(`SELECT COUNT(*) FROM userFollow WHERE follower_id = ? AND following_id = ?`, viewerID, uid).Scan(&cnt)
-			if err == nil && cnt > 0 {
-				canView = true
-			}
-		}
-
 		// Determine follow relationship and pending request status between viewer and target
 		isFollowing := false
 		_ = db.QueryRow(`SELECT COUNT(*) > 0 FROM userFollow WHERE follower_id = ? AND following_id = ?`, viewerID, uid).Scan(&isFollowing)
@@ -295,7 +312,11 @@ func ConnectWeb(db *sql.DB) {
 		_ = db.QueryRow(`SELECT status FROM follow_requests WHERE requester_id = ? AND target_id = ?`, viewerID, uid).Scan(&requestStatus)
 
 		var posts []map[string]interface{}
+		nextCursor := ""
 		if canView {
+			keyset, keysetArgs := page.Where("p.created_at", "p.id")
+			visible, visibleArgs := authz.PostFilter("p", viewerID)
+			args := append(append([]interface{}{uid}, visibleArgs...), keysetArgs...)
 			rows, err := db.Query(`
 				SELECT DISTINCT
 					p.id, u.username, p.title, p.content,
@@ -314,21 +335,11 @@ func ConnectWeb(db *sql.DB) {
 				SELECT post_id, COUNT(*) AS count FROM likes
 				WHERE is_like = 0 AND comment_id IS NULL GROUP BY post_id
 				) dislikes ON p.id = dislikes.post_id
-				WHERE p.user_id = ?
-				AND (
-					COALESCE(p.privacy_level,0) = 0                         -- Public
-					OR (? = p.user_id)                                         -- Viewer is owner
-					OR (COALESCE(p.privacy_level,0) = 1 AND EXISTS (           -- Followers-only
-						SELECT 1 FROM userFollow f
-						WHERE f.follower_id = ? AND f.following_id = p.user_id
-					))
-					OR (COALESCE(p.privacy_level,0) = 2 AND EXISTS (           -- Selected followers
-						SELECT 1 FROM post_permissions pp
-						WHERE pp.post_id = p.id AND pp.user_id = ?
-					))
-				)
-				ORDER BY p.created_at DESC
-			`, uid, viewerID, viewerID, viewerID)
+				WHERE p.user_id = ? AND `+visible+`
+				AND `+keyset+`
+				ORDER BY `+page.OrderBy("p.created_at", "p.id")+`
+				LIMIT ?
+			`, append(args, page.FetchLimit())...)
 			if err != nil {
 				e.ErrorHandler(w, r, 500)
 				fmt.Println("Error fetching posts for username:", username, "Error:", err)
@@ -336,6 +347,8 @@ func ConnectWeb(db *sql.DB) {
 			}
 			defer rows.Close()
 
+			posts = []map[string]interface{}{}
+			var cursors []pagination.Cursor
 			for rows.Next() {
 				var (
 					postID, privacyLevel, likesCount, dislikesCount int
@@ -366,7 +379,9 @@ func ConnectWeb(db *sql.DB) {
 					"dislikes_count": dislikesCount,
 					"createdAt":      createdAt.Format("2006-01-02 15:04:05"),
 				})
+				cursors = append(cursors, pagination.Cursor{CreatedAt: createdAt, ID: postID})
 			}
+			posts, nextCursor = pagination.Result(page, posts, cursors)
 		} else {
 			// Viewer cannot view private profile details
 			posts = []map[string]interface{}{}
@@ -428,8 +443,9 @@ func ConnectWeb(db *sql.DB) {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"profile": profileObj,
-			"posts":   posts,
+			"profile":     profileObj,
+			"posts":       posts,
+			"next_cursor": nextCursor,
 		})
 	}))
 
@@ -542,8 +558,14 @@ func ConnectWeb(db *sql.DB) {
 			return
 		}
 
+		page, err := pagination.Parse(r, 50, pagination.NewestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
+
 		// Fetch chat history
-		messages, err := database.GetChatHistory(db, userID, otherUserID)
+		messages, nextCursor, err := database.GetChatHistory(db, userID, otherUserID, page)
 		if err != nil {
 			fmt.Println("Error fetching chat history:", err)
 			http.Error(w, "Failed to fetch chat history", http.StatusInternalServerError)
@@ -552,7 +574,8 @@ func ConnectWeb(db *sql.DB) {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"messages": messages,
+			"messages":    messages,
+			"next_cursor": nextCursor,
 		})
 	}))
 
@@ -569,9 +592,17 @@ func ConnectWeb(db *sql.DB) {
 		likesController.InteractWithComment(w, r, db)
 	}))
 
-	http.HandleFunc("/getInteractions", cor.WithCORS(likesController.GetInteractions))
+	http.HandleFunc("/getInteractions", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		likesController.GetInteractions(w, r, db)
+	}))
 
 	http.HandleFunc("/comments", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		viewerID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+
 		postIDStr := r.URL.Query().Get("post_id")
 		postID, err := strconv.Atoi(postIDStr)
 		if err != nil || postID <= 0 {
@@ -579,6 +610,18 @@ func ConnectWeb(db *sql.DB) {
 			return
 		}
 
+		// Posts the viewer may not see are reported as missing
+		canSee, err := authz.CanSeePost(db, viewerID, postID)
+		if err != nil && err != sql.ErrNoRows {
+			fmt.Println("Error checking post visibility:", err)
+			e.ErrorHandler(w, r, 500)
+			return
+		}
+		if !canSee {
+			e.ErrorHandler(w, r, 404)
+			return
+		}
+
 		// Fetch post details
 		post, err := database.GetPostByPostID(db, postID)
 		if err != nil || len(post) == 0 {
@@ -586,8 +629,14 @@ func ConnectWeb(db *sql.DB) {
 			return
 		}
 
+		page, err := pagination.Parse(r, 20, pagination.OldestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
+
 		// Fetch comments
-		comments, err := p.GetCommentsByPostID(db, postID)
+		comments, nextCursor, err := p.GetCommentsByPostID(db, postID, page)
 		if err != nil {
 			e.ErrorHandler(w, r, 500)
 			return
@@ -599,8 +648,9 @@ func ConnectWeb(db *sql.DB) {
 			postObj["image"] = img
 		}
 		response := map[string]interface{}{
-			"post":     postObj,
-			"comments": comments,
+			"post":        postObj,
+			"comments":    comments,
+			"next_cursor": nextCursor,
 		}
 		// Return combined response as JSON
 		w.Header().Set("Content-Type", "application/json")
@@ -611,6 +661,19 @@ func ConnectWeb(db *sql.DB) {
 		p.CreateComment(db, chatHub, w, r) // Pass hub for real-time updates
 	}))
 
+	// DELETE /delete-post?post_id= (author only)
+	http.HandleFunc("/delete-post", cor.WithCORS(authorize(db, "You can only delete your own posts",
+		func(actorID int, r *http.Request) (bool, error) {
+			postID, err := pathID(r.URL.Query().Get("post_id"))
+			if err != nil {
+				return false, err
+			}
+			return authz.CanDeletePost(db, actorID, postID)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			p.DeletePost(db, w, r)
+		})))
+
 	http.HandleFunc("/category/", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		category := strings.TrimPrefix(r.URL.Path, "/category/")
 		fmt.Println(category)
@@ -621,24 +684,31 @@ func ConnectWeb(db *sql.DB) {
 		p.GetPostbyCategory(db, w, r, category)
 	}))
 
-	http.HandleFunc("/editGet/", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		username := strings.TrimPrefix(r.URL.Path, "/editGet/")
-		fmt.Println(username)
+	// The edit routes take the username from the path, so only its owner may use them
+	ownsProfile := func(prefix string) authCheck {
+		return func(actorID int, r *http.Request) (bool, error) {
+			return authz.IsProfileOwner(db, actorID, strings.TrimPrefix(r.URL.Path, prefix))
+		}
+	}
 
-		u.GetProfileHandler(db, w, r, username)
-	}))
+	http.HandleFunc("/editGet/", cor.WithCORS(authorize(db, "You can only edit your own profile", ownsProfile("/editGet/"),
+		func(w http.ResponseWriter, r *http.Request) {
+			username := strings.TrimPrefix(r.URL.Path, "/editGet/")
+			u.GetProfileHandler(db, w, r, username)
+		})))
 
-	http.HandleFunc("/editPost/", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			fmt.Println("Invalid method for /editPost/")
-			return
-		}
-		username := strings.TrimPrefix(r.URL.Path, "/editPost/")
-		fmt.Println("Update for: " + username)
+	http.HandleFunc("/editPost/", cor.WithCORS(authorize(db, "You can only edit your own profile", ownsProfile("/editPost/"),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				fmt.Println("Invalid method for /editPost/")
+				return
+			}
+			username := strings.TrimPrefix(r.URL.Path, "/editPost/")
+			fmt.Println("Update for: " + username)
 
-		u.UpdateProfileHandler(db, w, r, username)
-	}))
+			u.UpdateProfileHandler(db, chatHub, mailer, w, r, username)
+		})))
 
 	// Group API endpoints
 	http.HandleFunc("/create-group", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -694,18 +764,34 @@ func ConnectWeb(db *sql.DB) {
 		g.GetReceivedInvitations(db, w, r)
 	}))
 
-	http.HandleFunc("/cancel-invitation", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		g.CancelInvitation(db, w, r)
-	}))
+	http.HandleFunc("/cancel-invitation", cor.WithCORS(authorize(db, "Only the member who sent an invitation can cancel it",
+		func(actorID int, r *http.Request) (bool, error) {
+			invitationID, err := bodyID(r, "invitation_id")
+			if err != nil {
+				return false, err
+			}
+			return authz.CanCancelInvitation(db, actorID, invitationID)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			g.CancelInvitation(db, w, r)
+		})))
 
 	// New endpoints for pending group join requests
 	http.HandleFunc("/get-pending-join-requests", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		g.GetPendingJoinRequests(db, w, r)
 	}))
 
-	http.HandleFunc("/respond-join-request", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		g.RespondToJoinRequest(db, chatHub, w, r)
-	}))
+	http.HandleFunc("/respond-join-request", cor.WithCORS(authorize(db, "Only group admins can answer join requests",
+		func(actorID int, r *http.Request) (bool, error) {
+			requestID, err := bodyID(r, "request_id")
+			if err != nil {
+				return false, err
+			}
+			return authz.CanRespondToJoinRequest(db, actorID, requestID)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			g.RespondToJoinRequest(db, chatHub, w, r)
+		})))
 
 	http.HandleFunc("/groups/create-post", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		g.CreateGroupPost(db, chatHub, w, r)
@@ -723,132 +809,24 @@ func ConnectWeb(db *sql.DB) {
 		g.ToggleGroupPostDislike(db, chatHub, w, r)
 	}))
 
-	// Create an event with a built-in YES/NO poll
+	// Create a group event; members RSVP with going/maybe/not_going
 	http.HandleFunc("/create-event", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		userID, loggedIn := u.ValidateSession(db, r)
-		if !loggedIn {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var req struct {
-			GroupID     int    `json:"group_id"`
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			EventDate   string `json:"event_date"` // optional ISO datetime from client
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Bad JSON", http.StatusBadRequest)
-			return
-		}
-		if req.GroupID <= 0 || strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Description) == "" {
-			http.Error(w, "Missing fields", http.StatusBadRequest)
-			return
-		}
-
-		// Check requester is accepted member
-		var cnt int
-		if err := db.QueryRow(`
-        SELECT COUNT(*) FROM group_members
-        WHERE group_id = ? AND user_id = ? AND status = 'accepted'
-    `, req.GroupID, userID).Scan(&cnt); err != nil || cnt == 0 {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		// Insert event (store optional event_date)
-		var evDate interface{}
-		if strings.TrimSpace(req.EventDate) == "" {
-			evDate = nil
-		} else {
-			evDate = req.EventDate
-		}
-
-		res, err := db.Exec(`
-		INSERT INTO events (group_id, creator_id, title, description, event_date, created_at)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, req.GroupID, userID, req.Title, req.Description, evDate)
-		if err != nil {
-			http.Error(w, "DB error", http.StatusInternalServerError)
-			return
-		}
-		id, _ := res.LastInsertId()
-
-		// Get username for WebSocket broadcast
-		var username string
-		db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-
-		// Query event poll counts and user's vote
-		var yesCount, noCount int
-		_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='yes'`, id).Scan(&yesCount)
-		_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='no'`, id).Scan(&noCount)
-		var uv sql.NullString
-		_ = db.QueryRow(`SELECT choice FROM event_votes WHERE event_id = ? AND user_id = ?`, id, userID).Scan(&uv)
-		var userVote string
-		if uv.Valid {
-			userVote = uv.String
-		}
-
-		// Broadcast new event to all group members via WebSocket
-		eventNotification := chat.Frontend{
-			Type:      "new_groupEvent",
-			From:      userID,
-			Username:  username,
-			GroupID:   req.GroupID,
-			PostId:    int(id),
-			Content:   req.Title + ": " + req.Description,
-			EventDate: req.EventDate,
-			Timestamp: time.Now(),
-			YesCount:  yesCount,
-			NoCount:   noCount,
-			UserVote:  userVote,
-		}
-
-		// Get group member IDs
-		rows, err := db.Query(`
-			SELECT user_id 
-			FROM group_members 
-			WHERE group_id = ? AND status = 'accepted'
-		`, req.GroupID)
-		if err == nil {
-			defer rows.Close()
-			var memberIDs []int
-			for rows.Next() {
-				var memberID int
-				if rows.Scan(&memberID) == nil {
-					memberIDs = append(memberIDs, memberID)
-				}
-			}
-
-			chatHub.Mutex.RLock()
-			for _, memberID := range memberIDs {
-				// Do not send the event notification back to the creator
-				if memberID == userID {
-					continue
-				}
-				if client, ok := chatHub.Clients[memberID]; ok {
-					select {
-					case client.Send <- eventNotification:
-					default:
-						// Skip if buffer full
-					}
-				}
-			}
-			chatHub.Mutex.RUnlock()
-		}
+		g.CreateEvent(db, chatHub, w, r)
+	}))
 
-		// Success
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":  true,
-			"event_id": id,
-		})
+	// Calendar feed of all the user's group events, authenticated by a token
+	// in the URL so calendar apps can subscribe
+	http.HandleFunc("/calendar/feed", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		g.CalendarFeedToken(db, w, r)
+	}))
+	http.HandleFunc("/calendar/feed/reset", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		g.ResetCalendarFeedToken(db, w, r)
 	}))
+	http.HandleFunc("/calendar/", func(w http.ResponseWriter, r *http.Request) {
+		g.CalendarFeed(db, w, r)
+	})
 
-	// List events for a group with poll counts and this user's vote
+	// Group posts and events
 	http.HandleFunc("/groups/", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/groups/")
 		parts := strings.Split(path, "/")
@@ -869,175 +847,62 @@ func ConnectWeb(db *sql.DB) {
 			return
 		}
 
-		// DELETE /groups/{gid}/posts/{pid}
+		// DELETE /groups/{gid}/posts/{pid} (author or group admin)
 		if len(parts) == 3 && parts[1] == "posts" && r.Method == http.MethodDelete {
 			gid := parts[0]
 			pid := parts[2]
-			g.DeleteGroupPost(db, w, r, gid, pid)
+			authorize(db, "Only the author or a group admin can delete this post",
+				func(actorID int, r *http.Request) (bool, error) {
+					postID, err := pathID(pid)
+					if err != nil {
+						return false, err
+					}
+					return authz.CanDeleteGroupPost(db, actorID, postID)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					g.DeleteGroupPost(db, w, r, gid, pid)
+				})(w, r)
 			return
 		}
 
 		// ---------- EVENTS ----------
+		// GET /groups/{gid}/events.ics
+		if len(parts) == 2 && parts[1] == "events.ics" {
+			g.GroupEventsICS(db, w, r, parts[0])
+			return
+		}
+
 		// GET /groups/{gid}/events
 		if len(parts) == 2 && parts[1] == "events" && r.Method == http.MethodGet {
-			userID, loggedIn := u.ValidateSession(db, r)
-			if !loggedIn {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			groupID, err := strconv.Atoi(parts[0])
-			if err != nil || groupID <= 0 {
-				http.Error(w, "Invalid group id", http.StatusBadRequest)
-				return
-			}
-
-			// Must be accepted member to view
-			var cnt int
-			if err := db.QueryRow(`
-            SELECT COUNT(*) FROM group_members
-            WHERE group_id = ? AND user_id = ? AND status = 'accepted'
-        `, groupID, userID).Scan(&cnt); err != nil || cnt == 0 {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			rows, err := db.Query(`
-			SELECT id, title, description, datetime(created_at), event_date
-			FROM events
-			WHERE group_id = ?
-			ORDER BY created_at DESC
-		`, groupID)
-			if err != nil {
-				http.Error(w, "DB error", http.StatusInternalServerError)
-				return
-			}
-			defer rows.Close()
-
-			type EventOut struct {
-				ID          int64   `json:"id"`
-				Title       string  `json:"title"`
-				Description string  `json:"description"`
-				CreatedAt   string  `json:"created_at"`
-				EventDate   *string `json:"event_date"`
-				YesCount    int     `json:"yes_count"`
-				NoCount     int     `json:"no_count"`
-				UserVote    *string `json:"user_vote"` // "yes"|"no"|nil
-			}
-
-			var out []EventOut
-			for rows.Next() {
-				var ev EventOut
-				if err := rows.Scan(&ev.ID, &ev.Title, &ev.Description, &ev.CreatedAt, &ev.EventDate); err == nil {
-					_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='yes'`, ev.ID).Scan(&ev.YesCount)
-					_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='no'`, ev.ID).Scan(&ev.NoCount)
-					var uv sql.NullString
-					_ = db.QueryRow(`SELECT choice FROM event_votes WHERE event_id = ? AND user_id = ?`, ev.ID, userID).Scan(&uv)
-					if uv.Valid {
-						v := uv.String
-						ev.UserVote = &v
-					}
-					out = append(out, ev)
-				}
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			if out == nil {
-				out = []EventOut{}
-			}
-			json.NewEncoder(w).Encode(out)
+			g.GetGroupEvents(db, w, r, parts[0])
 			return
 		}
 
-		// POST /groups/events/vote?event_id=123&choice=yes|no
-		if len(parts) == 2 && parts[0] == "events" && parts[1] == "vote" && r.Method == http.MethodPost {
-			userID, loggedIn := u.ValidateSession(db, r)
-			if !loggedIn {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			eventID, _ := strconv.Atoi(r.URL.Query().Get("event_id"))
-			choice := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("choice")))
-			if eventID <= 0 || (choice != "yes" && choice != "no") {
-				http.Error(w, "Invalid params", http.StatusBadRequest)
-				return
-			}
-
-			var groupID int
-			if err := db.QueryRow(`SELECT group_id FROM events WHERE id=?`, eventID).Scan(&groupID); err != nil {
-				http.Error(w, "Event not found", http.StatusNotFound)
-				return
-			}
-			var cnt int
-			if err := db.QueryRow(`
-            SELECT COUNT(*) FROM group_members
-            WHERE group_id = ? AND user_id = ? AND status = 'accepted'
-        `, groupID, userID).Scan(&cnt); err != nil || cnt == 0 {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			_, err := db.Exec(`
-            INSERT INTO event_votes (event_id, user_id, choice)
-            VALUES (?, ?, ?)
-            ON CONFLICT(event_id, user_id) DO UPDATE SET choice=excluded.choice
-        `, eventID, userID, choice)
-			if err != nil {
-				http.Error(w, "DB error", http.StatusInternalServerError)
-				return
-			}
-
-			// Get username for WebSocket broadcast
-			var username string
-			db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
-
-			// Query updated counts and user's vote
-			var yesCount, noCount int
-			_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='yes'`, eventID).Scan(&yesCount)
-			_ = db.QueryRow(`SELECT COUNT(*) FROM event_votes WHERE event_id = ? AND choice='no'`, eventID).Scan(&noCount)
-
-			voteNotification := chat.Frontend{
-				Type:      "group_event_vote_update",
-				From:      userID,
-				Username:  username,
-				GroupID:   groupID,
-				PostId:    eventID,
-				YesCount:  yesCount,
-				NoCount:   noCount,
-				UserVote:  choice,
-				Timestamp: time.Now(),
+		// GET|PUT /groups/{gid}/events/{eid}
+		if len(parts) == 3 && parts[1] == "events" {
+			switch r.Method {
+			case http.MethodGet:
+				g.GetGroupEvent(db, w, r, parts[0], parts[2])
+			case http.MethodPut, http.MethodPatch:
+				g.UpdateEvent(db, chatHub, w, r, parts[0], parts[2])
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
+			return
+		}
 
-			// Get group member IDs
-			memberRows, err := db.Query(`
-				SELECT user_id 
-				FROM group_members 
-				WHERE group_id = ? AND status = 'accepted'
-			`, groupID)
-			if err == nil {
-				defer memberRows.Close()
-				var memberIDs []int
-				for memberRows.Next() {
-					var memberID int
-					if memberRows.Scan(&memberID) == nil {
-						memberIDs = append(memberIDs, memberID)
-					}
-				}
-
-				chatHub.Mutex.RLock()
-				for _, memberID := range memberIDs {
-					if client, ok := chatHub.Clients[memberID]; ok {
-						select {
-						case client.Send <- voteNotification:
-						default:
-							// Skip if buffer full
-						}
-					}
-				}
-				chatHub.Mutex.RUnlock()
+		// POST /groups/{gid}/events/{eid}/rsvp|cancel, GET /groups/{gid}/events/{eid}/attendees
+		if len(parts) == 4 && parts[1] == "events" {
+			switch {
+			case parts[3] == "rsvp" && r.Method == http.MethodPost:
+				g.RSVPEvent(db, chatHub, w, r, parts[0], parts[2])
+			case parts[3] == "cancel" && r.Method == http.MethodPost:
+				g.CancelEvent(db, chatHub, w, r, parts[0], parts[2])
+			case parts[3] == "attendees" && r.Method == http.MethodGet:
+				g.GetEventAttendees(db, w, r, parts[0], parts[2])
+			default:
+				http.Error(w, "Not found", http.StatusNotFound)
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]any{"success": true})
 			return
 		}
 
@@ -1047,35 +912,29 @@ func ConnectWeb(db *sql.DB) {
 	http.HandleFunc("/check-session", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		userID, loggedIn := u.ValidateSession(db, r)
 		username, _ := database.GetUsernameUsingID(db, userID)
+		verified, _ := database.IsEmailVerified(db, userID)
 		response := map[string]interface{}{
 			"loggedIn": loggedIn,
 			"userID":   userID,
 			"username": username,
+			"verified": verified,
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}))
 
 	http.HandleFunc("/logout", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		cookie := &http.Cookie{
-			Name:     "session_token",
-			Value:    "",
-			Expires:  time.Now().Add(-1 * time.Hour), // Expire immediately
-			HttpOnly: true,
-			Path:     "/",
-			Domain:   "localhost",
-		}
-		http.SetCookie(w, cookie)
-
-		cookie, err := r.Cookie("session_token")
-		cookieINT, _ := strconv.Atoi(cookie.Value)
-		if err == nil {
+		u.ClearSessionCookie(w, r)
+
+		if sessionCookie, err := r.Cookie("session_token"); err == nil && sessionCookie.Value != "" {
 			// Call a function to delete the session from the database
-			err := database.DeleteSession(db, cookieINT)
-			if err != nil {
+			if err := database.DeleteSessionByToken(db, sessionCookie.Value); err != nil {
 				fmt.Println(" Error deleting session:", err)
 				e.ErrorHandler(w, r, 500)
+				return
 			}
+			// Drop any WebSocket connections opened with this session
+			chatHub.CloseSession(sessionCookie.Value)
 		}
 
 		response := map[string]string{"message": "Logged out successfully"}
@@ -1083,9 +942,69 @@ func ConnectWeb(db *sql.DB) {
 		json.NewEncoder(w).Encode(response)
 	}))
 
+	// Active sessions (devices) of the logged in user
+	http.HandleFunc("/sessions", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.GetSessions(db, w, r)
+	}))
+
+	http.HandleFunc("/sessions/revoke", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.RevokeSession(db, chatHub, w, r)
+	}))
+
+	http.HandleFunc("/sessions/revoke-others", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.RevokeOtherSessions(db, chatHub, w, r)
+	}))
+
+	// Deleting the logged in user's account, after a grace period
+	http.HandleFunc("/account/delete", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.DeleteAccount(db, chatHub, mailer, throttle, w, r)
+	}))
+
+	// Personal data export: POST starts one, GET returns the latest
+	http.HandleFunc("/account/export", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			export.RequestExport(db, chatHub, mailer, w, r)
+			return
+		}
+		export.GetExport(db, w, r)
+	}))
+
+	http.HandleFunc("/account/export/download", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		export.DownloadExport(db, w, r)
+	}))
+
+	// Personal access tokens: GET lists them, POST creates one
+	http.HandleFunc("/tokens", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			u.CreateAccessToken(db, w, r)
+			return
+		}
+		u.GetAccessTokens(db, w, r)
+	}))
+
+	http.HandleFunc("/tokens/revoke", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.RevokeAccessToken(db, chatHub, w, r)
+	}))
+
+	// Lockouts of the logged in user's account after repeated failed logins
+	http.HandleFunc("/security/lockouts", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		u.GetLoginLockouts(db, w, r)
+	}))
+
 	// WebSocket endpoint (chatHub already initialized at the top of ConnectWeb)
 	http.HandleFunc("/ws", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
-		chat.ServeWs(chatHub, w, r)
+		// The user is resolved from the session cookie or access token; any user_id query param is ignored
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		sessionKey, ok := u.SessionKey(db, r)
+		if !ok {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		chat.ServeWs(chatHub, w, r, userID, sessionKey)
 	}))
 
 	http.HandleFunc("/messages", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -1096,37 +1015,110 @@ func ConnectWeb(db *sql.DB) {
 		}
 
 		withIDStr := r.URL.Query().Get("with")
-		offsetStr := r.URL.Query().Get("offset")
 		withID, err := strconv.Atoi(withIDStr)
 		if err != nil || withID <= 0 {
 			e.ErrorHandler(w, r, 404)
 			return
 		}
-		offset, _ := strconv.Atoi(offsetStr)
+		page, err := pagination.Parse(r, 10, pagination.NewestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
 
-		query := `SELECT sender_id, receiver_id, content, created_at FROM messages
-	          WHERE (sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)
-	          ORDER BY created_at DESC LIMIT 10 OFFSET ?`
-		rows, err := db.Query(query, userID, withID, withID, userID, offset)
+		keyset, keysetArgs := page.WhereID("id")
+		query := `SELECT id, sender_id, receiver_id, content, created_at, read_at, edited_at, deleted_at FROM messages
+	          WHERE ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND ` + keyset + `
+	          ORDER BY ` + page.OrderBy("", "id") + ` LIMIT ?`
+		args := append([]interface{}{userID, withID, withID, userID}, keysetArgs...)
+		rows, err := db.Query(query, append(args, page.FetchLimit())...)
 		if err != nil {
 			e.ErrorHandler(w, r, 500)
 			return
 		}
 		defer rows.Close()
 
-		var messages []chat.Frontend
+		messages := []chat.PrivateMessage{}
+		var cursors []pagination.Cursor
 		for rows.Next() {
-			var m chat.Frontend
-			if err := rows.Scan(&m.From, &m.To, &m.Content, &m.Timestamp); err == nil {
+			var m chat.PrivateMessage
+			var readAt, editedAt, deletedAt sql.NullTime
+			if err := rows.Scan(&m.MessageID, &m.From, &m.To, &m.Content, &m.Timestamp, &readAt, &editedAt, &deletedAt); err == nil {
+				if readAt.Valid {
+					m.ReadAt = &readAt.Time
+				}
+				if editedAt.Valid {
+					m.EditedAt = &editedAt.Time
+				}
+				m.Deleted = deletedAt.Valid
 				messages = append(messages, m)
+				cursors = append(cursors, pagination.Cursor{CreatedAt: m.Timestamp, ID: m.MessageID})
 			}
 		}
+		messages, nextCursor := pagination.Result(page, messages, cursors)
 
 		w.Header().Set("Content-Type", "application/json")
-		if messages == nil {
-			messages = []chat.Frontend{}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages":    messages,
+			"next_cursor": nextCursor,
+		})
+	}))
+
+	// Inbox: one entry per private conversation with a preview and unread count.
+	// GET /conversations?limit=20&cursor=<next_cursor from the previous page>
+	http.HandleFunc("/conversations", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 20
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		if limit > 100 {
+			limit = 100
+		}
+		cursor := 0
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			var err error
+			cursor, err = strconv.Atoi(c)
+			if err != nil || cursor < 0 {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
 		}
-		json.NewEncoder(w).Encode(messages)
+
+		// Fetch one extra row to know whether another page exists
+		conversations, err := database.GetConversations(db, userID, cursor, limit+1)
+		if err != nil {
+			fmt.Println("Error fetching conversations:", err)
+			http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+			return
+		}
+		var nextCursor interface{}
+		if len(conversations) > limit {
+			conversations = conversations[:limit]
+			nextCursor = strconv.Itoa(conversations[limit-1]["last_message_id"].(int))
+		}
+
+		totalUnread, err := database.CountUnreadMessages(db, userID)
+		if err != nil {
+			fmt.Println("Error counting unread messages:", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":       true,
+			"conversations": conversations,
+			"total_unread":  totalUnread,
+			"next_cursor":   nextCursor,
+		})
 	}))
 
 	http.HandleFunc("/get-users", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -1219,7 +1211,6 @@ func ConnectWeb(db *sql.DB) {
 		}
 
 		groupIDStr := r.URL.Query().Get("group_id")
-		offsetStr := r.URL.Query().Get("offset")
 		if groupIDStr == "" {
 			http.Error(w, "Missing group_id", http.StatusBadRequest)
 			return
@@ -1229,51 +1220,113 @@ func ConnectWeb(db *sql.DB) {
 			http.Error(w, "Invalid group_id", http.StatusBadRequest)
 			return
 		}
-		offset, _ := strconv.Atoi(offsetStr)
+		page, err := pagination.Parse(r, 30, pagination.NewestFirst)
+		if err != nil {
+			pagination.WriteError(w, err)
+			return
+		}
 
-		// Optional: ensure the requester is a member of the group
-		var count int
-		err = db.QueryRow(`
-		SELECT COUNT(*) FROM group_members
-		WHERE group_id = ? AND user_id = ? AND status = 'accepted'
-	`, groupID, userID).Scan(&count)
-		if err != nil || count == 0 {
+		// Only members can read the group chat
+		canSee, err := authz.CanSeeGroup(db, userID, groupID)
+		if err != nil || !canSee {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		const q = `
-		SELECT gm.sender_id, u.username, gm.content, gm.created_at
+		keyset, keysetArgs := page.WhereID("gm.id")
+		q := `
+		SELECT gm.id, gm.sender_id, u.username, gm.content, gm.created_at, gm.edited_at, gm.deleted_at
 		FROM group_messages gm
 		JOIN users u ON gm.sender_id = u.id
-		WHERE gm.group_id = ?
-		ORDER BY gm.created_at DESC
-		LIMIT 30 OFFSET ?
+		WHERE gm.group_id = ? AND ` + keyset + `
+		ORDER BY ` + page.OrderBy("", "gm.id") + `
+		LIMIT ?
 	`
-		rows, err := db.Query(q, groupID, offset)
+		args := append([]interface{}{groupID}, keysetArgs...)
+		rows, err := db.Query(q, append(args, page.FetchLimit())...)
 		if err != nil {
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		var messages []chat.Frontend
+		messages := []chat.GroupMessage{}
+		var cursors []pagination.Cursor
 		for rows.Next() {
-			var m chat.Frontend
-			m.Type = "group_message"
+			var m chat.GroupMessage
 			m.GroupID = groupID
-			if err := rows.Scan(&m.From, &m.Username, &m.Content, &m.Timestamp); err == nil {
+			var editedAt, deletedAt sql.NullTime
+			if err := rows.Scan(&m.MessageID, &m.From, &m.Username, &m.Content, &m.Timestamp, &editedAt, &deletedAt); err == nil {
+				if editedAt.Valid {
+					m.EditedAt = &editedAt.Time
+				}
+				m.Deleted = deletedAt.Valid
 				messages = append(messages, m)
+				cursors = append(cursors, pagination.Cursor{CreatedAt: m.Timestamp, ID: m.MessageID})
 			}
 		}
-		if messages == nil {
-			messages = []chat.Frontend{}
-		}
+		messages, nextCursor := pagination.Result(page, messages, cursors)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(messages)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages":    messages,
+			"next_cursor": nextCursor,
+		})
+	}))
+
+	// Stored notifications (bell badge survives reloads and is shared across devices)
+	http.HandleFunc("/notifications", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		notification.GetNotifications(db, userID, w, r)
+	}))
+
+	http.HandleFunc("/notifications/unread-count", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		notification.GetUnreadCount(db, userID, w, r)
 	}))
 
+	http.HandleFunc("/notifications/read", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		notification.MarkNotificationRead(db, chatHub, userID, w, r)
+	}))
+
+	http.HandleFunc("/notifications/read-all", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		notification.MarkAllNotificationsRead(db, chatHub, userID, w, r)
+	}))
+
+	http.HandleFunc("/notifications/delete", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			http.Error(w, "Unauthorized. Please log in.", http.StatusUnauthorized)
+			return
+		}
+		notification.DeleteNotification(db, chatHub, userID, w, r)
+	}))
+
+	// Edit or soft delete your own private/group chat messages
+	session := func(r *http.Request) (int, bool) { return u.ValidateSession(db, r) }
+	http.HandleFunc("/messages/edit", cor.WithCORS(chatHub.MessageUpdateHandler(session, false, false)))
+	http.HandleFunc("/messages/delete", cor.WithCORS(chatHub.MessageUpdateHandler(session, false, true)))
+	http.HandleFunc("/group-messages/edit", cor.WithCORS(chatHub.MessageUpdateHandler(session, true, false)))
+	http.HandleFunc("/group-messages/delete", cor.WithCORS(chatHub.MessageUpdateHandler(session, true, true)))
+
 	http.HandleFunc("/error/", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		num, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/error/"))
 		if r.Method == http.MethodGet {
@@ -1289,7 +1342,7 @@ func ConnectWeb(db *sql.DB) {
 	}))
 
 	fmt.Println("Listening on: http://localhost:8080/")
-	if err := http.ListenAndServe("0.0.0.0:8080", nil); err != nil {
+	if err := http.ListenAndServe("0.0.0.0:8080", requireSameOrigin(requireTokenScope(db, requireVerified(db, policy, http.DefaultServeMux)))); err != nil {
 		fmt.Println("Error starting server:", err)
 	}
 }
@@ -1336,33 +1389,8 @@ func getTableNames(db *sql.DB) ([]string, error) {
 	return tables, nil
 }
 
-func ensureEventPollTables(db *sql.DB, hub *chat.Hub) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS events (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			group_id   INTEGER NOT NULL,
-			creator_id INTEGER NOT NULL,
-			title       TEXT NOT NULL,
-			description TEXT NOT NULL,
-			event_date  DATETIME,
-			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE IF NOT EXISTS event_votes (
-            event_id INTEGER NOT NULL,
-            user_id  INTEGER NOT NULL,
-            choice   TEXT NOT NULL CHECK (choice IN ('yes','no')),
-            UNIQUE(event_id, user_id)
-        );`,
-	}
-	for _, s := range stmts {
-		if _, err := db.Exec(s); err != nil {
-			return err
-		}
-	}
-
-	// Try to add event_date column if the table already existed without it. Ignore error if it already exists.
-	_, _ = db.Exec(`ALTER TABLE events ADD COLUMN event_date DATETIME`)
-
+// registerProfileRoutes adds the profile and follow endpoints
+func registerProfileRoutes(db *sql.DB, hub *chat.Hub, mailer mail.Mailer) {
 	// Add comprehensive profile and follow endpoints
 	http.HandleFunc("/profile/complete", cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
 		u.GetCompleteProfileHandler(db, w, r)
@@ -1408,10 +1436,8 @@ func ensureEventPollTables(db *sql.DB, hub *chat.Hub) error {
 			return
 		}
 
-		u.UpdateProfileHandler(db, w, r, username)
+		u.UpdateProfileHandler(db, hub, mailer, w, r, username)
 	}))
 
 	// JSON version of update profile (simpler and more reliable)
-
-	return nil
 }
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"socialnetwork/pkg/apis/authz"
+	u "socialnetwork/pkg/apis/user"
+)
+
+// followAPI serves POST and DELETE /api/follow?targetId=N, which follow and
+// unfollow a user right away.
+func followAPI(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := u.ValidateSession(db, r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		targetID, err := strconv.Atoi(r.URL.Query().Get("targetId"))
+		if err != nil || targetID <= 0 {
+			http.Error(w, "Invalid targetId", http.StatusBadRequest)
+			return
+		}
+		setFollow(db, w, r, userID, targetID)
+	}
+}
+
+// setFollow makes userID follow (POST) or unfollow (DELETE) targetID
+// directly. Private profiles can only be followed through a follow request
+// (/follow-user), since following one grants access to it.
+func setFollow(db *sql.DB, w http.ResponseWriter, r *http.Request, userID, targetID int) {
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var allowed bool
+		allowed, err = authz.CanFollowDirectly(db, userID, targetID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "This profile is private; send a follow request", http.StatusForbidden)
+			return
+		}
+		_, err = db.Exec(
+			`INSERT OR IGNORE INTO userFollow(follower_id, following_id) VALUES (?, ?)`,
+			userID, targetID,
+		)
+	case http.MethodDelete:
+		_, err = db.Exec(
+			`DELETE FROM userFollow WHERE follower_id = ? AND following_id = ?`,
+			userID, targetID,
+		)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
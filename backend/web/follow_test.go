@@ -0,0 +1,73 @@
+package web
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"socialnetwork/pkg/db/sqlite"
+)
+
+// newTestDB returns a migrated database where user 1 has a private profile
+// and user 2 a public one, and user 3 is logged in with the session "s3".
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	migrations, err := filepath.Abs("../pkg/db/migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlite.ConnectAndMigrate(filepath.Join(t.TempDir(), "test.db"), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		INSERT INTO users (id, username, firstname, lastname, age, gender, email, password, isPrivate) VALUES
+			(1, 'private', 'F', 'L', '20', 'other', 'p@example.com', 'x', 1),
+			(2, 'public', 'F', 'L', '20', 'other', 'q@example.com', 'x', 0),
+			(3, 'viewer', 'F', 'L', '20', 'other', 'v@example.com', 'x', 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO sessions (user_id, token, expires_at) VALUES (3, 's3', ?)`, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFollowAPIRefusesPrivateProfiles(t *testing.T) {
+	db := newTestDB(t)
+	handler := followAPI(db)
+
+	for _, tc := range []struct {
+		target string
+		code   int
+		follow bool
+	}{
+		{"1", http.StatusForbidden, false},
+		{"2", http.StatusOK, true},
+		{"9", http.StatusNotFound, false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/follow?targetId="+tc.target, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: "s3"})
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("following %s: status %d, want %d", tc.target, rec.Code, tc.code)
+		}
+
+		var follows bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM userFollow WHERE follower_id = 3 AND following_id = ?)`, tc.target).Scan(&follows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if follows != tc.follow {
+			t.Errorf("following %s: follows = %v, want %v", tc.target, follows, tc.follow)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	cor "socialnetwork/pkg/apis"
+	u "socialnetwork/pkg/apis/user"
+)
+
+// requireTokenScope wraps the router and answers requests made with an
+// "Authorization: Bearer" access token that cannot go through: 401 when the
+// token is unknown or expired, 403 when the endpoint does not take tokens or
+// the token lacks its scope. Handlers check the same through ValidateSession;
+// this only gives scripts a clear error instead of a generic 401.
+func requireTokenScope(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || !u.HasBearerToken(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, allowed := u.TokenScope(r)
+		if !allowed {
+			refuseToken(w, r, http.StatusForbidden, "token_not_allowed", "Access tokens cannot be used here.")
+			return
+		}
+		t, err := u.AuthenticateToken(db, r)
+		if err == sql.ErrNoRows {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			refuseToken(w, r, http.StatusUnauthorized, "invalid_token", "The access token is invalid or has expired.")
+			return
+		}
+		if err != nil {
+			fmt.Println("Error checking access token:", err)
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			return
+		}
+		if scope != "" && !t.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			refuseToken(w, r, http.StatusForbidden, "insufficient_scope", "This access token needs the "+scope+" scope.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func refuseToken(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   code,
+			"message": message,
+		})
+	})(w, r)
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	cor "socialnetwork/pkg/apis"
+	u "socialnetwork/pkg/apis/user"
+)
+
+// unverifiedAllowed are the endpoints an unverified user may still call with
+// a mutating method: the ones needed to get verified, recover, log out,
+// secure the account or delete it.
+var unverifiedAllowed = map[string]bool{
+	"/login":                  true,
+	"/login/2fa":              true,
+	"/signup":                 true,
+	"/logout":                 true,
+	"/verify-email":           true,
+	"/resend-verification":    true,
+	"/forgot-password":        true,
+	"/reset-password":         true,
+	"/sessions/revoke":        true,
+	"/sessions/revoke-others": true,
+	"/2fa/enroll":             true,
+	"/2fa/confirm":            true,
+	"/2fa/disable":            true,
+	"/2fa/recovery-codes":     true,
+	"/account/delete":         true,
+	"/account/export":         true,
+}
+
+// requireVerified wraps the router and enforces the unverified policy on
+// HTTP: requests other than GET, HEAD and OPTIONS from a logged in user who
+// may not write are refused with 403.
+func requireVerified(db *sql.DB, policy u.UnverifiedPolicy, next http.Handler) http.Handler {
+	if policy == u.UnverifiedAllow {
+		return next
+	}
+	refuse := cor.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "email_unverified",
+			"message": "Please verify your email address first.",
+		})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if unverifiedAllowed[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, loggedIn := u.ValidateSession(db, r)
+		if !loggedIn {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, err := policy.CanWrite(db, userID)
+		if err != nil {
+			fmt.Println("Error checking email verification:", err)
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			refuse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
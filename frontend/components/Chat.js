@@ -1,6 +1,6 @@
 import { useState, useRef, useEffect } from 'react';
 import dynamic from 'next/dynamic';
-import { useWebSocketContext } from '../contexts/WebSocketContext';
+import { useWebSocketContext, newClientID, mergeChatMessage, acknowledgeChatMessage, compareChatMessages } from '../contexts/WebSocketContext';
 import Toast from './Toast';
 
 const Chat = ({ isOpen, onClose, chatWith, userID }) => {
@@ -8,7 +8,11 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
   const [chatMessages, setChatMessages] = useState([]);
   const [errorMessage, setErrorMessage] = useState('');
   const [isLoadingHistory, setIsLoadingHistory] = useState(false);
+  // Bumped when the connection resyncs, to reload the history
+  const [resyncCount, setResyncCount] = useState(0);
   const { sendMessage, subscribe, connected } = useWebSocketContext();
+  // Frames sent but not yet acked or nacked, by client_id, resent after a reconnect
+  const pendingRef = useRef(new Map());
   const chatWindowRef = useRef(null);
   const inputRef = useRef(null);
   const [showEmojiPicker, setShowEmojiPicker] = useState(false);
@@ -38,11 +42,12 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
         if (response.ok) {
           const data = await response.json();
           const messages = data.messages || [];
-          // Sort by timestamp (oldest first)
-          const sortedMessages = messages.sort((a, b) => 
-            new Date(a.timestamp) - new Date(b.timestamp)
-          );
-          setChatMessages(sortedMessages);
+          // Keep the messages still being sent after the stored ones
+          setChatMessages(prev => prev
+            .filter(m => m.pending && m.to === chatWith.id && pendingRef.current.has(m.client_id))
+            .reduce(mergeChatMessage, [...messages].sort(compareChatMessages)));
+          // Opening the chat marks the conversation as read
+          sendMessage({ type: 'mark_read', to: chatWith.id });
         } else if (response.status === 403) {
           setErrorMessage('You can only chat with users you follow or who follow you');
         } else {
@@ -56,13 +61,33 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
     };
 
     fetchChatHistory();
-  }, [chatWith, isOpen]);
+  }, [chatWith, isOpen, sendMessage, resyncCount]);
 
   // Filter and listen for messages for this specific chat
   useEffect(() => {
     if (!chatWith || !userID || !isOpen) return;
 
     const unsubscribe = subscribe((message) => {
+      // Messages were missed while disconnected
+      if (message.type === 'resync') {
+        setResyncCount(n => n + 1);
+        return;
+      }
+
+      // The server stored one of our messages, or refused it
+      if (message.type === 'ack' || message.type === 'nack') {
+        if (!pendingRef.current.has(message.client_id)) return;
+        pendingRef.current.delete(message.client_id);
+        if (message.type === 'ack') {
+          setChatMessages(prev => acknowledgeChatMessage(prev, message.client_id, message.message_id));
+        } else {
+          setChatMessages(prev => prev.filter(m => !(m.pending && m.client_id === message.client_id)));
+          setErrorMessage(message.reason);
+          setTimeout(() => setErrorMessage(''), 5000);
+        }
+        return;
+      }
+
       // Handle error messages
       if (message.type === 'error') {
         setErrorMessage(message.content);
@@ -77,25 +102,25 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
           (message.from === userID && message.to === chatWith.id) || 
           (message.from === chatWith.id && message.to === userID)
         ) {
-          setChatMessages(prev => {
-            // Avoid duplicates based on timestamp, content, and sender
-            const isDuplicate = prev.some(msg => 
-              msg.content === message.content &&
-              msg.from === message.from &&
-              Math.abs(new Date(msg.timestamp) - new Date(message.timestamp)) < 3000
-            );
-            if (isDuplicate) return prev;
-            
-            // Add new message and sort by timestamp
-            const updated = [...prev, message];
-            return updated.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
-          });
+          // The chat is open, so an incoming message is read right away
+          if (message.from === chatWith.id) {
+            sendMessage({ type: 'mark_read', to: chatWith.id });
+          }
+          // Replaces our own copy of the message if we sent it
+          setChatMessages(prev => mergeChatMessage(prev, { ...message, pending: false }));
         }
       }
     });
 
     return () => unsubscribe();
-  }, [chatWith, userID, isOpen, subscribe]);
+  }, [chatWith, userID, isOpen, subscribe, sendMessage]);
+
+  // A send may have been lost with the connection: send it again, the server
+  // stores it only once
+  useEffect(() => {
+    if (!connected) return;
+    pendingRef.current.forEach(frame => sendMessage(frame));
+  }, [connected, sendMessage]);
 
   // Auto scroll to bottom when new messages arrive
   useEffect(() => {
@@ -142,23 +167,25 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
     
     if (!messageInput.trim() || !chatWith || !connected) return;
 
-    const messageData = {
+    const frame = {
       type: 'private_message',
-      from: userID,
       to: chatWith.id,
       content: messageInput,
-      timestamp: new Date().toISOString()
+      client_id: newClientID()
     };
 
     // Try to send via WebSocket/transport
-    const success = sendMessage(messageData);
+    const success = sendMessage(frame);
 
     if (success) {
+      pendingRef.current.set(frame.client_id, frame);
       // Optimistically append message so emoji and text appear immediately
-      setChatMessages(prev => {
-        const updated = [...prev, messageData];
-        return updated.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
-      });
+      setChatMessages(prev => mergeChatMessage(prev, {
+        ...frame,
+        from: userID,
+        timestamp: new Date().toISOString(),
+        pending: true
+      }));
       setMessageInput('');
     } else {
       showToast('Failed to send message. Please check your connection.', 'error');
@@ -251,13 +278,13 @@ const Chat = ({ isOpen, onClose, chatWith, userID }) => {
           chatMessages.map((msg, index) => {
             const isMyMessage = msg.from === userID;
             return (
-              <div key={`${msg.timestamp}-${index}`} className={`group-chat-message-modern ${isMyMessage ? 'my-message' : 'other-message'}`}>
+              <div key={msg.message_id || msg.client_id || `${msg.timestamp}-${index}`} className={`group-chat-message-modern ${isMyMessage ? 'my-message' : 'other-message'}`}>
                 {!isMyMessage && (
                   <div className="message-username">{msg.username || chatWith?.username || `User ${msg.from}`}</div>
                 )}
                 <div className="message-bubble-modern">
                   <div className="message-content">{msg.content || msg.message}</div>
-                  <div className="message-time">{formatTime(msg.timestamp)}</div>
+                  <div className="message-time">{msg.pending ? 'Sending…' : formatTime(msg.timestamp)}</div>
                 </div>
               </div>
             );
@@ -1,4 +1,5 @@
 import { useState, useEffect, useRef } from 'react';
+import { useWebSocketContext, newClientID, mergeChatMessage, acknowledgeChatMessage, compareChatMessages } from '../contexts/WebSocketContext';
 
 export default function GroupChat({ groupId, user, isOpen, onClose, connected, messages, sendMessage }) {
   const [messageInput, setMessageInput] = useState('');
@@ -8,6 +9,10 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
   const inputRef = useRef(null);
   const [showEmojiPicker, setShowEmojiPicker] = useState(false);
   const [EmojiPicker, setEmojiPicker] = useState(null);
+  const [errorMessage, setErrorMessage] = useState('');
+  const { subscribe } = useWebSocketContext();
+  // Frames sent but not yet acked or nacked, by client_id, resent after a reconnect
+  const pendingRef = useRef(new Map());
 
   const userId = user?.id || user?.userID || user?.user_id;
 
@@ -35,12 +40,10 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
             timestamp: msg.created_at || msg.timestamp
           }));
           console.log('Mapped existing messages:', existingMessages);
-          // Sort by timestamp (oldest first) for consistent chat order
-          const sortedMessages = existingMessages.sort((a, b) => 
-            new Date(a.timestamp) - new Date(b.timestamp)
-          );
-          console.log('Setting sorted messages:', sortedMessages);
-          setGroupMessages(sortedMessages);
+          // Stored messages in order, then those still being sent
+          setGroupMessages(prev => prev
+            .filter(m => m.pending && m.group_id === parseInt(groupId) && pendingRef.current.has(m.client_id))
+            .reduce(mergeChatMessage, existingMessages.sort(compareChatMessages)));
         })
         .catch(error => {
           console.error('Error loading messages:', error);
@@ -55,31 +58,37 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
       );
       
       if (newMessages.length > 0) {
-        setGroupMessages(prev => {
-          // Merge and dedupe by from+content and timestamp proximity (3s window)
-          const combined = [...prev, ...newMessages];
-          const unique = [];
-          for (const m of combined) {
-            try {
-              const isSeen = unique.some(u => {
-                if (!u) return false;
-                if ((u.from || u.From) !== (m.from || m.From)) return false;
-                if ((u.content || u.Content) !== (m.content || m.Content)) return false;
-                const t1 = new Date(u.timestamp || u.Timestamp || Date.now()).getTime();
-                const t2 = new Date(m.timestamp || m.Timestamp || Date.now()).getTime();
-                return Math.abs(t1 - t2) < 3000; // within 3 seconds => duplicate
-              });
-              if (!isSeen) unique.push(m);
-            } catch (err) {
-              unique.push(m);
-            }
-          }
-          return unique.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
-        });
+        // Our own messages replace the copies we added when sending them
+        setGroupMessages(prev => newMessages.reduce(
+          (list, m) => mergeChatMessage(list, { ...m, pending: false }), prev
+        ));
       }
     }
   }, [messages, groupId]);
 
+  // The server stored one of our messages, or refused it
+  useEffect(() => {
+    return subscribe((message) => {
+      if (message.type !== 'ack' && message.type !== 'nack') return;
+      if (!pendingRef.current.has(message.client_id)) return;
+      pendingRef.current.delete(message.client_id);
+      if (message.type === 'ack') {
+        setGroupMessages(prev => acknowledgeChatMessage(prev, message.client_id, message.message_id));
+      } else {
+        setGroupMessages(prev => prev.filter(m => !(m.pending && m.client_id === message.client_id)));
+        setErrorMessage(message.reason);
+        setTimeout(() => setErrorMessage(''), 5000);
+      }
+    });
+  }, [subscribe]);
+
+  // A send may have been lost with the connection: send it again, the server
+  // stores it only once
+  useEffect(() => {
+    if (!connected) return;
+    pendingRef.current.forEach(frame => sendMessage(frame));
+  }, [connected, sendMessage]);
+
   useEffect(() => {
     if (chatWindowRef.current) {
       chatWindowRef.current.scrollTop = chatWindowRef.current.scrollHeight;
@@ -120,21 +129,23 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
     e.preventDefault();
     if (!messageInput.trim() || !connected) return;
     
-    const messageData = {
+    const frame = {
       type: 'group_message',
       group_id: parseInt(groupId),
-      from: userId,
-      username: user?.username || `User ${userId}`,
       content: messageInput.trim(),
-      timestamp: new Date().toISOString()
+      client_id: newClientID()
     };
     
-    if (sendMessage(messageData)) {
+    if (sendMessage(frame)) {
+      pendingRef.current.set(frame.client_id, frame);
       // optimistic append so emoji appears immediately
-      setGroupMessages(prev => {
-        const updated = [...prev, messageData];
-        return updated.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
-      });
+      setGroupMessages(prev => mergeChatMessage(prev, {
+        ...frame,
+        from: userId,
+        username: user?.username || `User ${userId}`,
+        timestamp: new Date().toISOString(),
+        pending: true
+      }));
       setMessageInput('');
     }
   };
@@ -188,6 +199,20 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
         </button>
       </div>
       
+      {/* Error Message */}
+      {errorMessage && (
+        <div style={{ 
+          backgroundColor: '#fee', 
+          border: '1px solid #fcc', 
+          color: '#c00', 
+          padding: '12px 16px', 
+          fontSize: '14px',
+          borderRadius: '0'
+        }}>
+          Warning: {errorMessage}
+        </div>
+      )}
+
       {/* Modern Chat Messages */}
       <div 
         ref={chatWindowRef} 
@@ -212,7 +237,7 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
               
               return (
                 <div 
-                  key={index} 
+                  key={msg.message_id || msg.client_id || index} 
                   className={`group-chat-message-modern ${isMyMessage ? 'my-message' : 'other-message'}`}
                 >
                   {showUsername && !isMyMessage && (
@@ -221,7 +246,7 @@ export default function GroupChat({ groupId, user, isOpen, onClose, connected, m
                   <div className="message-bubble-modern">
                     <div className="message-content">{msg.content}</div>
                     <div className="message-time">
-                      {new Date(msg.timestamp).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}
+                      {msg.pending ? 'Sending…' : new Date(msg.timestamp).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}
                     </div>
                   </div>
                 </div>
@@ -9,12 +9,10 @@ export default function GroupEvents({ groupId, user }) {
   const [events, setEvents] = useState([]);
   const [loadingEvents, setLoadingEvents] = useState(true);
   const [showCreateEvent, setShowCreateEvent] = useState(false);
-  const [newEvent, setNewEvent] = useState({ 
-    title: '', 
-    description: '', 
-    date: '',
-    time: ''
-  });
+  const emptyEvent = { title: '', description: '', date: '', time: '', endTime: '', location: '', capacity: '' };
+  const [newEvent, setNewEvent] = useState(emptyEvent);
+  const [attendees, setAttendees] = useState({});
+  const userId = user?.id || user?.userID || user?.user_id;
   const { subscribe } = useWebSocketContext();
   const [toast, setToast] = useState({ visible: false, message: '', type: 'info' });
 
@@ -38,34 +36,21 @@ export default function GroupEvents({ groupId, user }) {
       console.log('[GroupEvents] Received WebSocket message:', message);
       if (message.group_id == groupId) {
         if (message.type === 'new_groupEvent') {
-          // Add new event to state instantly using info from message
-          setEvents(prev => {
-            if (prev.some(ev => ev.id === message.post_id)) return prev;
-            return [
-              {
-                id: message.post_id,
-                title: message.content.split(':')[0]?.trim() || '',
-                description: message.content.split(':').slice(1).join(':').trim() || '',
-                created_at: message.timestamp,
-                event_date: message.event_date || message.EventDate || null,
-                yes_count: message.yes_count,
-                no_count: message.no_count,
-                user_vote: message.user_vote || null
-              },
-              ...prev
-            ];
-          });
-        } else if (message.type === 'group_event_vote_update') {
-          // Use info from WebSocket message to update event in state
+          fetchGroupEvents();
+        } else if (['group_event_rsvp_update', 'group_event_updated', 'group_event_cancelled'].includes(message.type)) {
+          // event is the event without the viewer's own RSVP
+          const updated = message.event;
+          if (!updated) return;
+          setEvents(prev => prev.map(ev => {
+            if (ev.id !== updated.id) return ev;
+            const mine = message.from === userId
+              ? { user_rsvp: message.user_vote || ev.user_rsvp }
+              : { user_rsvp: ev.user_rsvp, waitlist_position: ev.waitlist_position };
+            return { ...ev, ...updated, ...mine };
+          }));
+        } else if (message.type === 'event_waitlist_promoted') {
           setEvents(prev => prev.map(ev =>
-            ev.id === message.post_id
-              ? {
-                  ...ev,
-                  yes_count: message.yes_count,
-                  no_count: message.no_count,
-                  user_vote: message.user_vote
-                }
-              : ev
+            ev.id === message.event_id ? { ...ev, user_rsvp: 'going', waitlist_position: 0 } : ev
           ));
         }
       }
@@ -107,7 +92,7 @@ export default function GroupEvents({ groupId, user }) {
   const handleCreateEvent = async (e) => {
     e.preventDefault();
     if (!newEvent.title.trim() || !newEvent.description.trim() || !newEvent.date || !newEvent.time) {
-      showToast('Please fill in all fields', 'error');
+      showToast('Please fill in all required fields', 'error');
       return;
     }
     
@@ -118,6 +103,7 @@ export default function GroupEvents({ groupId, user }) {
         return;
       }
 
+      const capacity = parseInt(newEvent.capacity, 10);
       const response = await fetch(`${BACKEND_URL}/create-event`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
@@ -125,14 +111,19 @@ export default function GroupEvents({ groupId, user }) {
           group_id: parseInt(groupId),
           title: newEvent.title.trim(),
           description: newEvent.description.trim(),
-          event_date: datetime.toISOString()
+          // Local wall-clock times, interpreted by the server in this time zone
+          starts_at: `${newEvent.date}T${newEvent.time}`,
+          ends_at: newEvent.endTime ? `${newEvent.date}T${newEvent.endTime}` : '',
+          timezone: Intl.DateTimeFormat().resolvedOptions().timeZone || 'UTC',
+          location: newEvent.location.trim(),
+          capacity: capacity > 0 ? capacity : null
         }),
         credentials: 'include'
       });
       
       if (response.ok) {
         setShowCreateEvent(false);
-        setNewEvent({ title: '', description: '', date: '', time: '' });
+        setNewEvent(emptyEvent);
         fetchGroupEvents(); // Refresh events
       } else {
         const errorText = await response.text();
@@ -144,21 +135,100 @@ export default function GroupEvents({ groupId, user }) {
     }
   };
 
-  const handleVote = async (eventId, choice) => {
+  const handleRSVP = async (eventId, status) => {
     try {
-      const response = await fetch(`${BACKEND_URL}/groups/events/vote?event_id=${eventId}&choice=${choice}`, {
+      const response = await fetch(`${BACKEND_URL}/groups/${groupId}/events/${eventId}/rsvp`, {
         method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ status }),
+        credentials: 'include'
+      });
+      if (!response.ok) {
+        const errorText = await response.text();
+        showToast(errorText || 'Failed to update RSVP', 'error');
+        return;
+      }
+      const data = await response.json();
+      if (data.status === 'waitlisted') {
+        showToast('The event is full, you have been added to the waitlist', 'info');
+      }
+      // Counts for everyone arrive over the WebSocket; our own RSVP comes back here
+      setEvents(prev => prev.map(ev => ev.id === eventId ? data.event : ev));
+    } catch (error) {
+      console.error('Error updating RSVP:', error);
+    }
+  };
+
+  const handleCancelEvent = async (eventId) => {
+    if (!window.confirm('Cancel this event for everyone?')) return;
+    try {
+      const response = await fetch(`${BACKEND_URL}/groups/${groupId}/events/${eventId}/cancel`, {
+        method: 'POST',
+        credentials: 'include'
+      });
+      if (!response.ok) {
+        const errorText = await response.text();
+        showToast(errorText || 'Failed to cancel event', 'error');
+      }
+    } catch (error) {
+      console.error('Error cancelling event:', error);
+    }
+  };
+
+  const toggleAttendees = async (eventId) => {
+    if (attendees[eventId]) {
+      setAttendees(prev => ({ ...prev, [eventId]: null }));
+      return;
+    }
+    try {
+      const response = await fetch(`${BACKEND_URL}/groups/${groupId}/events/${eventId}/attendees`, {
+        credentials: 'include'
+      });
+      if (response.ok) {
+        const data = await response.json();
+        setAttendees(prev => ({ ...prev, [eventId]: data }));
+      }
+    } catch (error) {
+      console.error('Error fetching attendees:', error);
+    }
+  };
+
+  const handleSubscribe = async () => {
+    try {
+      const response = await fetch(`${BACKEND_URL}/calendar/feed`, {
         credentials: 'include'
       });
-      // No reload! WebSocket will update the UI
       if (!response.ok) {
-        console.error('Failed to vote on event');
+        showToast('Failed to get calendar feed', 'error');
+        return;
       }
+      const data = await response.json();
+      window.prompt('Add this URL to your calendar app. Anyone with it can see your group events.', data.feed_url);
     } catch (error) {
-      console.error('Error voting on event:', error);
+      console.error('Error getting calendar feed:', error);
     }
   };
 
+  const formatEventTime = (event) => {
+    try {
+      const start = new Date(event.starts_at);
+      const opts = { month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit', timeZone: event.timezone || undefined };
+      let text = start.toLocaleString('en-US', opts);
+      if (event.ends_at) {
+        text += ' – ' + new Date(event.ends_at).toLocaleTimeString('en-US', { hour: '2-digit', minute: '2-digit', timeZone: event.timezone || undefined });
+      }
+      return `${text} (${event.timezone || 'UTC'})`;
+    } catch (e) {
+      return '—';
+    }
+  };
+
+  const rsvpOptions = [
+    { status: 'going', label: 'Going', count: 'going_count' },
+    { status: 'maybe', label: 'Maybe', count: 'maybe_count' },
+    { status: 'not_going', label: 'Not going', count: 'not_going_count' }
+  ];
+
   return (
     <div className="group-events-modern">
       {/* Modern Create Event Prompt */}
@@ -178,6 +248,14 @@ export default function GroupEvents({ groupId, user }) {
             <span className="create-event-subtitle">Create something exciting for your group!</span>
           </div>
         </button>
+        <div className="event-calendar-links">
+          <a href={`${BACKEND_URL}/groups/${groupId}/events.ics`} download>
+            Export to calendar
+          </a>
+          <button type="button" className="event-calendar-subscribe" onClick={handleSubscribe}>
+            Subscribe to all my group events
+          </button>
+        </div>
       </div>
 
       {/* Create Event Modal */}
@@ -222,7 +300,7 @@ export default function GroupEvents({ groupId, user }) {
               </div>
 
               <div className="form-group">
-                <label>Time</label>
+                <label>Start time</label>
                 <input
                   type="time"
                   value={newEvent.time}
@@ -230,6 +308,36 @@ export default function GroupEvents({ groupId, user }) {
                   required
                 />
               </div>
+
+              <div className="form-group">
+                <label>End time (optional)</label>
+                <input
+                  type="time"
+                  value={newEvent.endTime}
+                  onChange={(e) => setNewEvent({...newEvent, endTime: e.target.value})}
+                />
+              </div>
+
+              <div className="form-group">
+                <label>Location (optional)</label>
+                <input
+                  type="text"
+                  value={newEvent.location}
+                  onChange={(e) => setNewEvent({...newEvent, location: e.target.value})}
+                  placeholder="Where is it happening?"
+                />
+              </div>
+
+              <div className="form-group">
+                <label>Capacity (optional)</label>
+                <input
+                  type="number"
+                  min="1"
+                  value={newEvent.capacity}
+                  onChange={(e) => setNewEvent({...newEvent, capacity: e.target.value})}
+                  placeholder="Unlimited"
+                />
+              </div>
               
               <div className="button-group-modern">
                 <button type="button" onClick={() => setShowCreateEvent(false)} className="btn-secondary">
@@ -278,59 +386,73 @@ export default function GroupEvents({ groupId, user }) {
                     <circle cx="12" cy="12" r="10" stroke="currentColor" strokeWidth="2"/>
                     <path d="M12 6v6l4 2" stroke="currentColor" strokeWidth="2" strokeLinecap="round"/>
                   </svg>
-                  {/* Prefer scheduled event_date when available, fallback to created_at */}
-                  {(() => {
-                    const d = event.event_date || event.eventDate || event.created_at || event.createdAt;
-                    try {
-                      return <span>{new Date(d).toLocaleDateString('en-US', { month: 'short', day: 'numeric' })}</span>;
-                    } catch (e) {
-                      return <span>—</span>;
-                    }
-                  })()}
+                  <span>{formatEventTime(event)}</span>
                 </div>
               </div>
 
               {/* Event Content */}
               <div className="event-card-body">
-                <h3 className="event-card-title">{event.title}</h3>
+                <h3 className="event-card-title">
+                  {event.title}
+                  {event.cancelled && <span className="event-cancelled-badge"> (Cancelled)</span>}
+                </h3>
                 <p className="event-card-description">{event.description}</p>
+                {event.location && <p className="event-card-location">📍 {event.location}</p>}
+                {event.capacity != null && (
+                  <p className="event-card-capacity">
+                    {event.spots_left > 0 ? `${event.spots_left} of ${event.capacity} spots left` : 'Full'}
+                    {event.waitlist_count > 0 && ` · ${event.waitlist_count} on the waitlist`}
+                  </p>
+                )}
               </div>
 
-              {/* Voting Section */}
+              {/* RSVP Section */}
               <div className="event-voting-section">
                 <h4 className="event-voting-title">Will you attend?</h4>
                 
                 <div className="event-voting-buttons">
-                  <button
-                    onClick={() => handleVote(event.id, 'yes')}
-                    className={`event-vote-btn event-vote-yes ${event.user_vote === 'yes' ? 'active' : ''}`}
-                  >
-                    <svg width="18" height="18" viewBox="0 0 24 24" fill="none" xmlns="http://www.w3.org/2000/svg">
-                      <path d="M20 6L9 17l-5-5" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round"/>
-                    </svg>
-                    <span className="vote-label">Yes</span>
-                    <span className="vote-count">{event.yes_count || 0}</span>
-                  </button>
-                  
-                  <button
-                    onClick={() => handleVote(event.id, 'no')}
-                    className={`event-vote-btn event-vote-no ${event.user_vote === 'no' ? 'active' : ''}`}
-                  >
-                    <svg width="18" height="18" viewBox="0 0 24 24" fill="none" xmlns="http://www.w3.org/2000/svg">
-                      <path d="M18 6L6 18M6 6l12 12" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round"/>
-                    </svg>
-                    <span className="vote-label">No</span>
-                    <span className="vote-count">{event.no_count || 0}</span>
-                  </button>
+                  {rsvpOptions.map(opt => (
+                    <button
+                      key={opt.status}
+                      onClick={() => handleRSVP(event.id, opt.status)}
+                      disabled={event.cancelled}
+                      className={`event-vote-btn ${opt.status === 'not_going' ? 'event-vote-no' : 'event-vote-yes'} ${event.user_rsvp === opt.status ? 'active' : ''}`}
+                    >
+                      <span className="vote-label">{opt.label}</span>
+                      <span className="vote-count">{event[opt.count] || 0}</span>
+                    </button>
+                  ))}
                 </div>
                 
-                {event.user_vote && (
+                {event.user_rsvp && (
                   <div className="event-user-vote">
-                    <svg width="14" height="14" viewBox="0 0 24 24" fill="none" xmlns="http://www.w3.org/2000/svg">
-                      <path d="M22 11.08V12a10 10 0 11-5.93-9.14" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round"/>
-                      <path d="M22 4L12 14.01l-3-3" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round"/>
-                    </svg>
-                    <span>You voted: <strong>{event.user_vote === 'yes' ? 'Yes' : 'No'}</strong></span>
+                    <span>
+                      {event.user_rsvp === 'waitlisted'
+                        ? <>You are <strong>#{event.waitlist_position}</strong> on the waitlist</>
+                        : <>Your RSVP: <strong>{rsvpOptions.find(o => o.status === event.user_rsvp)?.label}</strong></>}
+                    </span>
+                  </div>
+                )}
+
+                <div className="event-card-actions">
+                  <button className="btn-secondary" onClick={() => toggleAttendees(event.id)}>
+                    {attendees[event.id] ? 'Hide attendees' : 'Show attendees'}
+                  </button>
+                  {!event.cancelled && event.creator_id === userId && (
+                    <button className="btn-secondary" onClick={() => handleCancelEvent(event.id)}>
+                      Cancel event
+                    </button>
+                  )}
+                </div>
+
+                {attendees[event.id] && (
+                  <div className="event-attendees">
+                    {[['going', 'Going'], ['maybe', 'Maybe'], ['waitlist', 'Waitlist']].map(([key, label]) => (
+                      <div key={key}>
+                        <strong>{label}:</strong>{' '}
+                        {(attendees[event.id][key] || []).map(a => a.username).join(', ') || '—'}
+                      </div>
+                    ))}
                   </div>
                 )}
               </div>
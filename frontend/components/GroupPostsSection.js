@@ -87,7 +87,7 @@ export default function GroupPostsSection({ groupId, user }) {
       if (response.ok) {
         const postsData = await response.json();
         console.log('Posts data received:', postsData);
-        setPosts(Array.isArray(postsData) ? postsData : []);
+        setPosts(Array.isArray(postsData) ? postsData : (postsData.posts || []));
       } else {
         const errorText = await response.text();
         console.error('Failed to fetch group posts:', response.status, errorText);
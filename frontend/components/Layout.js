@@ -5,10 +5,13 @@ import Link from 'next/link';
 import { useRouter } from 'next/router';
 import Notifications from './Notifications';
 
+const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL || process.env.BACKEND_URL || 'http://localhost:8080';
+
 const Layout = ({ children }) => {
   const { user, loading, logout } = useSession();
   const { onlineUsers, connected } = useWebSocketContext();
   const [showNotifications, setShowNotifications] = useState(false);
+  const [verifyNotice, setVerifyNotice] = useState('');
   const router = useRouter();
 
   const handleLogout = async () => {
@@ -18,6 +21,19 @@ const Layout = ({ children }) => {
     }
   };
 
+  const resendVerification = async () => {
+    try {
+      const response = await fetch(`${BACKEND_URL}/resend-verification`, {
+        method: 'POST',
+        credentials: 'include'
+      });
+      const data = await response.json().catch(() => ({}));
+      setVerifyNotice(data.message || 'Could not send the email. Please try again.');
+    } catch (error) {
+      setVerifyNotice('Could not send the email. Please try again.');
+    }
+  };
+
   const navigateTo = (path) => {
     router.push(path);
   };
@@ -107,6 +123,15 @@ const Layout = ({ children }) => {
         </div>
       </nav>
 
+      {user && !user.verified && (
+        <div style={{ background: '#fef3c7', color: '#92400e', padding: '0.75rem 1rem', textAlign: 'center', fontSize: '0.875rem' }}>
+          {verifyNotice || 'Please confirm your email address to post, comment and chat.'}{' '}
+          <button onClick={resendVerification} style={{ background: 'none', border: 'none', color: '#92400e', fontWeight: '700', textDecoration: 'underline', cursor: 'pointer' }}>
+            Resend the email
+          </button>
+        </div>
+      )}
+
       {/* Main Content */}
       <main className="main-content">
         {children}
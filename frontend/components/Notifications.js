@@ -7,7 +7,7 @@
     const [unreadCount, setUnreadCount] = useState(0);
     const wrapperRef = useRef(null);
     // Only show these notification types for now (include follow responses and new follower)
-    const allowedNotificationTypes = ['follow_request', 'follow_request_response', 'new_follower', 'group_invitation', 'group_join_request', 'new_groupEvent'];
+    const allowedNotificationTypes = ['follow_request', 'follow_request_response', 'new_follower', 'group_invitation', 'group_join_request', 'new_groupEvent', 'group_event_cancelled', 'event_waitlist_promoted'];
 
     useEffect(() => {
       // Count only allowed notification types (ignore private messages / disabled types)
@@ -49,6 +49,8 @@
         'group_invitation': 'Group invitation',
         'new_groupPost': 'New group post',
         'new_groupEvent': 'New group event',
+        'group_event_cancelled': 'Event cancelled',
+        'event_waitlist_promoted': 'Off the waitlist',
         'follow_request': 'Follow request',
         'follow_request_response': 'Follow request reply',
         'new_follower': 'New follower'
@@ -244,14 +246,17 @@
         if (loading) return;
         setLoading(true);
         try {
-          const eventId = notification.PostId || notification.post_id || notification.postId || notification.PostId || 0;
+          const eventId = notification.event_id || notification.PostId || notification.post_id || notification.postId || 0;
           if (!eventId || Number(eventId) <= 0) {
             console.error('Missing event id on notification');
             setLoading(false);
             return;
           }
-          const resp = await fetch(`http://localhost:8080/groups/events/vote?event_id=${eventId}&choice=${choice}`, {
+          const groupId = notification.group_id || notification.GroupID || 0;
+          const resp = await fetch(`http://localhost:8080/groups/${groupId}/events/${eventId}/rsvp`, {
             method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ status: choice === 'yes' ? 'going' : 'not_going' }),
             credentials: 'include'
           });
           if (!resp.ok) {
@@ -267,7 +272,7 @@
             const actedPostId = Number(eventId);
             const matchesActed = (item) => {
               if (!item) return false;
-              const pid = item.PostId || item.post_id || item.postId || item.PostId || 0;
+              const pid = item.event_id || item.PostId || item.post_id || item.postId || 0;
               if (pid && Number(pid) === actedPostId) return true;
               // fallback: same type and same content
               if (item.type === notification.type && item.content === notification.content) return true;
@@ -10,6 +10,44 @@ export const useWebSocketContext = () => {
   return context;
 };
 
+// newClientID returns the client_id of a chat message: the server stores a
+// message once per client_id, so a send can be retried without duplicating it.
+export const newClientID = () => {
+  if (typeof crypto !== 'undefined' && crypto.randomUUID) {
+    return crypto.randomUUID();
+  }
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+};
+
+// Chat messages are ordered by their stored id; those still waiting for an
+// ack come last, in the order they were sent.
+export const compareChatMessages = (a, b) => {
+  if (a.message_id && b.message_id) return a.message_id - b.message_id;
+  if (a.message_id) return -1;
+  if (b.message_id) return 1;
+  return new Date(a.timestamp) - new Date(b.timestamp);
+};
+
+// mergeChatMessage adds msg to a conversation, replacing the copy already in
+// it: the same stored message, or the same sender's message with the same
+// client_id.
+export const mergeChatMessage = (list, msg) => {
+  const isSame = (m) =>
+    (msg.message_id && m.message_id === msg.message_id) ||
+    (msg.client_id && m.client_id === msg.client_id && m.from === msg.from);
+  const existing = list.find(isSame);
+  const merged = existing ? { ...existing, ...msg } : msg;
+  return [...list.filter(m => !isSame(m)), merged].sort(compareChatMessages);
+};
+
+// acknowledgeChatMessage gives the sent message with clientID the id the
+// server stored it with.
+export const acknowledgeChatMessage = (list, clientID, messageID) => {
+  const sent = list.find(m => m.client_id === clientID && m.pending);
+  if (!sent) return list;
+  return mergeChatMessage(list.filter(m => m !== sent), { ...sent, message_id: messageID, pending: false });
+};
+
 export const WebSocketProvider = ({ children, userID }) => {
   const [connected, setConnected] = useState(false);
   const [messages, setMessages] = useState([]);
@@ -18,6 +56,9 @@ export const WebSocketProvider = ({ children, userID }) => {
   const socketRef = useRef(null);
   const messageListenersRef = useRef(new Set());
   const reconnectTimeoutRef = useRef(null);
+  // Where this page is in the server's event stream, to resume after a reconnect
+  const streamRef = useRef('');
+  const lastSeqRef = useRef(0);
 
   // Subscribe to specific message types
   const subscribe = useCallback((listener) => {
@@ -55,19 +96,34 @@ export const WebSocketProvider = ({ children, userID }) => {
       socketRef.current.close();
     }
 
-    const url = `ws://localhost:8080/ws?user_id=${userId}`;
+    let url = `ws://localhost:8080/ws`;
+    if (streamRef.current) {
+      url += `?stream=${encodeURIComponent(streamRef.current)}&since=${lastSeqRef.current}`;
+    }
     console.log('[WebSocket] Connecting to:', url);
     
-      const socket = new WebSocket(url);
+      // Version 2 of the protocol: every frame is an envelope, see
+      // backend/pkg/apis/chat/PROTOCOL.md
+      const socket = new WebSocket(url, ['socialnetwork.v2']);
     
     socket.onopen = () => {
       console.log('[WebSocket] Connected successfully');
       setConnected(true);
-      
+
+      // Load unread notifications stored while offline (or seen on another device)
+      fetch('http://localhost:8080/notifications?unread=1', { credentials: 'include' })
+        .then(res => (res.ok ? res.json() : null))
+        .then(data => {
+          if (data && Array.isArray(data.notifications)) {
+            setNotifications(data.notifications.slice().reverse());
+          }
+        })
+        .catch(err => console.error('[WebSocket] Failed to load notifications:', err));
+
       // Request online users list
       setTimeout(() => {
         if (socket.readyState === WebSocket.OPEN) {
-          socket.send(JSON.stringify({ type: 'get_online_users' }));
+          socket.send(JSON.stringify({ v: 2, type: 'get_online_users', payload: {} }));
         }
       }, 100);
     };
@@ -94,11 +150,36 @@ export const WebSocketProvider = ({ children, userID }) => {
 
     socket.onmessage = (event) => {
       try {
-        const data = JSON.parse(event.data);
+        // Listeners get the payload's fields next to the envelope's type, id and seq
+        const frame = JSON.parse(event.data);
+        const data = { ...frame.payload, type: frame.type };
+        if (frame.id) data.id = frame.id;
+        if (frame.seq) data.seq = frame.seq;
         console.log('[WebSocket] Message received:', data);
+
+        // Numbered events: skip any already seen, remember the latest
+        // (hello and resync frames carry the position to start from instead)
+        if (data.seq && data.type !== 'hello' && data.type !== 'resync') {
+          if (data.seq <= lastSeqRef.current) return;
+          lastSeqRef.current = data.seq;
+        }
         
         // Handle different message types
         switch (data.type) {
+          case 'hello':
+            // The server replays what was missed right after this
+            streamRef.current = data.stream;
+            lastSeqRef.current = data.seq || 0;
+            return;
+
+          case 'resync':
+            // Too much was missed: start over from the current state. Listeners
+            // get the frame and reload their data.
+            streamRef.current = data.stream;
+            lastSeqRef.current = data.seq || 0;
+            setMessages([]);
+            break;
+
           case 'online_users':
             setOnlineUsers(data.users || []);
             break;
@@ -113,26 +194,19 @@ export const WebSocketProvider = ({ children, userID }) => {
             
           case 'private_message':
           case 'message':
-            // Private/chat messages are stored separately
-            // Avoid duplicates: compare from/content and timestamp proximity (3s)
+            // Private/chat messages are stored separately, once per message_id
             setMessages(prev => {
-              try {
-                const isDup = prev.some(m => {
-                  if (!m || !m.content) return false;
-                  if (m.type !== data.type) return false;
-                  if (m.from !== data.from) return false;
-                  if (m.content !== data.content) return false;
-                  const t1 = new Date(m.timestamp || m.Timestamp || Date.now()).getTime();
-                  const t2 = new Date(data.timestamp || data.Timestamp || Date.now()).getTime();
-                  return Math.abs(t1 - t2) < 3000; // 3 seconds
-                });
-                if (isDup) return prev;
-              } catch (err) {
-                // fallback: append if detection fails
+              if (data.message_id && prev.some(m => m && m.type === data.type && m.message_id === data.message_id)) {
+                return prev;
               }
               return [...prev, data];
             });
             break;
+
+          case 'ack':
+          case 'nack':
+            // Answers to this page's sends, for the chat that sent them
+            break;
             
           // Treat only the allowed types as visible notifications (not private messages).
           // Disabled other notification types for now per product request.
@@ -143,12 +217,15 @@ export const WebSocketProvider = ({ children, userID }) => {
           // - group_invitation: when a user is invited to a group
           // - group_join_request: when a user requests to join a group (for group creators)
           // - new_groupEvent: when a group event is created (for group members)
+          // - group_event_cancelled / event_waitlist_promoted: changes to an event the user RSVP'd to
           case 'follow_request':
           case 'follow_request_response':
           case 'new_follower':
           case 'group_invitation':
           case 'group_join_request':
           case 'new_groupEvent':
+          case 'group_event_cancelled':
+          case 'event_waitlist_promoted':
             setNotifications(prev => {
               try {
                 const exists = (prev || []).some(item => {
@@ -174,21 +251,11 @@ export const WebSocketProvider = ({ children, userID }) => {
             break;
             
           case 'group_message':
-            // Group messages — dedupe similar to private messages
+            // Group messages — deduped on message_id like private messages
             setMessages(prev => {
-              try {
-                const isDup = prev.some(m => {
-                  if (!m || !m.content) return false;
-                  if (m.type !== data.type) return false;
-                  if ((m.group_id || m.GroupID) !== (data.group_id || data.GroupID)) return false;
-                  if (m.from !== data.from) return false;
-                  if (m.content !== data.content) return false;
-                  const t1 = new Date(m.timestamp || m.Timestamp || Date.now()).getTime();
-                  const t2 = new Date(data.timestamp || data.Timestamp || Date.now()).getTime();
-                  return Math.abs(t1 - t2) < 3000;
-                });
-                if (isDup) return prev;
-              } catch (err) {}
+              if (data.message_id && prev.some(m => m && m.type === data.type && m.message_id === data.message_id)) {
+                return prev;
+              }
               return [...prev, data];
             });
             break;
@@ -218,7 +285,8 @@ export const WebSocketProvider = ({ children, userID }) => {
   const sendMessage = useCallback((messageData) => {
     if (socketRef.current && socketRef.current.readyState === WebSocket.OPEN) {
       try {
-        socketRef.current.send(JSON.stringify(messageData));
+        const { type, id, ...payload } = messageData;
+        socketRef.current.send(JSON.stringify({ v: 2, type, id, payload }));
         console.log('[WebSocket] Message sent:', messageData);
         return true;
       } catch (error) {
@@ -241,6 +309,8 @@ export const WebSocketProvider = ({ children, userID }) => {
       socketRef.current = null;
     }
     setConnected(false);
+    streamRef.current = '';
+    lastSeqRef.current = 0;
     setMessages([]);
     setOnlineUsers([]);
     setNotifications([]);
@@ -283,8 +353,12 @@ export const WebSocketProvider = ({ children, userID }) => {
     disconnect,
     reconnect: () => connectWebSocket(userID),
     subscribe,
-    // Clear all notifications (client-side)
-    clearNotifications: () => setNotifications([]),
+    // Clear all notifications and mark them read on the server
+    clearNotifications: () => {
+      setNotifications([]);
+      fetch('http://localhost:8080/notifications/read-all', { method: 'POST', credentials: 'include' })
+        .catch(err => console.error('[WebSocket] Failed to mark notifications read:', err));
+    },
     // Setter exposed if needed by components
     setNotifications
   };
@@ -5,6 +5,7 @@ export const useSession = () => {
     isLoggedIn: false,
     userID: null,
     username: null,
+    verified: true,
     loading: true
   });
 
@@ -25,6 +26,7 @@ export const useSession = () => {
           isLoggedIn: true,
           userID: data.userID,
           username: data.username,
+          verified: data.verified !== false,
           loading: false
         });
         
@@ -90,7 +92,8 @@ export const useSession = () => {
   return {
     user: session.isLoggedIn ? {
       userID: session.userID,
-      username: session.username
+      username: session.username,
+      verified: session.verified
     } : null,
     loading: session.loading,
     session,
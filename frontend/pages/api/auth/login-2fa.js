@@ -0,0 +1,35 @@
+// pages/api/auth/login-2fa.js
+export default async function handler(req, res) {
+  if (req.method === 'POST') {
+    try {
+      // Determine backend URL and forward the login request to it
+      const BACKEND_URL = process.env.BACKEND_URL || process.env.NEXT_PUBLIC_BACKEND_URL || 'http://localhost:8080';
+      // Forward the second login step (authentication code) to the Go backend
+      const response = await fetch(`${BACKEND_URL}/login/2fa`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          // Lets the backend throttle failed logins per client address
+          'X-Forwarded-For': [req.headers['x-forwarded-for'], req.socket.remoteAddress].filter(Boolean).join(', '),
+        },
+        body: JSON.stringify(req.body),
+      });
+      
+      const data = await response.json();
+      
+      // Forward any set-cookie headers from the backend
+      const setCookieHeader = response.headers.get('set-cookie');
+      if (setCookieHeader) {
+        res.setHeader('Set-Cookie', setCookieHeader);
+      }
+      
+      res.status(response.status).json(data);
+    } catch (error) {
+      console.error('Login failed:', error);
+      res.status(500).json({ error: 'Login failed' });
+    }
+  } else {
+    res.setHeader('Allow', ['POST']);
+    res.status(405).end(`Method ${req.method} Not Allowed`);
+  }
+}
\ No newline at end of file
@@ -9,6 +9,8 @@ export default async function handler(req, res) {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          // Lets the backend throttle failed logins per client address
+          'X-Forwarded-For': [req.headers['x-forwarded-for'], req.socket.remoteAddress].filter(Boolean).join(', '),
         },
         body: JSON.stringify(req.body),
       });
@@ -2,15 +2,20 @@
 export default async function handler(req, res) {
   if (req.method === 'GET') {
     try {
-      const { group_id, offset = 0 } = req.query;
+      const { group_id, before, after, limit } = req.query;
       
       if (!group_id) {
         return res.status(400).json({ error: 'Missing group_id parameter' });
       }
 
       const BACKEND_URL = process.env.BACKEND_URL || process.env.NEXT_PUBLIC_BACKEND_URL || 'http://localhost:8080';
+      const params = new URLSearchParams({ group_id });
+      if (before) params.set('before', before);
+      if (after) params.set('after', after);
+      if (limit) params.set('limit', limit);
+
       // Forward the request to the Go backend
-      const response = await fetch(`${BACKEND_URL}/group-messages?group_id=${group_id}&offset=${offset}`, {
+      const response = await fetch(`${BACKEND_URL}/group-messages?${params}`, {
         method: 'GET',
         headers: {
           'Cookie': req.headers.cookie || '',
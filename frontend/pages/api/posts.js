@@ -4,9 +4,13 @@ export default async function handler(req, res) {
   const BACKEND_URL = process.env.BACKEND_URL || process.env.NEXT_PUBLIC_BACKEND_URL || 'http://localhost:8080';
   let url = `${BACKEND_URL}/get-posts`;
     
-    // Handle query parameters for category filtering
-    if (req.query.category) {
-      url += `?category=${encodeURIComponent(req.query.category)}`;
+    // Handle query parameters for category filtering and pagination
+    const params = new URLSearchParams();
+    for (const key of ['category', 'before', 'after', 'limit']) {
+      if (req.query[key]) params.set(key, req.query[key]);
+    }
+    if (params.toString()) {
+      url += `?${params}`;
     }
 
     const response = await fetch(url, {
@@ -30,6 +30,8 @@ export default async function handler(req, res) {
     if (req.headers['content-length']) {
       headers['Content-Length'] = req.headers['content-length'];
     }
+    // Lets the backend rate limit signups per client address
+    headers['X-Forwarded-For'] = [req.headers['x-forwarded-for'], req.socket.remoteAddress].filter(Boolean).join(', ');
 
     // Determine backend URL from env
     const BACKEND_URL = process.env.BACKEND_URL || process.env.NEXT_PUBLIC_BACKEND_URL || 'http://localhost:8080';
@@ -0,0 +1,82 @@
+import { useState } from 'react';
+import Head from 'next/head';
+import Link from 'next/link';
+
+const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL || process.env.BACKEND_URL || 'http://localhost:8080';
+
+export default function ForgotPassword() {
+  const [email, setEmail] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState('');
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+    setMessage('');
+
+    try {
+      const response = await fetch(`${BACKEND_URL}/forgot-password`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email }),
+      });
+      if (response.ok) {
+        const data = await response.json();
+        setMessage(data.message);
+      } else {
+        const text = await response.text();
+        let reason = text;
+        try {
+          // Throttled requests answer with JSON
+          reason = JSON.parse(text).message || text;
+        } catch (err) {}
+        setError(reason || 'Something went wrong. Please try again.');
+      }
+    } catch (err) {
+      setError('An error occurred. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <>
+      <Head>
+        <title>Forgot password - SocialNet</title>
+      </Head>
+      <div className="login-page-bg" style={{ minHeight: '100vh', display: 'flex', alignItems: 'center', justifyContent: 'center', padding: '2rem' }}>
+        <div style={{ maxWidth: '480px', width: '100%', background: 'rgba(255, 255, 255, 0.98)', borderRadius: '24px', padding: '2.5rem', boxShadow: '0 25px 50px rgba(0, 0, 0, 0.25)' }}>
+          <h1 style={{ fontSize: '1.75rem', fontWeight: '800', color: '#111827', marginBottom: '0.5rem' }}>Forgot your password?</h1>
+          <p style={{ color: '#6b7280', marginBottom: '1.5rem' }}>Enter the email of your account and we will send you a link to choose a new one.</p>
+
+          {message && <p style={{ background: '#dcfce7', color: '#166534', borderRadius: '12px', padding: '1rem' }}>{message}</p>}
+          {error && <p style={{ background: '#fee2e2', color: '#dc2626', borderRadius: '12px', padding: '1rem' }}>{error}</p>}
+
+          <form onSubmit={handleSubmit}>
+            <input
+              type="email"
+              required
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+              placeholder="you@example.com"
+              style={{ width: '100%', padding: '0.875rem 1rem', border: '2px solid #e5e7eb', borderRadius: '12px', fontSize: '1rem', marginBottom: '1rem' }}
+            />
+            <button
+              type="submit"
+              disabled={loading}
+              style={{ width: '100%', padding: '1rem', background: loading ? '#9ca3af' : 'linear-gradient(135deg, #667eea 0%, #764ba2 100%)', color: 'white', border: 'none', borderRadius: '12px', fontWeight: '700', cursor: loading ? 'not-allowed' : 'pointer' }}
+            >
+              {loading ? 'Sending...' : 'Send reset link'}
+            </button>
+          </form>
+
+          <p style={{ marginTop: '1.5rem', textAlign: 'center' }}>
+            <Link href="/login" style={{ color: '#667eea', fontWeight: '600' }}>Back to sign in</Link>
+          </p>
+        </div>
+      </div>
+    </>
+  );
+}
@@ -9,6 +9,8 @@ export default function Login() {
   });
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [pendingToken, setPendingToken] = useState('');
+  const [code, setCode] = useState('');
   const router = useRouter();
 
   const handleChange = (e) => {
@@ -24,12 +26,19 @@ export default function Login() {
     setError('');
 
     try {
-      const response = await fetch('/api/auth/login', {
+      // The second step sends the authentication code (or a recovery code) with the pending token
+      const secondStep = pendingToken !== '';
+      const trimmed = code.trim();
+      const response = await fetch(secondStep ? '/api/auth/login-2fa' : '/api/auth/login', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(formData),
+        body: JSON.stringify(secondStep
+          ? (/^\d{6}$/.test(trimmed)
+            ? { pending_token: pendingToken, code: trimmed }
+            : { pending_token: pendingToken, recovery_code: trimmed })
+          : formData),
         credentials: 'include'
       });
 
@@ -37,18 +46,29 @@ export default function Login() {
 
       console.log('Login response:', { status: response.status, ok: response.ok, data });
       
-      if (response.ok && data.message === "Login successful.") {
+      if (response.ok && data.two_factor_required) {
+        setPendingToken(data.pending_token);
+        setCode('');
+      } else if (response.ok && data.message === "Login successful.") {
         console.log('Login successful, redirecting...');
         
         // Clear form and error
         setFormData({ userOremail: '', password: '' });
         setError('');
+
+        if (data.account_restored) {
+          alert('Welcome back! Your account is no longer scheduled for deletion.');
+        }
         
         // Force a full page navigation to avoid React Router issues
         window.location.replace('/');
       } else {
         console.log('Login failed:', data);
         setError(data.message || data.error || 'Invalid credentials');
+        if (secondStep && response.status === 401 && data.message !== 'Invalid authentication code.') {
+          // The pending login expired or ran out of attempts: start over
+          setPendingToken('');
+        }
       }
     } catch (err) {
       setError('An error occurred. Please try again.');
@@ -146,6 +166,41 @@ export default function Login() {
                 </div>
               )}
               
+              {pendingToken ? (
+              <div style={{ marginBottom: '2rem' }}>
+                <label htmlFor="code" style={{
+                  display: 'block',
+                  fontSize: '0.875rem',
+                  fontWeight: '600',
+                  color: '#374151',
+                  marginBottom: '0.5rem'
+                }}>
+                  Authentication code
+                </label>
+                <input
+                  id="code"
+                  name="code"
+                  type="text"
+                  autoComplete="one-time-code"
+                  required
+                  autoFocus
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  style={{
+                    width: '100%',
+                    padding: '0.875rem 1rem',
+                    border: '2px solid #e5e7eb',
+                    borderRadius: '12px',
+                    fontSize: '1rem',
+                    color: '#111827',
+                    background: '#f9fafb',
+                    outline: 'none'
+                  }}
+                  placeholder="6-digit code or a recovery code"
+                />
+              </div>
+              ) : (
+              <>
               {/* Username/Email Field */}
               <div style={{ marginBottom: '1.5rem' }}>
                 <label htmlFor="userOremail" style={{
@@ -258,6 +313,18 @@ export default function Login() {
                 </div>
               </div>
 
+              <div style={{ textAlign: 'right', marginTop: '-1.25rem', marginBottom: '1.5rem' }}>
+                <a
+                  onClick={() => router.push('/forgotPassword')}
+                  style={{ fontSize: '0.875rem', fontWeight: '600', color: '#667eea', cursor: 'pointer' }}
+                >
+                  Forgot your password?
+                </a>
+              </div>
+
+              </>
+              )}
+
               {/* Sign In Button */}
               <button
                 type="submit"
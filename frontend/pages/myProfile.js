@@ -7,6 +7,8 @@ import { useWebSocketContext } from '../contexts/WebSocketContext';
 import { useChat } from '../hooks/useChat';
 import Chat from '../components/Chat';
 
+const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL || process.env.BACKEND_URL || 'http://localhost:8080';
+
 export default function MyProfile() {
   const [profile, setProfile] = useState(null);
   const [posts, setPosts] = useState([]);
@@ -29,6 +31,10 @@ export default function MyProfile() {
   });
 
  const [avatarRefresh, setAvatarRefresh] = useState(Date.now());
+  const [deleteForm, setDeleteForm] = useState({ password: '', code: '' });
+  const [deleteError, setDeleteError] = useState('');
+  const [dataExport, setDataExport] = useState(null);
+  const [exportError, setExportError] = useState('');
   const { user, loading: sessionLoading } = useSession();
   const { onlineUsers, subscribe } = useWebSocketContext();
   const { chatOpen, chatWith, startChat, setChatOpen } = useChat();
@@ -83,9 +89,41 @@ export default function MyProfile() {
     }
   };
 
+  const fetchDataExport = async () => {
+    try {
+      const response = await fetch(`${BACKEND_URL}/account/export`, { credentials: 'include' });
+      if (response.ok) {
+        const data = await response.json();
+        setDataExport(data.export);
+      }
+    } catch (error) {
+      console.error('Error fetching data export:', error);
+    }
+  };
+
+  const handleRequestExport = async () => {
+    setExportError('');
+    try {
+      const response = await fetch(`${BACKEND_URL}/account/export`, {
+        method: 'POST',
+        credentials: 'include'
+      });
+      if (response.ok) {
+        const data = await response.json();
+        setDataExport(data.export);
+      } else {
+        setExportError(await response.text());
+      }
+    } catch (error) {
+      console.error('Error requesting data export:', error);
+      setExportError('Failed to start data export');
+    }
+  };
+
   useEffect(() => {
     if (user && user.userID) {
       fetchProfile();
+      fetchDataExport();
     }
   }, [user?.userID]);
 
@@ -98,6 +136,9 @@ export default function MyProfile() {
         console.log('[MyProfile] WS event received, refreshing profile:', message.type);
         fetchProfile();
       }
+      if (message.type === 'data_export_ready' || message.type === 'data_export_failed') {
+        fetchDataExport();
+      }
     });
 
     return () => {
@@ -197,6 +238,40 @@ export default function MyProfile() {
     });
   };
 
+  const handleDeleteAccount = async (e) => {
+    e.preventDefault();
+    if (!window.confirm('Delete your account? It is deactivated now and erased for good after 14 days unless you log in again.')) {
+      return;
+    }
+    setDeleteError('');
+    try {
+      // A 6 digit code is an authenticator code, anything else a recovery code
+      const code = deleteForm.code.trim();
+      const body = { password: deleteForm.password };
+      if (/^\d{6}$/.test(code)) {
+        body.code = code;
+      } else if (code) {
+        body.recovery_code = code;
+      }
+      const response = await fetch(`${BACKEND_URL}/account/delete`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        credentials: 'include',
+        body: JSON.stringify(body)
+      });
+      const data = await response.json().catch(() => ({}));
+      if (response.ok) {
+        alert(data.message);
+        router.push('/login');
+      } else {
+        setDeleteError(data.message || 'Failed to delete account');
+      }
+    } catch (error) {
+      console.error('Error deleting account:', error);
+      setDeleteError('Failed to delete account');
+    }
+  };
+
   const handleFollowRequest = async (requesterId, action) => {
     try {
       const response = await fetch('/api/handle-follow-request', {
@@ -551,6 +626,71 @@ export default function MyProfile() {
                     </button>
                   </div>
                 </form>
+
+                {/* Download My Data */}
+                <div style={{ marginTop: '2rem', paddingTop: '1.5rem', borderTop: '1px solid #e5e7eb' }}>
+                  <h3 style={{ fontSize: '1.125rem', fontWeight: '600', marginBottom: '0.5rem' }}>Download My Data</h3>
+                  <p style={{ fontSize: '0.875rem', color: '#4b5563', marginBottom: '1rem' }}>
+                    Get a ZIP archive of your profile, posts, comments, likes, followers, messages, groups and events, with the photos you uploaded. We notify you when it is ready; the download link works for 7 days.
+                  </p>
+                  {dataExport?.status === 'pending' && (
+                    <p style={{ fontSize: '0.875rem', marginBottom: '0.75rem' }}>Your archive is being prepared…</p>
+                  )}
+                  {dataExport?.download_url && (
+                    <p style={{ fontSize: '0.875rem', marginBottom: '0.75rem' }}>
+                      <a href={`${BACKEND_URL}${dataExport.download_url}`} style={{ color: '#2563eb', textDecoration: 'underline' }}>
+                        Download archive
+                      </a>
+                      {' '}(available until {new Date(dataExport.expires_at).toLocaleString()})
+                    </p>
+                  )}
+                  {dataExport?.status === 'failed' && (
+                    <p style={{ color: '#b91c1c', fontSize: '0.875rem', marginBottom: '0.75rem' }}>Your last export failed. Please try again.</p>
+                  )}
+                  {exportError && <p style={{ color: '#b91c1c', fontSize: '0.875rem', marginBottom: '0.75rem' }}>{exportError}</p>}
+                  <button
+                    type="button"
+                    onClick={handleRequestExport}
+                    disabled={dataExport?.status === 'pending'}
+                    className="icon-btn"
+                    style={{ minWidth: '120px' }}
+                  >
+                    Request Export
+                  </button>
+                </div>
+
+                {/* Delete Account */}
+                <form onSubmit={handleDeleteAccount} style={{ marginTop: '2rem', paddingTop: '1.5rem', borderTop: '1px solid #e5e7eb' }}>
+                  <h3 style={{ fontSize: '1.125rem', fontWeight: '600', marginBottom: '0.5rem', color: '#b91c1c' }}>Delete Account</h3>
+                  <p style={{ fontSize: '0.875rem', color: '#4b5563', marginBottom: '1rem' }}>
+                    Your profile is hidden and you are logged out everywhere right away. After 14 days your posts, comments, messages and photos are erased; groups you created pass to another member. Log in before then to keep your account.
+                  </p>
+                  <div style={{ display: 'grid', gridTemplateColumns: '1fr 1fr', gap: '1rem', marginBottom: '1rem' }}>
+                    <input
+                      type="password"
+                      placeholder="Password"
+                      value={deleteForm.password}
+                      onChange={(e) => setDeleteForm({...deleteForm, password: e.target.value})}
+                      style={{ width: '100%', padding: '0.5rem 0.75rem', border: '1px solid #d1d5db', borderRadius: '0.5rem' }}
+                      required
+                    />
+                    <input
+                      type="text"
+                      placeholder="Authentication code (if enabled)"
+                      value={deleteForm.code}
+                      onChange={(e) => setDeleteForm({...deleteForm, code: e.target.value})}
+                      style={{ width: '100%', padding: '0.5rem 0.75rem', border: '1px solid #d1d5db', borderRadius: '0.5rem' }}
+                    />
+                  </div>
+                  {deleteError && <p style={{ color: '#b91c1c', fontSize: '0.875rem', marginBottom: '0.75rem' }}>{deleteError}</p>}
+                  <button
+                    type="submit"
+                    className="icon-btn dislike-btn"
+                    style={{ minWidth: '120px' }}
+                  >
+                    Delete Account
+                  </button>
+                </form>
               </div>
             )}
 
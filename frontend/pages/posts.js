@@ -62,6 +62,12 @@ export default function Posts() {
     const unsubscribe = subscribe((message) => {
       console.log('[Posts] Received WebSocket message:', message);
 
+      // Events were missed while disconnected: reload the feed
+      if (message.type === 'resync') {
+        fetchPosts();
+        fetchFollowingUsers();
+        return;
+      }
 
       // Handle normal post creation
       if (message.type === 'new_post') {
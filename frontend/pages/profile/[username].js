@@ -52,16 +52,10 @@ export default function ProfilePage() {
         const t = (message && (message.type || message.Type));
         if (t !== 'follow_request_response') return;
 
-        // Ensure this message is addressed to the current user
-        const to = message.to || message.To || message.ToUser || null;
+        // The frame is only ever sent to the user who asked to follow
         const from = message.from || message.From || null;
         const usernameFrom = message.username || message.Username || null;
 
-        const currentUserId = user?.userID || user?.id;
-        if (!currentUserId) return;
-
-        if (parseInt(to) !== parseInt(currentUserId)) return;
-
         // If we're viewing this user's profile (by username) or the sender id matches
         if ((username && usernameFrom && usernameFrom === username) || (from && profile && (parseInt(from) === parseInt(profile.id)))) {
           // Refresh profile so it becomes viewable immediately
@@ -0,0 +1,82 @@
+import { useState } from 'react';
+import { useRouter } from 'next/router';
+import Head from 'next/head';
+import Link from 'next/link';
+
+const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL || process.env.BACKEND_URL || 'http://localhost:8080';
+
+export default function ResetPassword() {
+  const router = useRouter();
+  const { token } = router.query;
+  const [password, setPassword] = useState('');
+  const [confirm, setConfirm] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState('');
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+    if (password !== confirm) {
+      setError('Passwords do not match.');
+      return;
+    }
+    setLoading(true);
+
+    try {
+      const response = await fetch(`${BACKEND_URL}/reset-password`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token, password }),
+      });
+      const data = await response.json().catch(() => ({}));
+      if (response.ok && data.success) {
+        setMessage(data.message);
+      } else {
+        setError(data.message || 'Could not reset the password.');
+      }
+    } catch (err) {
+      setError('An error occurred. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const inputStyle = { width: '100%', padding: '0.875rem 1rem', border: '2px solid #e5e7eb', borderRadius: '12px', fontSize: '1rem', marginBottom: '1rem' };
+
+  return (
+    <>
+      <Head>
+        <title>Reset password - SocialNet</title>
+      </Head>
+      <div className="login-page-bg" style={{ minHeight: '100vh', display: 'flex', alignItems: 'center', justifyContent: 'center', padding: '2rem' }}>
+        <div style={{ maxWidth: '480px', width: '100%', background: 'rgba(255, 255, 255, 0.98)', borderRadius: '24px', padding: '2.5rem', boxShadow: '0 25px 50px rgba(0, 0, 0, 0.25)' }}>
+          <h1 style={{ fontSize: '1.75rem', fontWeight: '800', color: '#111827', marginBottom: '1.5rem' }}>Choose a new password</h1>
+
+          {error && <p style={{ background: '#fee2e2', color: '#dc2626', borderRadius: '12px', padding: '1rem' }}>{error}</p>}
+
+          {message ? (
+            <>
+              <p style={{ background: '#dcfce7', color: '#166534', borderRadius: '12px', padding: '1rem' }}>{message}</p>
+              <p style={{ textAlign: 'center' }}>
+                <Link href="/login" style={{ color: '#667eea', fontWeight: '600' }}>Sign in</Link>
+              </p>
+            </>
+          ) : (
+            <form onSubmit={handleSubmit}>
+              <input type="password" required value={password} onChange={(e) => setPassword(e.target.value)} placeholder="New password" style={inputStyle} />
+              <input type="password" required value={confirm} onChange={(e) => setConfirm(e.target.value)} placeholder="Repeat the new password" style={inputStyle} />
+              <button
+                type="submit"
+                disabled={loading || !token}
+                style={{ width: '100%', padding: '1rem', background: loading ? '#9ca3af' : 'linear-gradient(135deg, #667eea 0%, #764ba2 100%)', color: 'white', border: 'none', borderRadius: '12px', fontWeight: '700', cursor: loading ? 'not-allowed' : 'pointer' }}
+              >
+                {loading ? 'Saving...' : 'Reset password'}
+              </button>
+            </form>
+          )}
+        </div>
+      </div>
+    </>
+  );
+}
@@ -0,0 +1,60 @@
+import { useEffect, useState } from 'react';
+import { useRouter } from 'next/router';
+import Head from 'next/head';
+import Link from 'next/link';
+
+const BACKEND_URL = process.env.NEXT_PUBLIC_BACKEND_URL || process.env.BACKEND_URL || 'http://localhost:8080';
+
+export default function VerifyEmail() {
+  const router = useRouter();
+  const { token } = router.query;
+  const [status, setStatus] = useState('pending');
+  const [message, setMessage] = useState('Confirming your email address...');
+
+  useEffect(() => {
+    if (!router.isReady) return;
+    if (!token) {
+      setStatus('error');
+      setMessage('This verification link is incomplete.');
+      return;
+    }
+
+    fetch(`${BACKEND_URL}/verify-email`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token }),
+    })
+      .then((response) => response.json().then((data) => ({ ok: response.ok, data })))
+      .then(({ ok, data }) => {
+        setStatus(ok && data.success ? 'done' : 'error');
+        setMessage(data.message || 'Could not verify your email address.');
+      })
+      .catch(() => {
+        setStatus('error');
+        setMessage('An error occurred. Please try again.');
+      });
+  }, [router.isReady, token]);
+
+  const colors = status === 'done'
+    ? { background: '#dcfce7', color: '#166534' }
+    : status === 'error'
+      ? { background: '#fee2e2', color: '#dc2626' }
+      : { background: '#f3f4f6', color: '#374151' };
+
+  return (
+    <>
+      <Head>
+        <title>Verify email - SocialNet</title>
+      </Head>
+      <div className="login-page-bg" style={{ minHeight: '100vh', display: 'flex', alignItems: 'center', justifyContent: 'center', padding: '2rem' }}>
+        <div style={{ maxWidth: '480px', width: '100%', background: 'rgba(255, 255, 255, 0.98)', borderRadius: '24px', padding: '2.5rem', boxShadow: '0 25px 50px rgba(0, 0, 0, 0.25)' }}>
+          <h1 style={{ fontSize: '1.75rem', fontWeight: '800', color: '#111827', marginBottom: '1.5rem' }}>Email verification</h1>
+          <p style={{ ...colors, borderRadius: '12px', padding: '1rem' }}>{message}</p>
+          <p style={{ marginTop: '1.5rem', textAlign: 'center' }}>
+            <Link href="/" style={{ color: '#667eea', fontWeight: '600' }}>Continue to SocialNet</Link>
+          </p>
+        </div>
+      </div>
+    </>
+  );
+}
@@ -20,7 +20,7 @@ export default function WebSocketTest() {
       socket.close();
     }
 
-    const url = `ws://localhost:8080/ws?user_id=${userId}`;
+    const url = `ws://localhost:8080/ws`;
     addLog(`WebSocket URL: ${url}`);
     
     const newSocket = new WebSocket(url);